@@ -6,10 +6,12 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Redis       RedisConfig
+	JWT         JWTConfig
+	Trash       TrashConfig
+	Idempotency IdempotencyConfig
 }
 
 type ServerConfig struct {
@@ -37,6 +39,15 @@ type JWTConfig struct {
 	Expiry int // hours
 }
 
+type TrashConfig struct {
+	RetentionDays int // how long deleted entries and collections can be restored
+	PurgeInterval int // minutes between purges of expired trash
+}
+
+type IdempotencyConfig struct {
+	TTL int // hours a response is replayed for retries with the same Idempotency-Key
+}
+
 func Load() (*Config, error) {
 	return &Config{
 		Server: ServerConfig{
@@ -60,6 +71,13 @@ func Load() (*Config, error) {
 			Secret: getEnv("JWT_SECRET", "your-secret-key"),
 			Expiry: getEnvAsInt("JWT_EXPIRY", 24),
 		},
+		Trash: TrashConfig{
+			RetentionDays: getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+			PurgeInterval: getEnvAsInt("TRASH_PURGE_INTERVAL", 60),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: getEnvAsInt("IDEMPOTENCY_TTL", 24),
+		},
 	}, nil
 }
 
@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"media-tracker/internal/models"
 	"media-tracker/internal/services"
@@ -52,6 +59,35 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+func (h *AuthHandler) GetSettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	settings, err := h.authService.GetSettings(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *AuthHandler) UpdateSettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.authService.UpdateSettings(c.Request.Context(), userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
 // MediaHandler
 type MediaHandler struct {
 	mediaService *services.MediaService
@@ -70,7 +106,7 @@ func (h *MediaHandler) Create(c *gin.Context) {
 
 	media, err := h.mediaService.Create(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -124,35 +160,125 @@ func (h *MediaHandler) Search(c *gin.Context) {
 // EntryHandler
 type EntryHandler struct {
 	entryService *services.EntryService
-	mediaService *services.MediaService
+	syncService  *services.SyncService
 }
 
-func NewEntryHandler(entryService *services.EntryService, mediaService *services.MediaService) *EntryHandler {
-	return &EntryHandler{entryService: entryService, mediaService: mediaService}
+func NewEntryHandler(entryService *services.EntryService, syncService *services.SyncService) *EntryHandler {
+	return &EntryHandler{entryService: entryService, syncService: syncService}
 }
 
+// List returns the user's entries as a JSON array. When there are more, the
+// X-Next-Cursor header (and a Link rel="next") points at the next page.
 func (h *EntryHandler) List(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	var status *models.Status
+	query, err := parseEntryListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.entryService.List(c.Request.Context(), userID.(uuid.UUID), query)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if page.NextCursor != "" {
+		next := *c.Request.URL
+		params := next.Query()
+		params.Set("cursor", page.NextCursor)
+		next.RawQuery = params.Encode()
+
+		c.Header("X-Next-Cursor", page.NextCursor)
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	entries := page.Entries
+	if entries == nil {
+		entries = []*models.Entry{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func parseEntryListQuery(c *gin.Context) (*models.EntryListQuery, error) {
+	query := &models.EntryListQuery{
+		Sort:   models.EntrySort(c.DefaultQuery("sort", string(models.EntrySortUpdated))),
+		Search: strings.TrimSpace(c.Query("q")),
+	}
+
+	switch c.Query("order") {
+	case "":
+		query.Descending = query.Sort.DefaultDescending()
+	case "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
 	if statusStr := c.Query("status"); statusStr != "" {
 		s := models.Status(statusStr)
-		status = &s
+		query.Status = &s
 	}
 
-	var mediaType *models.MediaType
 	if typeStr := c.Query("type"); typeStr != "" {
 		mt := models.MediaType(typeStr)
-		mediaType = &mt
+		query.Type = &mt
 	}
 
-	entries, err := h.entryService.List(c.Request.Context(), userID.(uuid.UUID), status, mediaType)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if genre := c.Query("genre"); genre != "" {
+		query.Genre = &genre
 	}
+	query.Tags = c.QueryArray("tag")
 
-	c.JSON(http.StatusOK, entries)
+	var err error
+	if query.Limit, err = intQuery(c, "limit"); err != nil {
+		return nil, err
+	}
+	if query.RatingMin, err = floatQuery(c, "rating_min"); err != nil {
+		return nil, err
+	}
+	if query.RatingMax, err = floatQuery(c, "rating_max"); err != nil {
+		return nil, err
+	}
+	if year, err := intQuery(c, "year"); err != nil {
+		return nil, err
+	} else if year != 0 {
+		query.Year = &year
+	}
+	if query.FinishedFrom, err = dateQuery(c, "finished_from"); err != nil {
+		return nil, err
+	}
+	if query.FinishedTo, err = dateQuery(c, "finished_to"); err != nil {
+		return nil, err
+	}
+
+	if hasReview := c.Query("has_review"); hasReview != "" {
+		v, err := strconv.ParseBool(hasReview)
+		if err != nil {
+			return nil, fmt.Errorf("has_review must be true or false")
+		}
+		query.HasReview = &v
+	}
+
+	if visibility := c.Query("visibility"); visibility != "" {
+		v := models.Visibility(visibility)
+		if !v.Valid() {
+			return nil, fmt.Errorf("unknown visibility %q", visibility)
+		}
+		query.Visibility = &v
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if query.Cursor, err = models.DecodeEntryCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
 }
 
 func (h *EntryHandler) Create(c *gin.Context) {
@@ -166,10 +292,11 @@ func (h *EntryHandler) Create(c *gin.Context) {
 
 	entry, err := h.entryService.Create(c.Request.Context(), userID.(uuid.UUID), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", etag(entry.Version))
 	c.JSON(http.StatusCreated, entry)
 }
 
@@ -180,12 +307,14 @@ func (h *EntryHandler) Get(c *gin.Context) {
 		return
 	}
 
-	entry, err := h.entryService.Get(c.Request.Context(), id)
+	userID, _ := c.Get("user_id")
+	entry, err := h.entryService.Get(c.Request.Context(), userID.(uuid.UUID), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
 		return
 	}
 
+	c.Header("ETag", etag(entry.Version))
 	c.JSON(http.StatusOK, entry)
 }
 
@@ -196,18 +325,29 @@ func (h *EntryHandler) Update(c *gin.Context) {
 		return
 	}
 
-	var req models.CreateEntryRequest
+	ifVersion, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateEntryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	entry, err := h.entryService.Update(c.Request.Context(), id, &req)
+	userID, _ := c.Get("user_id")
+	entry, err := h.entryService.Update(c.Request.Context(), userID.(uuid.UUID), id, &req, ifVersion)
+	if errors.Is(err, services.ErrStale) {
+		h.respondStale(c, userID.(uuid.UUID), id)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", etag(entry.Version))
 	c.JSON(http.StatusOK, entry)
 }
 
@@ -218,288 +358,940 @@ func (h *EntryHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.entryService.Delete(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	ifVersion, ok := requireIfMatch(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Entry deleted successfully"})
-}
-
-func (h *EntryHandler) Sync(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-
-	var req struct {
-		Entries []models.SyncEntryRequest `json:"entries" binding:"required"`
+	err = h.entryService.Delete(c.Request.Context(), userID.(uuid.UUID), id, ifVersion)
+	if errors.Is(err, services.ErrStale) {
+		h.respondStale(c, userID.(uuid.UUID), id)
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// Process each entry for sync
-	var syncedEntries []models.Entry
-	var errors []string
-
-	for _, syncEntry := range req.Entries {
-		// First, ensure media exists
-		var mediaID uuid.UUID
+	c.JSON(http.StatusOK, gin.H{"message": "Entry deleted successfully"})
+}
 
-		// Check if media already exists by title and type
-		existingMedia, err := h.mediaService.Search(c.Request.Context(), syncEntry.Media.Title, &syncEntry.Media.Type)
-		if err != nil || len(existingMedia) == 0 {
-			// Create new media
-			media, err := h.mediaService.Create(c.Request.Context(), &syncEntry.Media)
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("Error creating media %s: %v", syncEntry.Media.Title, err))
-				continue
-			}
-			mediaID = media.ID
-		} else {
-			// Use existing media
-			mediaID = existingMedia[0].ID
-		}
+// respondStale answers a conditional write that lost the race with 412 and
+// the current state of the user's entry.
+func (h *EntryHandler) respondStale(c *gin.Context, userID uuid.UUID, id uuid.UUID) {
+	current, err := h.entryService.Get(c.Request.Context(), userID, id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-		// Now create the entry
-		entryReq := models.CreateEntryRequest{
-			MediaID:    mediaID,
-			Status:     syncEntry.Status,
-			Rating:     syncEntry.Rating,
-			ReviewMD:   syncEntry.ReviewMD,
-			Progress:   syncEntry.Progress,
-			StartedAt:  syncEntry.StartedAt,
-			FinishedAt: syncEntry.FinishedAt,
-		}
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Entry was modified by another request", "current": current})
+}
 
-		// Check if entry already exists for this user and media
-		existingEntries, err := h.entryService.ListByUserAndMedia(c.Request.Context(), userID.(uuid.UUID), mediaID)
-		if err != nil {
-			// Log the error but continue processing
-			errors = append(errors, fmt.Sprintf("Error checking existing entries for media %s: %v", syncEntry.Media.Title, err))
-
-			// Try to create new entry
-			entry, createErr := h.entryService.Create(c.Request.Context(), userID.(uuid.UUID), &entryReq)
-			if createErr != nil {
-				errors = append(errors, fmt.Sprintf("Error creating entry for media %s: %v", syncEntry.Media.Title, createErr))
-				continue
-			}
-			syncedEntries = append(syncedEntries, *entry)
-			continue
-		}
+func (h *EntryHandler) Stats(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-		if len(existingEntries) > 0 {
-			// Update existing entry
-			existingEntry := existingEntries[0]
-			entry, err := h.entryService.Update(c.Request.Context(), existingEntry.ID, &entryReq)
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("Error updating entry %s: %v", existingEntry.ID, err))
-				continue
-			}
-			syncedEntries = append(syncedEntries, *entry)
-		} else {
-			// Create new entry
-			entry, err := h.entryService.Create(c.Request.Context(), userID.(uuid.UUID), &entryReq)
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("Error creating entry for media %s: %v", syncEntry.Media.Title, err))
-				continue
-			}
-			syncedEntries = append(syncedEntries, *entry)
-		}
+	stats, err := h.entryService.Stats(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	response := gin.H{
-		"message": "Entries synced successfully",
-		"entries": syncedEntries,
-		"count":   len(syncedEntries),
-	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *EntryHandler) ListRatingTemplates(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-	if len(errors) > 0 {
-		response["errors"] = errors
-		response["message"] = fmt.Sprintf("Synced %d entries with %d errors", len(syncedEntries), len(errors))
+	templates, err := h.entryService.RatingTemplates(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, templates)
 }
 
-// CollectionHandler
-type CollectionHandler struct {
-	collectionService *services.CollectionService
-	shareService      *services.ShareService
-}
+func (h *EntryHandler) PutRatingTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-func NewCollectionHandler(collectionService *services.CollectionService, shareService *services.ShareService) *CollectionHandler {
-	return &CollectionHandler{collectionService: collectionService, shareService: shareService}
+	var req models.RatingTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.entryService.PutRatingTemplate(c.Request.Context(), userID.(uuid.UUID), models.MediaType(c.Param("type")), &req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
 }
 
-func (h *CollectionHandler) List(c *gin.Context) {
+func (h *EntryHandler) ResetRatingTemplate(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	collections, err := h.collectionService.List(c.Request.Context(), userID.(uuid.UUID))
+	template, err := h.entryService.ResetRatingTemplate(c.Request.Context(), userID.(uuid.UUID), models.MediaType(c.Param("type")))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, collections)
+	c.JSON(http.StatusOK, template)
 }
 
-func (h *CollectionHandler) Create(c *gin.Context) {
+func (h *EntryHandler) ListCycles(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	var req models.CreateCollectionRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
-	collection, err := h.collectionService.Create(c.Request.Context(), userID.(uuid.UUID), &req)
+	cycles, err := h.entryService.ListCycles(c.Request.Context(), userID.(uuid.UUID), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, collection)
+	c.JSON(http.StatusOK, cycles)
 }
 
-func (h *CollectionHandler) Get(c *gin.Context) {
+func (h *EntryHandler) CreateCycle(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
-	collection, err := h.collectionService.Get(c.Request.Context(), id)
+	var req models.CycleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.entryService.AddCycle(c.Request.Context(), userID.(uuid.UUID), id, &req)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, collection)
+	c.JSON(http.StatusCreated, entry)
 }
 
-func (h *CollectionHandler) Update(c *gin.Context) {
+func (h *EntryHandler) UpdateCycle(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	idStr := c.Param("id")
 
-	id, err := uuid.Parse(idStr)
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
-	var req models.CreateCollectionRequest
+	cycleID, err := uuid.Parse(c.Param("cycleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle ID"})
+		return
+	}
+
+	var req models.UpdateCycleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	collection, err := h.collectionService.Update(c.Request.Context(), id, userID.(uuid.UUID), &req)
+	entry, err := h.entryService.UpdateCycle(c.Request.Context(), userID.(uuid.UUID), id, cycleID, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, collection)
+	c.JSON(http.StatusOK, entry)
 }
 
-func (h *CollectionHandler) Delete(c *gin.Context) {
+func (h *EntryHandler) DeleteCycle(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	idStr := c.Param("id")
 
-	id, err := uuid.Parse(idStr)
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
-	err = h.collectionService.Delete(c.Request.Context(), id, userID.(uuid.UUID))
+	cycleID, err := uuid.Parse(c.Param("cycleId"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+	entry, err := h.entryService.DeleteCycle(c.Request.Context(), userID.(uuid.UUID), id, cycleID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
 }
 
-func (h *CollectionHandler) CreateShare(c *gin.Context) {
+func (h *EntryHandler) LogSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
 
-	share, err := h.shareService.CreateShareToken(c.Request.Context(), "collection", id)
+	var req models.LogSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := h.entryService.LogSession(c.Request.Context(), userID.(uuid.UUID), id, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"share_url": "/s/" + share.Token})
+	c.JSON(http.StatusCreated, event)
 }
 
-// ShareHandler
-type ShareHandler struct {
-	shareService *services.ShareService
-}
+func (h *EntryHandler) Diary(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-func NewShareHandler(shareService *services.ShareService) *ShareHandler {
-	return &ShareHandler{shareService: shareService}
-}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	query := models.DiaryQuery{
+		From: today.AddDate(0, 0, -30),
+		To:   today,
+	}
 
-func (h *ShareHandler) GetPublicShare(c *gin.Context) {
-	token := c.Param("token")
-	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Token required"})
-		return
+	for key, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		date, err := dateQuery(c, key)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if date != nil {
+			*target = *date
+		}
 	}
 
-	data, err := h.shareService.GetPublicShare(c.Request.Context(), token)
+	if entryIDStr := c.Query("entry_id"); entryIDStr != "" {
+		entryID, err := uuid.Parse(entryIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+			return
+		}
+		query.EntryID = &entryID
+	}
+
+	events, err := h.entryService.Diary(c.Request.Context(), userID.(uuid.UUID), query)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, data)
+	c.JSON(http.StatusOK, events)
 }
 
-// GuestHandler
-type GuestHandler struct {
-	guestService *services.GuestService
-}
+// Bulk applies a batch of operations atomically. The body reports every item;
+// if any failed nothing was applied and the status is 422.
+func (h *EntryHandler) Bulk(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-func NewGuestHandler(guestService *services.GuestService) *GuestHandler {
-	return &GuestHandler{guestService: guestService}
+	var req models.BulkEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.entryService.Bulk(c.Request.Context(), userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !result.Applied {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
 }
 
-func (h *GuestHandler) CreateSnapshot(c *gin.Context) {
-	var req models.GuestSnapshotRequest
+// Sync runs one round of the offline sync protocol: it applies the client's
+// changes and returns the server's changes since the client's cursor.
+func (h *EntryHandler) Sync(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.SyncRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	share, err := h.guestService.CreateSnapshot(c.Request.Context(), &req)
+	resp, err := h.syncService.Sync(c.Request.Context(), userID.(uuid.UUID), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"share_url": "/s/" + share.Token})
+	c.JSON(http.StatusOK, resp)
 }
 
-func (h *GuestHandler) MergeToAccount(c *gin.Context) {
+// Changes returns the page of the entry change feed after the since cursor.
+func (h *EntryHandler) Changes(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	var req models.MergeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	limit, err := intQuery(c, "limit")
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.guestService.MergeToAccount(c.Request.Context(), userID.(uuid.UUID), req.GuestEntries); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	changes, err := h.syncService.Changes(c.Request.Context(), userID.(uuid.UUID), c.Query("since"), limit)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Guest data merged successfully"})
+	c.JSON(http.StatusOK, changes)
+}
+
+// CollectionHandler
+type CollectionHandler struct {
+	collectionService *services.CollectionService
+	shareService      *services.ShareService
+}
+
+func NewCollectionHandler(collectionService *services.CollectionService, shareService *services.ShareService) *CollectionHandler {
+	return &CollectionHandler{collectionService: collectionService, shareService: shareService}
+}
+
+// List returns the user's collections, summarized unless ?include=entries
+// asks for their entries too.
+func (h *CollectionHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var withEntries bool
+	switch c.Query("include") {
+	case "":
+	case "entries":
+		withEntries = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "include must be entries"})
+		return
+	}
+
+	collections, err := h.collectionService.List(c.Request.Context(), userID.(uuid.UUID), withEntries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, collections)
+}
+
+func (h *CollectionHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.CreateCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection, err := h.collectionService.Create(c.Request.Context(), userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusCreated, collection)
+}
+
+func (h *CollectionHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection, err := h.collectionService.Get(c.Request.Context(), id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *CollectionHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	ifVersion, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection, err := h.collectionService.Update(c.Request.Context(), id, userID.(uuid.UUID), &req, ifVersion)
+	if errors.Is(err, services.ErrStale) {
+		h.respondStale(c, id)
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *CollectionHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	ifVersion, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	err = h.collectionService.Delete(c.Request.Context(), id, userID.(uuid.UUID), ifVersion)
+	if errors.Is(err, services.ErrStale) {
+		h.respondStale(c, id)
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+}
+
+// respondStale answers a conditional write that lost the race with 412 and
+// the collection's current state.
+func (h *CollectionHandler) respondStale(c *gin.Context, id uuid.UUID) {
+	userID, _ := c.Get("user_id")
+	current, err := h.collectionService.Get(c.Request.Context(), id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Collection was modified by another request", "current": current})
+}
+
+// AddEntry adds an entry to a collection or moves it within one. The body,
+// which may be omitted, says where to place it.
+func (h *CollectionHandler) AddEntry(c *gin.Context) {
+	var req models.PlaceEntryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	h.changeEntry(c, func(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryID uuid.UUID) (*models.Collection, error) {
+		return h.collectionService.AddEntry(ctx, id, userID, entryID, &req)
+	})
+}
+
+func (h *CollectionHandler) RemoveEntry(c *gin.Context) {
+	h.changeEntry(c, h.collectionService.RemoveEntry)
+}
+
+// SetEntryNote sets the curator's note on an entry of a collection.
+func (h *CollectionHandler) SetEntryNote(c *gin.Context) {
+	var req models.CollectionEntryNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.changeEntry(c, func(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryID uuid.UUID) (*models.Collection, error) {
+		return h.collectionService.SetEntryNote(ctx, id, userID, entryID, &req)
+	})
+}
+
+// changeEntry handles the routes that change a single entry of a collection.
+func (h *CollectionHandler) changeEntry(c *gin.Context,
+	change func(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryID uuid.UUID) (*models.Collection, error)) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+	entryID, err := uuid.Parse(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+		return
+	}
+
+	collection, err := change(c.Request.Context(), id, userID.(uuid.UUID), entryID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *CollectionHandler) ReorderEntries(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	var req models.ReorderCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection, err := h.collectionService.ReorderEntries(c.Request.Context(), id, userID.(uuid.UUID), req.EntryIDs)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusOK, collection)
+}
+
+// Snapshot turns a smart collection into a static one.
+func (h *CollectionHandler) Snapshot(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	collection, err := h.collectionService.Snapshot(c.Request.Context(), id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *CollectionHandler) ListMembers(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	members, err := h.collectionService.ListMembers(c.Request.Context(), id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// AddMember shares a collection with another user, or changes their role.
+func (h *CollectionHandler) AddMember(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	var req models.AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	members, err := h.collectionService.AddMember(c.Request.Context(), id, userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// RemoveMember removes a member from a collection, or lets a member leave it.
+func (h *CollectionHandler) RemoveMember(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+	memberID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.collectionService.RemoveMember(c.Request.Context(), id, userID.(uuid.UUID), memberID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+func (h *CollectionHandler) MemberEvents(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	events, err := h.collectionService.MemberEvents(c.Request.Context(), id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+func (h *CollectionHandler) CreateShare(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	share, err := h.shareService.CreateShareToken(c.Request.Context(), userID.(uuid.UUID), "collection", id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"share_url": "/s/" + share.Token})
+}
+
+// Clone copies the collection shared under a token into the user's account.
+func (h *CollectionHandler) Clone(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	source, err := h.shareService.GetSharedCollection(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	collection, err := h.collectionService.Clone(c.Request.Context(), userID.(uuid.UUID), source)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusCreated, collection)
+}
+
+// TrashHandler
+type TrashHandler struct {
+	trashService *services.TrashService
+}
+
+func NewTrashHandler(trashService *services.TrashService) *TrashHandler {
+	return &TrashHandler{trashService: trashService}
+}
+
+func (h *TrashHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	trash, err := h.trashService.List(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trash)
+}
+
+func (h *TrashHandler) RestoreEntry(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	entry, err := h.trashService.RestoreEntry(c.Request.Context(), userID.(uuid.UUID), id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(entry.Version))
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *TrashHandler) RestoreCollection(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	collection, err := h.trashService.RestoreCollection(c.Request.Context(), userID.(uuid.UUID), id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag(collection.Version))
+	c.JSON(http.StatusOK, collection)
+}
+
+// ShareHandler
+type ShareHandler struct {
+	shareService *services.ShareService
+}
+
+func NewShareHandler(shareService *services.ShareService) *ShareHandler {
+	return &ShareHandler{shareService: shareService}
+}
+
+func (h *ShareHandler) GetPublicShare(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token required"})
+		return
+	}
+
+	data, err := h.shareService.GetPublicShare(c.Request.Context(), token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// GuestHandler
+type GuestHandler struct {
+	guestService *services.GuestService
+}
+
+func NewGuestHandler(guestService *services.GuestService) *GuestHandler {
+	return &GuestHandler{guestService: guestService}
+}
+
+func (h *GuestHandler) CreateSnapshot(c *gin.Context) {
+	var req models.GuestSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	share, err := h.guestService.CreateSnapshot(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"share_url": "/s/" + share.Token})
+}
+
+func (h *GuestHandler) MergeToAccount(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.MergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.guestService.MergeToAccount(c.Request.Context(), userID.(uuid.UUID), req.GuestEntries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Guest data merged successfully"})
+}
+
+// EventHandler streams live change events to clients.
+type EventHandler struct {
+	eventBus *services.EventBus
+}
+
+func NewEventHandler(eventBus *services.EventBus) *EventHandler {
+	return &EventHandler{eventBus: eventBus}
+}
+
+// eventHeartbeat is how often an idle stream sends a comment, which keeps
+// proxies from closing it.
+const eventHeartbeat = 25 * time.Second
+
+// Stream sends the user's change events as Server-Sent Events until the client
+// disconnects. Each event is named after its type and carries the ChangeEvent
+// as data. The stream starts with a "ready" event; when it ends the client
+// should reconnect and catch up from the change feed.
+func (h *EventHandler) Stream(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	ctx := c.Request.Context()
+	events, unsubscribe, err := h.eventBus.Subscribe(ctx, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Live updates are unavailable"})
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{"at": time.Now()})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(string(event.Type), event)
+			return true
+		}
+	})
+}
+
+// etag formats a resource version as a strong ETag.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// requireIfMatch reads the version a write is conditional on from If-Match.
+// "*" matches any version and yields nil. A missing header is answered with
+// 428 and ok is false. Only the first tag of a list is used.
+func requireIfMatch(c *gin.Context) (version *int, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header required; send the ETag of the version being changed"})
+		return nil, false
+	}
+	if header == "*" {
+		return nil, true
+	}
+
+	tag := strings.TrimSpace(strings.Split(header, ",")[0])
+	v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(tag, "W/"), `"`))
+	if err != nil {
+		// An ETag we never issued matches no version.
+		v = -1
+	}
+	return &v, true
+}
+
+// errorStatus maps service errors to HTTP status codes; anything unrecognized is a 500.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrStale):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func intQuery(c *gin.Context, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+	return n, nil
+}
+
+func floatQuery(c *gin.Context, key string) (*float64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	return &f, nil
+}
+
+func dateQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", key)
+	}
+	return &t, nil
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseEntryListQuery(t *testing.T) {
+	completed := models.StatusCompleted
+	book := models.MediaTypeBook
+	private := models.VisibilityPrivate
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	genre := "sci-fi"
+	year := 1999
+	rating := 7.5
+	hasReview := true
+	cursor := &models.EntryCursor{Sort: models.EntrySortTitle, Key: "dune"}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    *models.EntryListQuery
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  &models.EntryListQuery{Sort: models.EntrySortUpdated, Descending: true},
+		},
+		{
+			name:  "title sorts ascending by default",
+			query: "sort=title",
+			want:  &models.EntryListQuery{Sort: models.EntrySortTitle},
+		},
+		{
+			name:  "explicit order",
+			query: "sort=title&order=desc",
+			want:  &models.EntryListQuery{Sort: models.EntrySortTitle, Descending: true},
+		},
+		{
+			name: "every filter",
+			query: "status=completed&type=book&genre=sci-fi&tag=cozy&tag=rainy&limit=20&rating_min=7.5&year=1999" +
+				"&finished_from=2025-01-01&has_review=true&visibility=private&q=+dune+&order=asc",
+			want: &models.EntryListQuery{
+				Status: &completed, Type: &book, Genre: &genre, Tags: []string{"cozy", "rainy"}, Limit: 20,
+				RatingMin: &rating, Year: &year, FinishedFrom: &from, HasReview: &hasReview, Visibility: &private,
+				Search: "dune", Sort: models.EntrySortUpdated,
+			},
+		},
+		{
+			name:  "cursor",
+			query: "sort=title&cursor=" + cursor.Encode(),
+			want:  &models.EntryListQuery{Sort: models.EntrySortTitle, Cursor: cursor},
+		},
+		{name: "unknown order", query: "order=up", wantErr: true},
+		{name: "limit not a number", query: "limit=ten", wantErr: true},
+		{name: "rating not a number", query: "rating_max=high", wantErr: true},
+		{name: "bad date", query: "finished_to=01/02/2025", wantErr: true},
+		{name: "has_review not a bool", query: "has_review=maybe", wantErr: true},
+		{name: "unknown visibility", query: "visibility=friends", wantErr: true},
+		{name: "malformed cursor", query: "cursor=%21%21", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &gin.Context{Request: httptest.NewRequest("GET", "/api/entries?"+tt.query, nil)}
+			got, err := parseEntryListQuery(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseEntryListQuery(%q) succeeded, want an error", tt.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEntryListQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
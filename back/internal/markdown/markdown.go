@@ -0,0 +1,58 @@
+// Package markdown renders user-written markdown (entry reviews) to HTML that
+// is safe to embed in any page.
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.Strikethrough, extension.Table, extension.Linkify, Spoilers),
+		// Raw HTML in the source is dropped rather than passed through.
+		goldmark.WithRendererOptions(html.WithHardWraps()),
+	)
+
+	policy = newPolicy()
+)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("details")
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// Render converts markdown to sanitized HTML. Besides CommonMark it supports
+// strikethrough, tables, bare links and spoiler blocks:
+//
+//	:::spoiler Ending
+//	Hidden until the reader opens it.
+//	:::
+//
+// which render as a closed <details class="spoiler"> element.
+func Render(source string) string {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		// Rendering into a buffer only fails on malformed input the parser
+		// could not recover from; show the text rather than nothing.
+		return "<p>" + string(util.EscapeHTML([]byte(source))) + "</p>"
+	}
+	return policy.Sanitize(buf.String())
+}
+
+// RenderPtr renders a markdown field that may be unset.
+func RenderPtr(source *string) *string {
+	if source == nil || *source == "" {
+		return nil
+	}
+	rendered := Render(*source)
+	return &rendered
+}
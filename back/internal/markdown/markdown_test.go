@@ -0,0 +1,116 @@
+package markdown
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "formatting and bare links",
+			source: "**bold** ~~gone~~ https://example.com",
+			want: `<p><strong>bold</strong> <del>gone</del> ` +
+				`<a href="https://example.com" rel="nofollow noopener" target="_blank">https://example.com</a></p>` + "\n",
+		},
+		{
+			name:   "script block",
+			source: "<script>alert(1)</script>",
+			want:   "\n",
+		},
+		{
+			name:   "inline script",
+			source: "hi <script>alert(1)</script> there",
+			want:   "<p>hi alert(1) there</p>\n",
+		},
+		{
+			name:   "javascript link",
+			source: "[x](javascript:alert(1))",
+			want:   "<p>x</p>\n",
+		},
+		{
+			name:   "mixed-case javascript link",
+			source: "[x](JaVaScRiPt:alert(1))",
+			want:   "<p>x</p>\n",
+		},
+		{
+			name:   "data link",
+			source: "[x](data:text/html;base64,PHNjcmlwdD4=)",
+			want:   "<p>x</p>\n",
+		},
+		{
+			name:   "data image",
+			source: "![x](data:image/svg+xml;base64,PHN2Zz4=)",
+			want:   `<p><img alt="x"></p>` + "\n",
+		},
+		{
+			name:   "event handler on a link",
+			source: `<a href="https://example.com" onclick="alert(1)">x</a>`,
+			want:   "<p>x</p>\n",
+		},
+		{
+			name:   "event handler on an image",
+			source: "<img src=x onerror=alert(1)>",
+			want:   "\n",
+		},
+		{
+			name:   "event handler smuggled in an image title",
+			source: `![x](https://example.com/a.png "t\" onerror=\"alert(1)")`,
+			want:   `<p><img src="https://example.com/a.png" alt="x"></p>` + "\n",
+		},
+		{
+			name:   "raw details cannot pose as a spoiler",
+			source: `<details class="spoiler" open onclick="alert(1)">y</details>`,
+			want:   "\n",
+		},
+		{
+			name:   "spoiler",
+			source: ":::spoiler Ending\nThey **win**.\n:::",
+			want:   `<details class="spoiler"><summary>Ending</summary>` + "\n<p>They <strong>win</strong>.</p>\n</details>\n",
+		},
+		{
+			name:   "spoiler without a summary",
+			source: ":::spoiler\nhidden\n:::",
+			want:   `<details class="spoiler"><summary>Spoiler</summary>` + "\n<p>hidden</p>\n</details>\n",
+		},
+		{
+			name:   "HTML in a spoiler summary",
+			source: ":::spoiler <img src=x onerror=alert(1)>\nhidden\n:::",
+			want:   `<details class="spoiler"><summary>&lt;img src=x onerror=alert(1)&gt;</summary>` + "\n<p>hidden</p>\n</details>\n",
+		},
+		{
+			name:   "script in a spoiler summary",
+			source: ":::spoiler <script>alert(1)</script>\nhidden\n:::",
+			want:   `<details class="spoiler"><summary>&lt;script&gt;alert(1)&lt;/script&gt;</summary>` + "\n<p>hidden</p>\n</details>\n",
+		},
+		{
+			name:   "HTML inside a spoiler",
+			source: ":::spoiler\n<b onclick=\"alert(1)\">x</b> [y](javascript:alert(1))\n:::",
+			want:   `<details class="spoiler"><summary>Spoiler</summary>` + "\n<p>x y</p>\n</details>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.source); got != tt.want {
+				t.Errorf("Render(%q) =\n%q\nwant\n%q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPtr(t *testing.T) {
+	empty := ""
+	if got := RenderPtr(nil); got != nil {
+		t.Errorf("RenderPtr(nil) = %q, want nil", *got)
+	}
+	if got := RenderPtr(&empty); got != nil {
+		t.Errorf(`RenderPtr("") = %q, want nil`, *got)
+	}
+
+	source := "*hi*"
+	if got := RenderPtr(&source); got == nil || *got != "<p><em>hi</em></p>\n" {
+		t.Errorf("RenderPtr(%q) = %v, want <p><em>hi</em></p>", source, got)
+	}
+}
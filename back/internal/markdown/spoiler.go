@@ -0,0 +1,130 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const defaultSpoilerSummary = "Spoiler"
+
+var spoilerOpener = []byte("spoiler")
+
+// KindSpoiler is the node kind of spoiler blocks.
+var KindSpoiler = ast.NewNodeKind("Spoiler")
+
+// SpoilerBlock is a block of markdown hidden behind a summary line.
+type SpoilerBlock struct {
+	ast.BaseBlock
+	Summary []byte
+}
+
+func (n *SpoilerBlock) Kind() ast.NodeKind {
+	return KindSpoiler
+}
+
+func (n *SpoilerBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Summary": string(n.Summary)}, nil)
+}
+
+// spoilerParser parses blocks fenced by a ":::spoiler [summary]" line and a
+// ":::" line. The content in between is parsed as markdown; an unclosed block
+// runs to the end of its parent.
+type spoilerParser struct{}
+
+func (p *spoilerParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p *spoilerParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	w, pos := util.IndentWidth(line, reader.LineOffset())
+	if w > 3 {
+		return nil, parser.NoChildren
+	}
+	rest := line[pos:]
+	if !bytes.HasPrefix(rest, []byte(":::")) {
+		return nil, parser.NoChildren
+	}
+	rest = bytes.TrimLeft(rest[3:], " \t")
+	if !bytes.HasPrefix(rest, spoilerOpener) {
+		return nil, parser.NoChildren
+	}
+	rest = rest[len(spoilerOpener):]
+	if len(rest) > 0 && !util.IsSpace(rest[0]) {
+		return nil, parser.NoChildren
+	}
+
+	node := &SpoilerBlock{Summary: bytes.TrimSpace(rest)}
+	reader.Advance(segment.Len() - trailingNewline(line))
+	return node, parser.HasChildren
+}
+
+func (p *spoilerParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	w, pos := util.IndentWidth(line, reader.LineOffset())
+	if w <= 3 && pos < len(line) && bytes.Equal(bytes.TrimSpace(line[pos:]), []byte(":::")) {
+		reader.Advance(segment.Len() - trailingNewline(line))
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (p *spoilerParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *spoilerParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *spoilerParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func trailingNewline(line []byte) int {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		return 1
+	}
+	return 0
+}
+
+// spoilerRenderer renders spoiler blocks as closed <details> elements.
+type spoilerRenderer struct{}
+
+func (r *spoilerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindSpoiler, r.renderSpoiler)
+}
+
+func (r *spoilerRenderer) renderSpoiler(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, _ = w.WriteString("</details>\n")
+		return ast.WalkContinue, nil
+	}
+
+	summary := n.(*SpoilerBlock).Summary
+	if len(summary) == 0 {
+		summary = []byte(defaultSpoilerSummary)
+	}
+	_, _ = w.WriteString(`<details class="spoiler"><summary>`)
+	_, _ = w.Write(util.EscapeHTML(summary))
+	_, _ = w.WriteString("</summary>\n")
+	return ast.WalkContinue, nil
+}
+
+type spoilers struct{}
+
+// Spoilers is the goldmark extension for spoiler blocks.
+var Spoilers goldmark.Extender = &spoilers{}
+
+func (e *spoilers) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(
+		util.Prioritized(&spoilerParser{}, 90),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&spoilerRenderer{}, 500),
+	))
+}
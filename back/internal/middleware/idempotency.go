@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyLockExpiration = time.Minute
+	idempotencyLockRenewal    = idempotencyLockExpiration / 3
+)
+
+// idempotentResponse is what is stored in Redis under an idempotency key.
+// Status is 0 while the first request with the key is still running.
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Idempotency makes mutating requests that carry an Idempotency-Key header
+// safe to retry. The first response for a key is stored in Redis for ttl and
+// replayed for later requests with the same key instead of running the handler
+// again. Keys are scoped to the caller's Authorization header; reusing a key
+// for a different request is rejected with 422, and a retry that arrives while
+// the first request is still running gets 409. Server errors are not stored,
+// so a request that failed with a 5xx can be retried with the same key.
+func Idempotency(client *redis.Client, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		redisKey := "idempotency:" + hash(c.GetHeader("Authorization")) + ":" + key
+		fingerprint := hash(c.Request.Method, c.Request.URL.RequestURI(), c.GetHeader("If-Match"), string(body))
+
+		pending, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+		acquired, err := client.SetNX(ctx, redisKey, pending, idempotencyLockExpiration).Result()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Idempotency store unavailable"})
+			return
+		}
+
+		if !acquired {
+			replay(c, client, redisKey, fingerprint)
+			return
+		}
+
+		stopRenewal := renewLock(client, redisKey)
+		defer stopRenewal()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		stopRenewal()
+
+		// Use a fresh context: the request's may already be cancelled.
+		storeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			client.Del(storeCtx, redisKey)
+			return
+		}
+		stored, _ := json.Marshal(idempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      recorder.Header().Clone(),
+			Body:        recorder.body.Bytes(),
+		})
+		client.Set(storeCtx, redisKey, stored, ttl)
+	}
+}
+
+// renewLock keeps the pending marker under redisKey from expiring for as long
+// as the first request runs, so a slow request is not run again by a retry.
+// The lock itself only expires if the server dies mid-request. The returned
+// func stops the renewal and waits for it, so no renewal overwrites the TTL of
+// the stored response; it may be called more than once.
+func renewLock(client *redis.Client, redisKey string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyLockRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), idempotencyLockRenewal)
+				client.Expire(ctx, redisKey, idempotencyLockExpiration)
+				cancel()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// replay answers a request whose key has been seen before.
+func replay(c *gin.Context, client *redis.Client, redisKey, fingerprint string) {
+	raw, err := client.Get(c.Request.Context(), redisKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The first request failed and released the key in the meantime.
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "The first request with this Idempotency-Key failed, try again"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Idempotency store unavailable"})
+		return
+	}
+
+	var cached idempotentResponse
+	if err := json.Unmarshal(raw, &cached); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Invalid stored response"})
+		return
+	}
+	if cached.Fingerprint != fingerprint {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if cached.Status == 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		return
+	}
+
+	for name, values := range cached.Header {
+		c.Writer.Header()[name] = values
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Writer.WriteHeader(cached.Status)
+	c.Writer.Write(cached.Body)
+	c.Abort()
+}
+
+// responseRecorder copies the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,9 +1,12 @@
 package models
 
 import (
+	"bytes"
 	"database/sql/driver"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +23,18 @@ const (
 	MediaTypeMovie MediaType = "movie"
 )
 
+// MediaTypes lists every media type.
+var MediaTypes = []MediaType{MediaTypeVideo, MediaTypeBook, MediaTypeAnime, MediaTypeGame, MediaTypeTV, MediaTypeMovie}
+
+// Valid reports whether t is one of the known media types.
+func (t MediaType) Valid() bool {
+	switch t {
+	case MediaTypeVideo, MediaTypeBook, MediaTypeAnime, MediaTypeGame, MediaTypeTV, MediaTypeMovie:
+		return true
+	}
+	return false
+}
+
 type Status string
 
 const (
@@ -30,6 +45,178 @@ const (
 	StatusDropped    Status = "dropped"
 )
 
+// Valid reports whether s is one of the known entry statuses.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusPlanned, StatusInProgress, StatusCompleted, StatusOnHold, StatusDropped:
+		return true
+	}
+	return false
+}
+
+// Visibility says who besides its owner may see an entry.
+type Visibility string
+
+const (
+	VisibilityPublic    Visibility = "public"
+	VisibilityFollowers Visibility = "followers"
+	VisibilityPrivate   Visibility = "private"
+)
+
+// Valid reports whether v is one of the known visibilities.
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityFollowers, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// RatingScale is the scale a user enters and reads ratings in. Ratings are
+// stored on the canonical 0-10 scale; see Display for the conversion.
+type RatingScale string
+
+const (
+	RatingScaleTen         RatingScale = "ten"
+	RatingScaleFiveStar    RatingScale = "five_star"
+	RatingScaleHundred     RatingScale = "hundred"
+	RatingScaleLikeDislike RatingScale = "like_dislike"
+)
+
+// LikeThreshold is the canonical rating from which a rating reads as a like.
+const LikeThreshold = 6
+
+// Valid reports whether s is one of the known rating scales.
+func (s RatingScale) Valid() bool {
+	switch s {
+	case RatingScaleTen, RatingScaleFiveStar, RatingScaleHundred, RatingScaleLikeDislike:
+		return true
+	}
+	return false
+}
+
+// Max is the highest rating on the scale; every scale starts at 0.
+func (s RatingScale) Max() float64 {
+	switch s {
+	case RatingScaleFiveStar:
+		return 5
+	case RatingScaleHundred:
+		return 100
+	case RatingScaleLikeDislike:
+		return 1
+	}
+	return 10
+}
+
+// Display converts a canonical 0-10 rating to the scale: halved for five
+// stars, times ten for a hundred points, and 1 (like) from LikeThreshold up
+// or 0 (dislike) below it.
+func (s RatingScale) Display(canonical float64) float64 {
+	switch s {
+	case RatingScaleFiveStar:
+		return canonical / 2
+	case RatingScaleHundred:
+		return math.Round(canonical * 10)
+	case RatingScaleLikeDislike:
+		if canonical >= LikeThreshold {
+			return 1
+		}
+		return 0
+	}
+	return canonical
+}
+
+// RatingMode says where an entry's overall rating comes from: set by hand, or
+// the weighted average of its sub-ratings.
+type RatingMode string
+
+const (
+	RatingModeManual   RatingMode = "manual"
+	RatingModeWeighted RatingMode = "weighted"
+)
+
+// Valid reports whether m is one of the known rating modes.
+func (m RatingMode) Valid() bool {
+	return m == RatingModeManual || m == RatingModeWeighted
+}
+
+// RatingCriterion is one named sub-rating of a rating template. Weight is its
+// share of a weighted overall rating.
+type RatingCriterion struct {
+	Key    string  `json:"key"`
+	Label  string  `json:"label"`
+	Weight float64 `json:"weight"`
+}
+
+// RatingCriteria is stored as JSONB.
+type RatingCriteria []RatingCriterion
+
+func (c RatingCriteria) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *RatingCriteria) Scan(value interface{}) error {
+	return scanJSON(value, c)
+}
+
+// Find returns the criterion with key, if there is one.
+func (c RatingCriteria) Find(key string) (RatingCriterion, bool) {
+	for _, criterion := range c {
+		if criterion.Key == key {
+			return criterion, true
+		}
+	}
+	return RatingCriterion{}, false
+}
+
+// RatingTemplate lists the sub-ratings entries of one media type are rated on.
+// Custom is false for the built-in defaults of users who never set their own.
+type RatingTemplate struct {
+	MediaType MediaType      `json:"media_type" db:"media_type"`
+	Criteria  RatingCriteria `json:"criteria" db:"criteria"`
+	Custom    bool           `json:"custom"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// defaultRatingCriteria are the built-in templates. Media types without one
+// have no sub-ratings until the user defines them.
+var defaultRatingCriteria = map[MediaType]RatingCriteria{
+	MediaTypeGame: {
+		{Key: "story", Label: "Story", Weight: 1},
+		{Key: "gameplay", Label: "Gameplay", Weight: 1},
+		{Key: "visuals", Label: "Visuals", Weight: 1},
+	},
+	MediaTypeBook: {
+		{Key: "prose", Label: "Prose", Weight: 1},
+		{Key: "plot", Label: "Plot", Weight: 1},
+	},
+}
+
+// DefaultRatingTemplate returns the built-in template of a media type.
+func DefaultRatingTemplate(mediaType MediaType) *RatingTemplate {
+	criteria := RatingCriteria{}
+	criteria = append(criteria, defaultRatingCriteria[mediaType]...)
+	return &RatingTemplate{MediaType: mediaType, Criteria: criteria}
+}
+
+// SubRatings maps rating criteria keys to canonical ratings. It is stored as JSONB.
+type SubRatings map[string]float64
+
+func (r SubRatings) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return json.Marshal(r)
+}
+
+func (r *SubRatings) Scan(value interface{}) error {
+	if value == nil {
+		*r = nil
+		return nil
+	}
+	return scanJSON(value, r)
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	Email     string    `json:"email" db:"email"`
@@ -37,6 +224,30 @@ type User struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// UserSettings holds per-user preferences. The Auto* flags control the status
+// transition rules EntryService applies on every write.
+type UserSettings struct {
+	UserID                 uuid.UUID   `json:"user_id" db:"user_id"`
+	AutoStartDate          bool        `json:"auto_start_date" db:"auto_start_date"`
+	AutoFinishDate         bool        `json:"auto_finish_date" db:"auto_finish_date"`
+	AutoFillProgress       bool        `json:"auto_fill_progress" db:"auto_fill_progress"`
+	AutoCompleteOnProgress bool        `json:"auto_complete_on_progress" db:"auto_complete_on_progress"`
+	RatingScale            RatingScale `json:"rating_scale" db:"rating_scale"`
+	UpdatedAt              time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// DefaultUserSettings are used for users who never changed their settings.
+func DefaultUserSettings(userID uuid.UUID) *UserSettings {
+	return &UserSettings{
+		UserID:                 userID,
+		AutoStartDate:          true,
+		AutoFinishDate:         true,
+		AutoFillProgress:       true,
+		AutoCompleteOnProgress: true,
+		RatingScale:            RatingScaleTen,
+	}
+}
+
 type MediaItem struct {
 	ID            uuid.UUID `json:"id" db:"id"`
 	Type          MediaType `json:"type" db:"type"`
@@ -49,29 +260,306 @@ type MediaItem struct {
 	Duration      *int      `json:"duration,omitempty" db:"duration"`
 	Metadata      JSONB     `json:"metadata,omitempty" db:"metadata"`
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	// ExternalIDs maps a catalogue (tmdb, anilist, igdb, isbn, ...) to the
+	// item's ID in it. Only set on newly created items and sync candidates.
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
 }
 
+// Entry is a user's record of one media item. Rating and SubRatings are on the
+// canonical 0-10 scale; the Display fields hold them on the owner's
+// RatingScale, the scale ratings are written in. In RatingModeWeighted Rating
+// is computed from SubRatings. ReviewHTML is ReviewMD rendered to sanitized
+// HTML. PrivateNotes are only ever returned to the entry's owner. Rank and
+// Tier are only set on the entries of a ranked or tiered collection, and
+// CuratorNote on entries listed in a collection.
 type Entry struct {
-	ID         uuid.UUID  `json:"id" db:"id"`
-	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
-	MediaID    uuid.UUID  `json:"media_id" db:"media_id"`
-	Status     Status     `json:"status" db:"status"`
-	Rating     *float64   `json:"rating,omitempty" db:"rating"`
-	ReviewMD   *string    `json:"review_md,omitempty" db:"review_md"`
-	Progress   JSONB      `json:"progress,omitempty" db:"progress"`
-	StartedAt  *time.Time `json:"started_at,omitempty" db:"started_at"`
-	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
-	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
-	Media      *MediaItem `json:"media,omitempty"`
+	ID             uuid.UUID    `json:"id" db:"id"`
+	UserID         uuid.UUID    `json:"user_id" db:"user_id"`
+	MediaID        uuid.UUID    `json:"media_id" db:"media_id"`
+	Status         Status       `json:"status" db:"status"`
+	Rating         *float64     `json:"rating,omitempty" db:"rating"`
+	DisplayRating  *float64     `json:"display_rating,omitempty"`
+	RatingScale    RatingScale  `json:"rating_scale,omitempty"`
+	RatingMode     RatingMode   `json:"rating_mode,omitempty" db:"rating_mode"`
+	SubRatings     SubRatings   `json:"sub_ratings,omitempty" db:"sub_ratings"`
+	DisplaySub     SubRatings   `json:"display_sub_ratings,omitempty"`
+	ReviewMD       *string      `json:"review_md,omitempty" db:"review_md"`
+	ReviewHTML     *string      `json:"review_html,omitempty"`
+	PrivateNotes   *string      `json:"private_notes,omitempty" db:"private_notes"`
+	Visibility     Visibility   `json:"visibility" db:"visibility"`
+	Progress       JSONB        `json:"progress,omitempty" db:"progress"`
+	Completion     *float64     `json:"completion,omitempty" db:"completion"`
+	StartedAt      *time.Time   `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt     *time.Time   `json:"finished_at,omitempty" db:"finished_at"`
+	UpdatedAt      time.Time    `json:"updated_at" db:"updated_at"`
+	Version        int          `json:"version" db:"version"`
+	TimesCompleted int          `json:"times_completed" db:"times_completed"`
+	Tags           []string     `json:"tags"`
+	DeletedAt      *time.Time   `json:"deleted_at,omitempty" db:"deleted_at"`
+	ChangeSeq      int64        `json:"-" db:"change_seq"`
+	Media          *MediaItem   `json:"media,omitempty"`
+	Cycles         []EntryCycle `json:"cycles,omitempty"`
+	Rank           *int         `json:"rank,omitempty"`
+	Tier           *string      `json:"tier,omitempty"`
+	CuratorNote    *string      `json:"curator_note,omitempty"`
 }
 
+// EntryCycle is one pass through a media item (a watch, read or playthrough).
+// The entry's started/finished dates always mirror its latest cycle.
+type EntryCycle struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	EntryID       uuid.UUID  `json:"entry_id" db:"entry_id"`
+	Number        int        `json:"number" db:"number"`
+	Completed     bool       `json:"completed" db:"completed"`
+	StartedAt     *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	Rating        *float64   `json:"rating,omitempty" db:"rating"`
+	DisplayRating *float64   `json:"display_rating,omitempty"`
+	Notes         *string    `json:"notes,omitempty" db:"notes"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// SetRatingScale sets the display ratings of the entry, its sub-ratings and its
+// cycles on scale.
+func (e *Entry) SetRatingScale(scale RatingScale) {
+	e.RatingScale = scale
+	e.DisplayRating = displayRating(scale, e.Rating)
+	e.DisplaySub = nil
+	if e.SubRatings != nil {
+		e.DisplaySub = make(SubRatings, len(e.SubRatings))
+		for key, rating := range e.SubRatings {
+			e.DisplaySub[key] = scale.Display(rating)
+		}
+	}
+	for i := range e.Cycles {
+		e.Cycles[i].DisplayRating = displayRating(scale, e.Cycles[i].Rating)
+	}
+}
+
+func displayRating(scale RatingScale, canonical *float64) *float64 {
+	if canonical == nil {
+		return nil
+	}
+	display := scale.Display(*canonical)
+	return &display
+}
+
+// Typed progress models. Entry.Progress is stored as JSONB and must match the
+// shape for the media type: books, episodes (tv, anime), games and video (video, movie).
+type BookProgress struct {
+	Pages         *int `json:"pages,omitempty"`
+	TotalPages    *int `json:"total_pages,omitempty"`
+	Chapters      *int `json:"chapters,omitempty"`
+	TotalChapters *int `json:"total_chapters,omitempty"`
+}
+
+type EpisodeProgress struct {
+	Season        *int `json:"season,omitempty"`
+	Episode       *int `json:"episode,omitempty"`
+	Episodes      *int `json:"episodes,omitempty"`
+	TotalEpisodes *int `json:"total_episodes,omitempty"`
+	TotalSeasons  *int `json:"total_seasons,omitempty"`
+}
+
+type GameProgress struct {
+	Hours             *float64 `json:"hours,omitempty"`
+	Percent           *float64 `json:"percent,omitempty"`
+	Achievements      *int     `json:"achievements,omitempty"`
+	TotalAchievements *int     `json:"total_achievements,omitempty"`
+}
+
+type VideoProgress struct {
+	Minutes      *int `json:"minutes,omitempty"`
+	TotalMinutes *int `json:"total_minutes,omitempty"`
+}
+
+// CollectionMode says how a collection orders its entries.
+type CollectionMode string
+
+const (
+	CollectionModeUnordered CollectionMode = "unordered"
+	CollectionModeRanked    CollectionMode = "ranked"
+	CollectionModeTiered    CollectionMode = "tiered"
+)
+
+// Valid reports whether m is one of the known collection modes.
+func (m CollectionMode) Valid() bool {
+	switch m {
+	case CollectionModeUnordered, CollectionModeRanked, CollectionModeTiered:
+		return true
+	}
+	return false
+}
+
+// DefaultTiers are the tiers of a tiered collection that names none.
+var DefaultTiers = []string{"S", "A", "B", "C", "D"}
+
+// Collection is a user's list of entries. Ranked collections number their
+// entries (Entry.Rank); tiered ones group them into Tiers, best first
+// (Entry.Tier), and rank them within each tier. A smart collection has Rules
+// instead of a list of its own: its entries are whichever match them. Role is
+// what the user it was loaded for may do with it. DescriptionHTML is
+// DescriptionMD rendered to sanitized HTML; collections without a CoverURL get
+// a CoverMosaic of the covers of their first entries instead. Source is set on
+// collections cloned from a share. EntryCount is the number of entries the user
+// may see, also set on collections listed without their Entries.
 type Collection struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	UserID    uuid.UUID `json:"user_id" db:"user_id"`
-	Title     string    `json:"title" db:"title"`
-	IsPublic  bool      `json:"is_public" db:"is_public"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	Entries   []Entry   `json:"entries,omitempty"`
+	ID              uuid.UUID         `json:"id" db:"id"`
+	UserID          uuid.UUID         `json:"user_id" db:"user_id"`
+	Title           string            `json:"title" db:"title"`
+	IsPublic        bool              `json:"is_public" db:"is_public"`
+	Mode            CollectionMode    `json:"mode" db:"mode"`
+	Tiers           []string          `json:"tiers,omitempty" db:"tiers"`
+	Rules           *CollectionRules  `json:"rules,omitempty" db:"rules"`
+	Role            CollectionRole    `json:"role,omitempty"`
+	DescriptionMD   *string           `json:"description_md,omitempty" db:"description_md"`
+	DescriptionHTML *string           `json:"description_html,omitempty"`
+	CoverURL        *string           `json:"cover_url,omitempty" db:"cover_url"`
+	CoverMosaic     []string          `json:"cover_mosaic,omitempty"`
+	Source          *CollectionSource `json:"source,omitempty"`
+	EntryCount      int               `json:"entry_count"`
+	CreatedAt       time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at" db:"updated_at"`
+	Version         int               `json:"version" db:"version"`
+	DeletedAt       *time.Time        `json:"deleted_at,omitempty" db:"deleted_at"`
+	Entries         []Entry           `json:"entries,omitempty"`
+}
+
+// CollectionSource credits the collection a clone was made from. Title and
+// OwnerName are as they were when it was cloned; CollectionID is unset once the
+// source is deleted.
+type CollectionSource struct {
+	CollectionID *uuid.UUID `json:"collection_id,omitempty"`
+	Title        string     `json:"title"`
+	OwnerName    string     `json:"owner_name"`
+}
+
+// CollectionRole is what a user may do with a collection. Its owner is the
+// collection's UserID; editors and viewers are members it is shared with.
+type CollectionRole string
+
+const (
+	CollectionRoleOwner  CollectionRole = "owner"
+	CollectionRoleEditor CollectionRole = "editor"
+	CollectionRoleViewer CollectionRole = "viewer"
+)
+
+// Valid reports whether r is a role a member can be given.
+func (r CollectionRole) Valid() bool {
+	return r == CollectionRoleEditor || r == CollectionRoleViewer
+}
+
+var collectionRoleRanks = map[CollectionRole]int{CollectionRoleViewer: 1, CollectionRoleEditor: 2, CollectionRoleOwner: 3}
+
+// Includes reports whether r allows everything other does: owners may do what
+// editors may, and editors what viewers may.
+func (r CollectionRole) Includes(other CollectionRole) bool {
+	return collectionRoleRanks[r] > 0 && collectionRoleRanks[r] >= collectionRoleRanks[other]
+}
+
+// CollectionMember is a user a collection is shared with, or its owner.
+type CollectionMember struct {
+	UserID  uuid.UUID      `json:"user_id" db:"user_id"`
+	Name    string         `json:"name" db:"name"`
+	Email   string         `json:"email" db:"email"`
+	Role    CollectionRole `json:"role" db:"role"`
+	AddedAt time.Time      `json:"added_at" db:"created_at"`
+}
+
+// MemberAction is a kind of membership change.
+type MemberAction string
+
+const (
+	MemberActionAdded       MemberAction = "added"
+	MemberActionRoleChanged MemberAction = "role_changed"
+	MemberActionRemoved     MemberAction = "removed"
+	MemberActionLeft        MemberAction = "left"
+)
+
+// CollectionMemberEvent records a membership change: ActorID added UserID
+// with Role, changed their role to Role, or removed them; UserID left on their
+// own. The names are empty once the user is deleted.
+type CollectionMemberEvent struct {
+	ID           int64           `json:"id" db:"id"`
+	CollectionID uuid.UUID       `json:"collection_id" db:"collection_id"`
+	ActorID      *uuid.UUID      `json:"actor_id,omitempty" db:"actor_id"`
+	ActorName    string          `json:"actor_name,omitempty"`
+	UserID       *uuid.UUID      `json:"user_id,omitempty" db:"user_id"`
+	UserName     string          `json:"user_name,omitempty"`
+	Action       MemberAction    `json:"action" db:"action"`
+	Role         *CollectionRole `json:"role,omitempty" db:"role"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+}
+
+// CollectionRules is the saved filter of a smart collection. The fields filter
+// like the GET /api/entries parameters of the same names, except that an entry
+// must have every one of Tags. RatingMin and RatingMax are stored on the
+// canonical scale and shown on the owner's; dates are YYYY-MM-DD.
+type CollectionRules struct {
+	Status       *Status     `json:"status,omitempty"`
+	Type         *MediaType  `json:"type,omitempty"`
+	RatingMin    *float64    `json:"rating_min,omitempty"`
+	RatingMax    *float64    `json:"rating_max,omitempty"`
+	Genre        *string     `json:"genre,omitempty"`
+	Tags         []string    `json:"tags,omitempty"`
+	Year         *int        `json:"year,omitempty"`
+	FinishedFrom *string     `json:"finished_from,omitempty"`
+	FinishedTo   *string     `json:"finished_to,omitempty"`
+	HasReview    *bool       `json:"has_review,omitempty"`
+	Visibility   *Visibility `json:"visibility,omitempty"`
+	Search       string      `json:"q,omitempty"`
+	Sort         EntrySort   `json:"sort,omitempty"`
+	Order        string      `json:"order,omitempty"`
+	Limit        int         `json:"limit,omitempty"`
+}
+
+func (r CollectionRules) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *CollectionRules) Scan(value interface{}) error {
+	return scanJSON(value, r)
+}
+
+// CollectionSlot is where an entry sits in a collection: entries are kept in
+// slot order, and a tiered collection's slots are grouped by tier.
+type CollectionSlot struct {
+	EntryID uuid.UUID
+	Tier    *string
+}
+
+// CollectionSummary is what a collection listed without its entries shows of
+// them: how many there are, and the distinct covers of the first ones.
+type CollectionSummary struct {
+	EntryCount int
+	Covers     []string
+}
+
+type EventKind string
+
+const (
+	EventKindStatus   EventKind = "status"
+	EventKindProgress EventKind = "progress"
+	EventKindSession  EventKind = "session"
+)
+
+// EntryEvent is one dated line of the consumption diary: a status change,
+// a progress change or an explicitly logged session.
+type EntryEvent struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	EntryID      uuid.UUID  `json:"entry_id" db:"entry_id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	Kind         EventKind  `json:"kind" db:"kind"`
+	OccurredOn   time.Time  `json:"occurred_on" db:"occurred_on"`
+	FromStatus   *Status    `json:"from_status,omitempty" db:"from_status"`
+	ToStatus     *Status    `json:"to_status,omitempty" db:"to_status"`
+	ProgressFrom JSONB      `json:"progress_from,omitempty" db:"progress_from"`
+	ProgressTo   JSONB      `json:"progress_to,omitempty" db:"progress_to"`
+	Note         *string    `json:"note,omitempty" db:"note"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	Summary      string     `json:"summary"`
+	Media        *MediaItem `json:"media,omitempty"`
 }
 
 type ShareToken struct {
@@ -98,6 +586,11 @@ func (j *JSONB) Scan(value interface{}) error {
 		return nil
 	}
 
+	return scanJSON(value, j)
+}
+
+// scanJSON unmarshals a JSON(B) column into dest.
+func scanJSON(value interface{}, dest interface{}) error {
 	var bytes []byte
 	switch v := value.(type) {
 	case []byte:
@@ -108,7 +601,85 @@ func (j *JSONB) Scan(value interface{}) error {
 		return errors.New("cannot scan non-string value into JSONB")
 	}
 
-	return json.Unmarshal(bytes, j)
+	return json.Unmarshal(bytes, dest)
+}
+
+// MergePatch applies patch to j as a JSON Merge Patch (RFC 7396) and returns the
+// result: null values remove keys, nested objects are merged recursively and
+// everything else replaces the existing value. j itself is left unchanged.
+func (j JSONB) MergePatch(patch JSONB) JSONB {
+	return mergePatch(j, patch)
+}
+
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(target)+len(patch))
+	for key, value := range target {
+		result[key] = value
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		if patchObject, ok := value.(map[string]interface{}); ok {
+			targetObject, _ := result[key].(map[string]interface{})
+			result[key] = mergePatch(targetObject, patchObject)
+			continue
+		}
+		result[key] = value
+	}
+
+	return result
+}
+
+// Optional is a request field that tells an absent JSON key (Set == false)
+// apart from an explicit null (Set && Null) and a value.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// Some returns an Optional holding v.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Set: true, Value: v}
+}
+
+// FromPtr returns an Optional that is set to v, or to null when v is nil.
+func FromPtr[T any](v *T) Optional[T] {
+	if v == nil {
+		return Optional[T]{Set: true, Null: true}
+	}
+	return Some(*v)
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(bytes.TrimSpace(data)) == "null" {
+		var zero T
+		o.Null = true
+		o.Value = zero
+		return nil
+	}
+	o.Null = false
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Set || o.Null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+// Ptr returns the value as a pointer, or nil when it is null or absent.
+func (o Optional[T]) Ptr() *T {
+	if !o.Set || o.Null {
+		return nil
+	}
+	v := o.Value
+	return &v
 }
 
 // Request/Response DTOs
@@ -116,14 +687,252 @@ type LoginRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+type UpdateSettingsRequest struct {
+	AutoStartDate          *bool        `json:"auto_start_date,omitempty"`
+	AutoFinishDate         *bool        `json:"auto_finish_date,omitempty"`
+	AutoFillProgress       *bool        `json:"auto_fill_progress,omitempty"`
+	AutoCompleteOnProgress *bool        `json:"auto_complete_on_progress,omitempty"`
+	RatingScale            *RatingScale `json:"rating_scale,omitempty"`
+}
+
 type CreateEntryRequest struct {
-	MediaID    uuid.UUID  `json:"media_id" binding:"required"`
-	Status     Status     `json:"status" binding:"required"`
-	Rating     *float64   `json:"rating,omitempty"`
-	ReviewMD   *string    `json:"review_md,omitempty"`
-	Progress   JSONB      `json:"progress,omitempty"`
+	MediaID      uuid.UUID  `json:"media_id" binding:"required"`
+	Status       Status     `json:"status" binding:"required"`
+	Rating       *float64   `json:"rating,omitempty"`
+	RatingMode   RatingMode `json:"rating_mode,omitempty"`
+	SubRatings   SubRatings `json:"sub_ratings,omitempty"`
+	ReviewMD     *string    `json:"review_md,omitempty"`
+	PrivateNotes *string    `json:"private_notes,omitempty"`
+	Visibility   Visibility `json:"visibility,omitempty"`
+	Progress     JSONB      `json:"progress,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// RatingTemplateRequest replaces the criteria of a rating template.
+type RatingTemplateRequest struct {
+	Criteria RatingCriteria `json:"criteria" binding:"required"`
+}
+
+type CycleRequest struct {
 	StartedAt  *time.Time `json:"started_at,omitempty"`
 	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Rating     *float64   `json:"rating,omitempty"`
+	Notes      *string    `json:"notes,omitempty"`
+}
+
+// UpdateCycleRequest is a partial update of a cycle: absent fields are kept and
+// an explicit null clears one.
+type UpdateCycleRequest struct {
+	StartedAt  Optional[time.Time] `json:"started_at"`
+	FinishedAt Optional[time.Time] `json:"finished_at"`
+	Rating     Optional[float64]   `json:"rating"`
+	Notes      Optional[string]    `json:"notes"`
+}
+
+type EntrySort string
+
+const (
+	EntrySortUpdated  EntrySort = "updated"
+	EntrySortRating   EntrySort = "rating"
+	EntrySortTitle    EntrySort = "title"
+	EntrySortStarted  EntrySort = "started"
+	EntrySortFinished EntrySort = "finished"
+	EntrySortProgress EntrySort = "progress"
+)
+
+// DefaultDescending reports the natural direction of a sort: titles ascend, everything else descends.
+func (s EntrySort) DefaultDescending() bool {
+	return s != EntrySortTitle
+}
+
+// EntryListQuery filters, sorts and paginates a user's entries. Zero values mean
+// "no filter"; a zero Limit returns every matching entry.
+type EntryListQuery struct {
+	Status       *Status
+	Type         *MediaType
+	RatingMin    *float64
+	RatingMax    *float64
+	Genre        *string
+	Tags         []string
+	Year         *int
+	FinishedFrom *time.Time
+	FinishedTo   *time.Time
+	HasReview    *bool
+	Visibility   *Visibility
+	Search       string
+	Sort         EntrySort
+	Descending   bool
+	Limit        int
+	Cursor       *EntryCursor
+}
+
+// EntryCursor marks the last entry of a page: its sort key (as rendered by
+// the database) and ID. Sort and Descending make a cursor unusable with another order.
+type EntryCursor struct {
+	Sort       EntrySort `json:"s"`
+	Descending bool      `json:"d"`
+	Key        string    `json:"k"`
+	ID         uuid.UUID `json:"id"`
+}
+
+// Encode returns the opaque cursor string handed to clients.
+func (c *EntryCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeEntryCursor parses a cursor string produced by EntryCursor.Encode.
+func DecodeEntryCursor(s string) (*EntryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	cursor := &EntryCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	return cursor, nil
+}
+
+type EntryPage struct {
+	Entries    []*Entry
+	NextCursor string
+}
+
+// Trash holds a user's deleted entries and collections that can still be restored.
+type Trash struct {
+	Entries       []*Entry      `json:"entries"`
+	Collections   []*Collection `json:"collections"`
+	RetentionDays int           `json:"retention_days"`
+}
+
+// LogSessionRequest records a consumption session. Progress holds the new values
+// (e.g. {"pages": 180}) and is merged into the entry's existing progress.
+type LogSessionRequest struct {
+	Date     *time.Time `json:"date,omitempty"`
+	Progress JSONB      `json:"progress,omitempty"`
+	Status   *Status    `json:"status,omitempty"`
+	Note     *string    `json:"note,omitempty"`
+}
+
+type DiaryQuery struct {
+	From    time.Time
+	To      time.Time
+	EntryID *uuid.UUID
+}
+
+type EntryStats struct {
+	TotalEntries     int                 `json:"total_entries"`
+	ByStatus         map[Status]int      `json:"by_status"`
+	ByType           map[MediaType]int   `json:"by_type"`
+	TotalCompletions int                 `json:"total_completions"`
+	RepeatedEntries  int                 `json:"repeated_entries"`
+	MostRepeated     []RepeatedEntryStat `json:"most_repeated"`
+	SubRatings       []SubRatingStat     `json:"sub_ratings"`
+}
+
+// SubRatingStat averages one sub-rating over a user's entries of a media type.
+// Average is canonical; DisplayAverage is on the user's rating scale.
+type SubRatingStat struct {
+	MediaType      MediaType `json:"media_type"`
+	Key            string    `json:"key"`
+	Label          string    `json:"label"`
+	Average        float64   `json:"average"`
+	DisplayAverage float64   `json:"display_average"`
+	Entries        int       `json:"entries"`
+}
+
+type RepeatedEntryStat struct {
+	EntryID        uuid.UUID `json:"entry_id"`
+	Title          string    `json:"title"`
+	Type           MediaType `json:"type"`
+	TimesCompleted int       `json:"times_completed"`
+}
+
+// UpdateEntryRequest is a partial update: absent fields are left untouched,
+// explicit nulls clear them. Progress is applied as a JSON Merge Patch.
+type UpdateEntryRequest struct {
+	Status       Optional[Status]     `json:"status"`
+	Rating       Optional[float64]    `json:"rating"`
+	RatingMode   Optional[RatingMode] `json:"rating_mode"`
+	SubRatings   Optional[SubRatings] `json:"sub_ratings"`
+	ReviewMD     Optional[string]     `json:"review_md"`
+	PrivateNotes Optional[string]     `json:"private_notes"`
+	Visibility   Optional[Visibility] `json:"visibility"`
+	Progress     Optional[JSONB]      `json:"progress"`
+	StartedAt    Optional[time.Time]  `json:"started_at"`
+	FinishedAt   Optional[time.Time]  `json:"finished_at"`
+	// ReplaceProgress makes Progress replace the stored progress instead of being merged into it.
+	ReplaceProgress bool `json:"-"`
+}
+
+// AsUpdate turns a create request into an update that replaces every field,
+// which is what re-creating an existing entry means. The visibility and rating
+// mode are kept unless the request sets them.
+func (r *CreateEntryRequest) AsUpdate() *UpdateEntryRequest {
+	update := &UpdateEntryRequest{
+		Status:          Some(r.Status),
+		Rating:          FromPtr(r.Rating),
+		SubRatings:      Optional[SubRatings]{Set: true, Null: r.SubRatings == nil, Value: r.SubRatings},
+		ReviewMD:        FromPtr(r.ReviewMD),
+		PrivateNotes:    FromPtr(r.PrivateNotes),
+		Progress:        Optional[JSONB]{Set: true, Null: r.Progress == nil, Value: r.Progress},
+		StartedAt:       FromPtr(r.StartedAt),
+		FinishedAt:      FromPtr(r.FinishedAt),
+		ReplaceProgress: true,
+	}
+	if r.Visibility != "" {
+		update.Visibility = Some(r.Visibility)
+	}
+	if r.RatingMode != "" {
+		update.RatingMode = Some(r.RatingMode)
+	}
+	return update
+}
+
+// BulkAction is the kind of change a bulk operation applies to its entries.
+type BulkAction string
+
+const (
+	BulkActionStatus          BulkAction = "status"
+	BulkActionRating          BulkAction = "rating"
+	BulkActionDelete          BulkAction = "delete"
+	BulkActionAddToCollection BulkAction = "add_to_collection"
+	BulkActionTag             BulkAction = "tag"
+	BulkActionVisibility      BulkAction = "visibility"
+)
+
+// BulkOperation applies one action to a set of entries. Only the field the
+// action needs is read: status, rating (null clears it), collection_id, tags
+// or visibility.
+type BulkOperation struct {
+	Action       BulkAction        `json:"action" binding:"required"`
+	EntryIDs     []uuid.UUID       `json:"entry_ids" binding:"required,min=1"`
+	Status       *Status           `json:"status,omitempty"`
+	Rating       Optional[float64] `json:"rating"`
+	CollectionID *uuid.UUID        `json:"collection_id,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Visibility   *Visibility       `json:"visibility,omitempty"`
+}
+
+type BulkEntryRequest struct {
+	Operations []BulkOperation `json:"operations" binding:"required,min=1,dive"`
+}
+
+// BulkItemResult is the outcome of one operation on one entry.
+type BulkItemResult struct {
+	Operation int       `json:"operation"`
+	EntryID   uuid.UUID `json:"entry_id"`
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// BulkEntryResult reports every item of a bulk request. The request is atomic:
+// Applied is false, and nothing was changed, if any item failed.
+type BulkEntryResult struct {
+	Applied bool             `json:"applied"`
+	Results []BulkItemResult `json:"results"`
 }
 
 type CreateMediaRequest struct {
@@ -136,6 +945,9 @@ type CreateMediaRequest struct {
 	Genres        []string  `json:"genres,omitempty"`
 	Duration      *int      `json:"duration,omitempty"`
 	Metadata      JSONB     `json:"metadata,omitempty"`
+	// ExternalIDs are the item's IDs in external catalogues, keyed by
+	// catalogue; sync uses them to match the item exactly.
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
 }
 
 type UpdateMediaRequest struct {
@@ -150,20 +962,174 @@ type UpdateMediaRequest struct {
 	Metadata      JSONB      `json:"metadata,omitempty"`
 }
 
+// CreateCollectionRequest creates or updates a collection. On update, leaving
+// out entry_ids keeps the collection's entries, and leaving out mode, tiers or
+// rules keeps those. Rules make the collection smart; it then takes no entry_ids.
 type CreateCollectionRequest struct {
-	Title    string   `json:"title" binding:"required"`
-	IsPublic bool     `json:"is_public"`
-	EntryIDs []string `json:"entry_ids,omitempty"`
+	Title    string           `json:"title" binding:"required"`
+	IsPublic bool             `json:"is_public"`
+	Mode     CollectionMode   `json:"mode,omitempty"`
+	Tiers    []string         `json:"tiers,omitempty"`
+	Rules    *CollectionRules `json:"rules,omitempty"`
+	EntryIDs []string         `json:"entry_ids,omitempty"`
+
+	// DescriptionMD and CoverURL are left as they are when unset on update,
+	// and cleared when empty.
+	DescriptionMD *string `json:"description_md,omitempty"`
+	CoverURL      *string `json:"cover_url,omitempty"`
+}
+
+// CollectionEntryNoteRequest sets the curator's note on an entry of a
+// collection; an empty note clears it.
+type CollectionEntryNoteRequest struct {
+	Note string `json:"note"`
+}
+
+// PlaceEntryRequest says where an entry added to (or moved within) a ranked or
+// tiered collection goes: at Rank (1-based, within Tier for tiered
+// collections), or last when Rank is unset.
+type PlaceEntryRequest struct {
+	Rank *int    `json:"rank,omitempty"`
+	Tier *string `json:"tier,omitempty"`
+}
+
+// AddMemberRequest shares a collection with the user registered under Email,
+// or changes their role if it already is.
+type AddMemberRequest struct {
+	Email string         `json:"email" binding:"required"`
+	Role  CollectionRole `json:"role" binding:"required"`
+}
+
+// ReorderCollectionRequest lists every entry of a collection in its new order.
+type ReorderCollectionRequest struct {
+	EntryIDs []uuid.UUID `json:"entry_ids" binding:"required"`
+}
+
+type SyncOp string
+
+const (
+	SyncOpUpsert SyncOp = "upsert"
+	SyncOpDelete SyncOp = "delete"
+)
+
+// SyncChange is one change a client made offline. Changes to entries the
+// client already knows name the entry and the version they were made against
+// (BaseVersion); new entries name their media instead, by MediaID or by Media.
+// The entry fields are applied as a partial update.
+type SyncChange struct {
+	ClientID        string              `json:"client_id" binding:"required"`
+	Op              SyncOp              `json:"op,omitempty"`
+	EntryID         *uuid.UUID          `json:"entry_id,omitempty"`
+	BaseVersion     *int                `json:"base_version,omitempty"`
+	MediaID         *uuid.UUID          `json:"media_id,omitempty"`
+	Media           *CreateMediaRequest `json:"media,omitempty"`
+	ClientUpdatedAt *time.Time          `json:"client_updated_at,omitempty"`
+	UpdateEntryRequest
 }
 
-type SyncEntryRequest struct {
-	Media      CreateMediaRequest `json:"media" binding:"required"`
-	Status     Status             `json:"status" binding:"required"`
-	Rating     *float64           `json:"rating,omitempty"`
-	ReviewMD   *string            `json:"review_md,omitempty"`
-	Progress   JSONB              `json:"progress,omitempty"`
-	StartedAt  *time.Time         `json:"started_at,omitempty"`
-	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+// SyncRequest uploads a client's offline changes. Cursor is the one returned by
+// the client's previous sync; server-side changes after it are sent back.
+type SyncRequest struct {
+	Cursor  string       `json:"cursor,omitempty"`
+	Changes []SyncChange `json:"changes" binding:"dive"`
+}
+
+type SyncConflictReason string
+
+const (
+	// SyncConflictVersion: the entry changed on the server since BaseVersion.
+	SyncConflictVersion SyncConflictReason = "version_mismatch"
+	// SyncConflictDeleted: the entry was deleted on the server.
+	SyncConflictDeleted SyncConflictReason = "deleted"
+	// SyncConflictExists: a new entry was sent for media the user already tracks.
+	SyncConflictExists SyncConflictReason = "already_exists"
+)
+
+// SyncConflict is a change that was not applied, with both sides of it.
+type SyncConflict struct {
+	ClientID string             `json:"client_id"`
+	Reason   SyncConflictReason `json:"reason"`
+	Client   SyncChange         `json:"client"`
+	Server   *Entry             `json:"server"`
+}
+
+// SyncApplied is a change that was applied; Entry is nil for deletes. For a
+// new entry described by media, Match says how that media was resolved.
+type SyncApplied struct {
+	ClientID string          `json:"client_id"`
+	EntryID  uuid.UUID       `json:"entry_id"`
+	Entry    *Entry          `json:"entry,omitempty"`
+	Match    *MediaMatchInfo `json:"match,omitempty"`
+}
+
+// MediaMatchKind says how media described by a client was matched to a
+// media item on the server.
+type MediaMatchKind string
+
+const (
+	// MediaMatchExternalID: an external catalogue ID matched exactly.
+	MediaMatchExternalID MediaMatchKind = "external_id"
+	// MediaMatchTitle: the normalized title, year and type matched.
+	MediaMatchTitle MediaMatchKind = "title"
+	// MediaMatchFuzzy: the title was similar enough to match with confidence.
+	MediaMatchFuzzy MediaMatchKind = "fuzzy"
+	// MediaMatchCreated: nothing matched and a new media item was created.
+	MediaMatchCreated MediaMatchKind = "created"
+)
+
+type MediaMatchInfo struct {
+	MediaID    uuid.UUID      `json:"media_id"`
+	MatchedBy  MediaMatchKind `json:"matched_by"`
+	Confidence float64        `json:"confidence"`
+}
+
+// MediaCandidate is an existing media item the client's media might be.
+type MediaCandidate struct {
+	Media      *MediaItem     `json:"media"`
+	MatchedBy  MediaMatchKind `json:"matched_by"`
+	Confidence float64        `json:"confidence"`
+}
+
+// SyncAmbiguous is a new entry whose media matched several existing items
+// equally well. Nothing was applied; the client picks a candidate and sends
+// the change again with its media_id.
+type SyncAmbiguous struct {
+	ClientID   string           `json:"client_id"`
+	Candidates []MediaCandidate `json:"candidates"`
+}
+
+type SyncItemError struct {
+	ClientID string `json:"client_id"`
+	Error    string `json:"error"`
+}
+
+// SyncResponse reports what happened to each change and carries the entry
+// changes made on the server since the request's cursor.
+type SyncResponse struct {
+	Applied   []SyncApplied   `json:"applied"`
+	Conflicts []SyncConflict  `json:"conflicts"`
+	Ambiguous []SyncAmbiguous `json:"ambiguous"`
+	Errors    []SyncItemError `json:"errors"`
+	EntryChanges
+}
+
+// EntryChange is one item of the entry change feed: an entry as it is now,
+// or a tombstone (Deleted, with no Entry) for an entry that was deleted.
+type EntryChange struct {
+	EntryID   uuid.UUID  `json:"entry_id"`
+	Deleted   bool       `json:"deleted"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Entry     *Entry     `json:"entry,omitempty"`
+	ChangeSeq int64      `json:"-"`
+}
+
+// EntryChanges is a page of the change feed, oldest change first. Cursor is
+// passed back to fetch the changes after this page; while HasMore is set
+// there are more changes to fetch.
+type EntryChanges struct {
+	Changes []EntryChange `json:"changes"`
+	Cursor  string        `json:"cursor"`
+	HasMore bool          `json:"has_more"`
 }
 
 type GuestSnapshotRequest struct {
@@ -174,3 +1140,26 @@ type GuestSnapshotRequest struct {
 type MergeRequest struct {
 	GuestEntries []Entry `json:"guest_entries" binding:"required"`
 }
+
+// ChangeEventType names what changed in a live change event.
+type ChangeEventType string
+
+const (
+	ChangeEntryCreated      ChangeEventType = "entry.created"
+	ChangeEntryUpdated      ChangeEventType = "entry.updated"
+	ChangeEntryDeleted      ChangeEventType = "entry.deleted"
+	ChangeCollectionCreated ChangeEventType = "collection.created"
+	ChangeCollectionUpdated ChangeEventType = "collection.updated"
+	ChangeCollectionDeleted ChangeEventType = "collection.deleted"
+	ChangeShareCreated      ChangeEventType = "share.created"
+)
+
+// ChangeEvent tells a user's open clients that one of their resources
+// changed. Data is the resource after the change, when the write returned it;
+// clients fetch it otherwise.
+type ChangeEvent struct {
+	Type ChangeEventType `json:"type"`
+	ID   uuid.UUID       `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+	At   time.Time       `json:"at"`
+}
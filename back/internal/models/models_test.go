@@ -0,0 +1,200 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestJSONBMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target JSONB
+		patch  JSONB
+		want   JSONB
+	}{
+		{name: "empty patch", target: JSONB{"pages": 10.0}, patch: JSONB{}, want: JSONB{"pages": 10.0}},
+		{name: "nil target", patch: JSONB{"pages": 10.0}, want: JSONB{"pages": 10.0}},
+		{
+			name:   "adds and replaces keys",
+			target: JSONB{"pages": 10.0, "total_pages": 300.0},
+			patch:  JSONB{"pages": 42.0, "chapters": 3.0},
+			want:   JSONB{"pages": 42.0, "total_pages": 300.0, "chapters": 3.0},
+		},
+		{
+			name:   "null removes a key",
+			target: JSONB{"pages": 10.0, "total_pages": 300.0},
+			patch:  JSONB{"total_pages": nil},
+			want:   JSONB{"pages": 10.0},
+		},
+		{
+			name:   "null for a missing key",
+			target: JSONB{"pages": 10.0},
+			patch:  JSONB{"chapters": nil},
+			want:   JSONB{"pages": 10.0},
+		},
+		{
+			name:   "objects merge recursively",
+			target: JSONB{"extra": map[string]interface{}{"a": 1.0, "b": 2.0}},
+			patch:  JSONB{"extra": map[string]interface{}{"b": nil, "c": 3.0}},
+			want:   JSONB{"extra": map[string]interface{}{"a": 1.0, "c": 3.0}},
+		},
+		{
+			name:   "an object replaces a scalar",
+			target: JSONB{"extra": 1.0},
+			patch:  JSONB{"extra": map[string]interface{}{"a": 1.0}},
+			want:   JSONB{"extra": map[string]interface{}{"a": 1.0}},
+		},
+		{
+			name:   "arrays are replaced",
+			target: JSONB{"list": []interface{}{1.0, 2.0}},
+			patch:  JSONB{"list": []interface{}{3.0}},
+			want:   JSONB{"list": []interface{}{3.0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := JSONB{}
+			for key, value := range tt.target {
+				original[key] = value
+			}
+			got := tt.target.MergePatch(tt.patch)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergePatch = %v, want %v", got, tt.want)
+			}
+			if len(tt.target) > 0 && !reflect.DeepEqual(tt.target, original) {
+				t.Errorf("MergePatch changed its target to %v", tt.target)
+			}
+		})
+	}
+}
+
+func TestOptionalUnmarshalJSON(t *testing.T) {
+	type request struct {
+		Status Optional[Status]  `json:"status"`
+		Rating Optional[float64] `json:"rating"`
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus Optional[Status]
+		wantRating Optional[float64]
+	}{
+		{name: "absent", body: `{}`},
+		{name: "null", body: `{"rating": null}`, wantRating: Optional[float64]{Set: true, Null: true}},
+		{
+			name:       "values",
+			body:       `{"status": "completed", "rating": 8.5}`,
+			wantStatus: Some(StatusCompleted),
+			wantRating: Some(8.5),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got request
+			if err := json.Unmarshal([]byte(tt.body), &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Status != tt.wantStatus || got.Rating != tt.wantRating {
+				t.Errorf("got status %+v, rating %+v, want %+v, %+v", got.Status, got.Rating, tt.wantStatus, tt.wantRating)
+			}
+		})
+	}
+}
+
+func TestEntryCursor(t *testing.T) {
+	cursor := &EntryCursor{Sort: EntrySortRating, Descending: true, Key: "8.5",
+		ID: uuid.MustParse("00000000-0000-0000-0000-00000000000a")}
+
+	got, err := DecodeEntryCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got != *cursor {
+		t.Errorf("DecodeEntryCursor(Encode()) = %+v, want %+v", got, cursor)
+	}
+
+	for _, malformed := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := DecodeEntryCursor(malformed); err == nil {
+			t.Errorf("DecodeEntryCursor(%q) succeeded, want an error", malformed)
+		}
+	}
+}
+
+func TestEntrySortDefaultDescending(t *testing.T) {
+	tests := []struct {
+		sort EntrySort
+		want bool
+	}{
+		{EntrySortUpdated, true},
+		{EntrySortRating, true},
+		{EntrySortStarted, true},
+		{EntrySortFinished, true},
+		{EntrySortProgress, true},
+		{EntrySortTitle, false},
+	}
+	for _, tt := range tests {
+		if got := tt.sort.DefaultDescending(); got != tt.want {
+			t.Errorf("%s.DefaultDescending() = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestRatingScaleDisplay(t *testing.T) {
+	tests := []struct {
+		scale     RatingScale
+		canonical float64
+		want      float64
+	}{
+		{RatingScaleTen, 7.5, 7.5},
+		{RatingScaleFiveStar, 7, 3.5},
+		{RatingScaleFiveStar, 10, 5},
+		{RatingScaleHundred, 8.4, 84},
+		{RatingScaleHundred, 0, 0},
+		{RatingScaleLikeDislike, LikeThreshold, 1},
+		{RatingScaleLikeDislike, 10, 1},
+		{RatingScaleLikeDislike, LikeThreshold - 0.1, 0},
+		{RatingScaleLikeDislike, 0, 0},
+		{"", 7.5, 7.5},
+	}
+	for _, tt := range tests {
+		if got := tt.scale.Display(tt.canonical); got != tt.want {
+			t.Errorf("%q.Display(%v) = %v, want %v", tt.scale, tt.canonical, got, tt.want)
+		}
+	}
+}
+
+func TestEntrySetRatingScale(t *testing.T) {
+	rating, cycleRating := 8.0, 5.0
+	entry := &Entry{
+		Rating:     &rating,
+		SubRatings: SubRatings{"story": 9, "art": 6},
+		Cycles:     []EntryCycle{{Rating: &cycleRating}, {}},
+	}
+
+	entry.SetRatingScale(RatingScaleFiveStar)
+
+	if entry.RatingScale != RatingScaleFiveStar {
+		t.Errorf("RatingScale = %q, want %q", entry.RatingScale, RatingScaleFiveStar)
+	}
+	if entry.DisplayRating == nil || *entry.DisplayRating != 4 {
+		t.Errorf("DisplayRating = %v, want 4", entry.DisplayRating)
+	}
+	if want := (SubRatings{"story": 4.5, "art": 3}); !reflect.DeepEqual(entry.DisplaySub, want) {
+		t.Errorf("DisplaySub = %v, want %v", entry.DisplaySub, want)
+	}
+	if got := entry.Cycles[0].DisplayRating; got == nil || *got != 2.5 {
+		t.Errorf("first cycle DisplayRating = %v, want 2.5", got)
+	}
+	if got := entry.Cycles[1].DisplayRating; got != nil {
+		t.Errorf("unrated cycle DisplayRating = %v, want nil", *got)
+	}
+	if rating != 8 {
+		t.Errorf("the canonical rating changed to %v", rating)
+	}
+}
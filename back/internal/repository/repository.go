@@ -4,23 +4,83 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"media-tracker/internal/models"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
+// ErrVersionConflict is returned by conditional writes when the row's version
+// no longer matches the one the caller read.
+var ErrVersionConflict = errors.New("version conflict")
+
+// DBTX is the part of *sql.DB and *sql.Tx the repositories use, so the same
+// repository code can run inside or outside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Transactor runs units of work in a database transaction.
+type Transactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// WithinTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise.
+func (t *Transactor) WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Savepoint runs fn inside a savepoint of tx. If fn fails, only its work is
+// rolled back and the transaction stays usable.
+func Savepoint(ctx context.Context, tx *sql.Tx, name string, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
 // UserRepository
 type UserRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *UserRepository) WithTx(tx *sql.Tx) *UserRepository {
+	return &UserRepository{db: tx}
+}
+
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `INSERT INTO users (id, email, name, created_at) VALUES ($1, $2, $3, $4)`
 	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.Name, user.CreatedAt)
@@ -47,23 +107,196 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 	return user, nil
 }
 
+// GetSettings returns the user's settings, or the defaults if they were never saved.
+func (r *UserRepository) GetSettings(ctx context.Context, userID uuid.UUID) (*models.UserSettings, error) {
+	query := `SELECT user_id, auto_start_date, auto_finish_date, auto_fill_progress, auto_complete_on_progress, rating_scale, updated_at
+			  FROM user_settings WHERE user_id = $1`
+	settings := &models.UserSettings{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&settings.UserID, &settings.AutoStartDate, &settings.AutoFinishDate,
+		&settings.AutoFillProgress, &settings.AutoCompleteOnProgress, &settings.RatingScale, &settings.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DefaultUserSettings(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (r *UserRepository) UpsertSettings(ctx context.Context, settings *models.UserSettings) error {
+	query := `INSERT INTO user_settings (user_id, auto_start_date, auto_finish_date, auto_fill_progress, auto_complete_on_progress,
+			  rating_scale, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  ON CONFLICT (user_id) DO UPDATE SET
+			  auto_start_date = EXCLUDED.auto_start_date, auto_finish_date = EXCLUDED.auto_finish_date,
+			  auto_fill_progress = EXCLUDED.auto_fill_progress, auto_complete_on_progress = EXCLUDED.auto_complete_on_progress,
+			  rating_scale = EXCLUDED.rating_scale, updated_at = EXCLUDED.updated_at`
+	_, err := r.db.ExecContext(ctx, query, settings.UserID, settings.AutoStartDate, settings.AutoFinishDate,
+		settings.AutoFillProgress, settings.AutoCompleteOnProgress, settings.RatingScale, settings.UpdatedAt)
+	return err
+}
+
+// ListRatingTemplates returns the rating templates the user has customised.
+func (r *UserRepository) ListRatingTemplates(ctx context.Context, userID uuid.UUID) ([]*models.RatingTemplate, error) {
+	query := `SELECT media_type, criteria, updated_at FROM rating_templates WHERE user_id = $1 ORDER BY media_type`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*models.RatingTemplate
+	for rows.Next() {
+		template := &models.RatingTemplate{Custom: true}
+		if err := rows.Scan(&template.MediaType, &template.Criteria, &template.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// GetRatingTemplate returns the user's rating template for a media type, or the
+// built-in default if they never customised it.
+func (r *UserRepository) GetRatingTemplate(ctx context.Context, userID uuid.UUID, mediaType models.MediaType) (*models.RatingTemplate, error) {
+	query := `SELECT media_type, criteria, updated_at FROM rating_templates WHERE user_id = $1 AND media_type = $2`
+	template := &models.RatingTemplate{Custom: true}
+	err := r.db.QueryRowContext(ctx, query, userID, mediaType).Scan(&template.MediaType, &template.Criteria, &template.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DefaultRatingTemplate(mediaType), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (r *UserRepository) UpsertRatingTemplate(ctx context.Context, userID uuid.UUID, template *models.RatingTemplate) error {
+	query := `INSERT INTO rating_templates (user_id, media_type, criteria, updated_at)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (user_id, media_type) DO UPDATE SET criteria = EXCLUDED.criteria, updated_at = EXCLUDED.updated_at`
+	_, err := r.db.ExecContext(ctx, query, userID, template.MediaType, template.Criteria, template.UpdatedAt)
+	return err
+}
+
+// DeleteRatingTemplate drops the user's template for a media type, which puts
+// the built-in default back in place.
+func (r *UserRepository) DeleteRatingTemplate(ctx context.Context, userID uuid.UUID, mediaType models.MediaType) error {
+	query := `DELETE FROM rating_templates WHERE user_id = $1 AND media_type = $2`
+	_, err := r.db.ExecContext(ctx, query, userID, mediaType)
+	return err
+}
+
 // MediaRepository
 type MediaRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewMediaRepository(db *sql.DB) *MediaRepository {
 	return &MediaRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *MediaRepository) WithTx(tx *sql.Tx) *MediaRepository {
+	return &MediaRepository{db: tx}
+}
+
+// Create inserts a media item together with its external IDs.
 func (r *MediaRepository) Create(ctx context.Context, media *models.MediaItem) error {
-	query := `INSERT INTO media_items (id, type, title, original_title, year, cover_url, creators, genres, duration, metadata, created_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	sources, externalIDs := splitExternalIDs(media.ExternalIDs)
+	query := `WITH media AS (
+				INSERT INTO media_items (id, type, title, original_title, year, cover_url, creators, genres, duration, metadata, created_at) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+				RETURNING id
+			  )
+			  INSERT INTO media_external_ids (media_id, source, external_id)
+			  SELECT media.id, x.source, x.external_id FROM media, unnest($12::text[], $13::text[]) AS x(source, external_id)
+			  ON CONFLICT DO NOTHING`
 	_, err := r.db.ExecContext(ctx, query, media.ID, media.Type, media.Title, media.OriginalTitle, media.Year,
-		media.CoverURL, media.Creators, pq.Array(media.Genres), media.Duration, media.Metadata, media.CreatedAt)
+		media.CoverURL, media.Creators, pq.Array(media.Genres), media.Duration, media.Metadata, media.CreatedAt,
+		pq.Array(sources), pq.Array(externalIDs))
 	return err
 }
 
+// AddExternalIDs records more external IDs for a media item. IDs that already
+// belong to an item are left where they are.
+func (r *MediaRepository) AddExternalIDs(ctx context.Context, mediaID uuid.UUID, ids map[string]string) error {
+	sources, externalIDs := splitExternalIDs(ids)
+	query := `INSERT INTO media_external_ids (media_id, source, external_id)
+			  SELECT $1, x.source, x.external_id FROM unnest($2::text[], $3::text[]) AS x(source, external_id)
+			  ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, mediaID, pq.Array(sources), pq.Array(externalIDs))
+	return err
+}
+
+// mediaMatchColumns selects a media item (aliased m) with its external IDs.
+// Rows selected with it are read back with scanMediaMatch.
+const mediaMatchColumns = `m.id, m.type, m.title, m.original_title, m.year, m.cover_url, m.creators, m.genres, m.duration, m.metadata, m.created_at,
+			  (SELECT json_object_agg(x.source, x.external_id) FROM media_external_ids x WHERE x.media_id = m.id)`
+
+func scanMediaMatch(row rowScanner) (*models.MediaItem, error) {
+	media := &models.MediaItem{}
+	var externalIDs []byte
+	err := row.Scan(&media.ID, &media.Type, &media.Title, &media.OriginalTitle, &media.Year, &media.CoverURL,
+		&media.Creators, pq.Array(&media.Genres), &media.Duration, &media.Metadata, &media.CreatedAt, &externalIDs)
+	if err != nil {
+		return nil, err
+	}
+	if externalIDs != nil {
+		if err := json.Unmarshal(externalIDs, &media.ExternalIDs); err != nil {
+			return nil, err
+		}
+	}
+	return media, nil
+}
+
+// GetByExternalID returns the media item with the given ID in an external catalogue.
+func (r *MediaRepository) GetByExternalID(ctx context.Context, source, externalID string) (*models.MediaItem, error) {
+	query := `SELECT ` + mediaMatchColumns + `
+			  FROM media_external_ids x JOIN media_items m ON m.id = x.media_id
+			  WHERE x.source = $1 AND x.external_id = $2`
+	return scanMediaMatch(r.db.QueryRowContext(ctx, query, source, externalID))
+}
+
+// MatchCandidates returns media items of a type whose title or original title
+// is similar (by trigram similarity) to title, most similar first.
+func (r *MediaRepository) MatchCandidates(ctx context.Context, mediaType models.MediaType, title string, limit int) ([]*models.MediaItem, error) {
+	query := `SELECT ` + mediaMatchColumns + `
+			  FROM media_items m
+			  WHERE m.type = $1 AND (m.title % $2 OR m.original_title % $2 OR lower(m.title) = lower($2))
+			  ORDER BY GREATEST(similarity(m.title, $2), similarity(COALESCE(m.original_title, ''), $2)) DESC, m.created_at, m.id
+			  LIMIT $3`
+	rows, err := r.db.QueryContext(ctx, query, mediaType, title, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.MediaItem
+	for rows.Next() {
+		media, err := scanMediaMatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, media)
+	}
+	return items, rows.Err()
+}
+
+// splitExternalIDs turns a source → ID map into parallel arrays, in source order.
+func splitExternalIDs(ids map[string]string) (sources []string, externalIDs []string) {
+	sources = make([]string, 0, len(ids))
+	for source := range ids {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	externalIDs = make([]string, len(sources))
+	for i, source := range sources {
+		externalIDs[i] = ids[source]
+	}
+	return sources, externalIDs
+}
+
 func (r *MediaRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.MediaItem, error) {
 	query := `SELECT id, type, title, original_title, year, cover_url, creators, genres, duration, metadata, created_at 
 			  FROM media_items WHERE id = $1`
@@ -162,124 +395,211 @@ func (r *MediaRepository) Search(ctx context.Context, query string, mediaType *m
 
 // EntryRepository
 type EntryRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewEntryRepository(db *sql.DB) *EntryRepository {
 	return &EntryRepository{db: db}
 }
 
-func (r *EntryRepository) Create(ctx context.Context, entry *models.Entry) error {
-	query := `INSERT INTO entries (id, user_id, media_id, status, rating, review_md, progress, started_at, finished_at, updated_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
-	_, err := r.db.ExecContext(ctx, query, entry.ID, entry.UserID, entry.MediaID, entry.Status, entry.Rating,
-		entry.ReviewMD, entry.Progress, entry.StartedAt, entry.FinishedAt, entry.UpdatedAt)
-	return err
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *EntryRepository) WithTx(tx *sql.Tx) *EntryRepository {
+	return &EntryRepository{db: tx}
 }
 
-func (r *EntryRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Entry, error) {
-	query := `SELECT e.id, e.user_id, e.media_id, e.status, e.rating, e.review_md, e.progress, e.started_at, e.finished_at, e.updated_at,
-			  m.id, m.type, m.title, m.original_title, m.year, m.cover_url, m.creators, m.genres, m.duration, m.metadata, m.created_at
-			  FROM entries e 
-			  JOIN media_items m ON e.media_id = m.id 
-			  WHERE e.id = $1`
+// entryRatingScaleColumn selects the rating scale of the owner of entry e.
+const entryRatingScaleColumn = `COALESCE((SELECT us.rating_scale FROM user_settings us WHERE us.user_id = e.user_id), 'ten')`
 
+// entryWithMediaColumns selects an entry joined with its media item (aliased e and m).
+// Rows selected with it are read back with scanEntryWithMedia.
+const entryWithMediaColumns = `e.id, e.user_id, e.media_id, e.status, e.rating, ` + entryRatingScaleColumn + `, e.rating_mode, e.sub_ratings,
+			  e.review_md, e.private_notes, e.visibility, e.progress, e.completion, e.started_at, e.finished_at, e.updated_at, e.version,
+			  (SELECT COUNT(*) FROM entry_cycles c WHERE c.entry_id = e.id AND c.completed),
+			  ARRAY(SELECT t.tag FROM entry_tags t WHERE t.entry_id = e.id ORDER BY t.tag),
+			  m.id, m.type, m.title, m.original_title, m.year, m.cover_url, m.creators, m.genres, m.duration, m.metadata, m.created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEntryWithMedia reads a row selected with entryWithMediaColumns; extra
+// receives any columns selected after them.
+func scanEntryWithMedia(row rowScanner, extra ...interface{}) (*models.Entry, error) {
 	entry := &models.Entry{Media: &models.MediaItem{}}
-	var genresBytes []byte
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&entry.ID, &entry.UserID, &entry.MediaID, &entry.Status, &entry.Rating, &entry.ReviewMD, &entry.Progress,
-		&entry.StartedAt, &entry.FinishedAt, &entry.UpdatedAt,
+	dest := []interface{}{
+		&entry.ID, &entry.UserID, &entry.MediaID, &entry.Status, &entry.Rating, &entry.RatingScale, &entry.RatingMode, &entry.SubRatings,
+		&entry.ReviewMD, &entry.PrivateNotes, &entry.Visibility, &entry.Progress, &entry.Completion, &entry.StartedAt, &entry.FinishedAt,
+		&entry.UpdatedAt, &entry.Version, &entry.TimesCompleted,
+		pq.Array(&entry.Tags),
 		&entry.Media.ID, &entry.Media.Type, &entry.Media.Title, &entry.Media.OriginalTitle, &entry.Media.Year,
-		&entry.Media.CoverURL, &entry.Media.Creators, &genresBytes, &entry.Media.Duration, &entry.Media.Metadata, &entry.Media.CreatedAt)
-	if err != nil {
+		&entry.Media.CoverURL, &entry.Media.Creators, pq.Array(&entry.Media.Genres), &entry.Media.Duration, &entry.Media.Metadata,
+		&entry.Media.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
+	entry.SetRatingScale(entry.RatingScale)
+	return entry, nil
+}
 
-	// Convert PostgreSQL array bytes to string slice
-	if genresBytes != nil {
-		genresStr := string(genresBytes)
-		// Remove curly braces and split by comma
-		if len(genresStr) >= 2 && genresStr[0] == '{' && genresStr[len(genresStr)-1] == '}' {
-			genresStr = genresStr[1 : len(genresStr)-1]
-			if genresStr != "" {
-				entry.Media.Genres = strings.Split(genresStr, ",")
-				// Trim whitespace from each genre
-				for i, genre := range entry.Media.Genres {
-					entry.Media.Genres[i] = strings.TrimSpace(genre)
-				}
-			}
-		}
-	}
+func (r *EntryRepository) Create(ctx context.Context, entry *models.Entry) error {
+	query := `INSERT INTO entries (id, user_id, media_id, status, rating, rating_mode, sub_ratings, review_md, private_notes, visibility,
+			  progress, completion, started_at, finished_at, updated_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := r.db.ExecContext(ctx, query, entry.ID, entry.UserID, entry.MediaID, entry.Status, entry.Rating, entry.RatingMode, entry.SubRatings,
+		entry.ReviewMD, entry.PrivateNotes, entry.Visibility, entry.Progress, entry.Completion, entry.StartedAt, entry.FinishedAt,
+		entry.UpdatedAt)
+	return err
+}
 
-	return entry, nil
+func (r *EntryRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Entry, error) {
+	query := `SELECT ` + entryWithMediaColumns + `
+			  FROM entries e 
+			  JOIN media_items m ON e.media_id = m.id 
+			  WHERE e.id = $1 AND e.deleted_at IS NULL`
+
+	return scanEntryWithMedia(r.db.QueryRowContext(ctx, query, id))
 }
 
-func (r *EntryRepository) ListByUser(ctx context.Context, userID uuid.UUID, status *models.Status, mediaType *models.MediaType) ([]*models.Entry, error) {
-	query := `SELECT e.id, e.user_id, e.media_id, e.status, e.rating, e.review_md, e.progress, e.started_at, e.finished_at, e.updated_at,
-			  m.id, m.type, m.title, m.original_title, m.year, m.cover_url, m.creators, m.genres, m.duration, m.metadata, m.created_at
+// entrySortColumns maps each sort to the expression it orders by and the type a
+// cursor key is cast back to. NULLs are coalesced to sort last (descending) so
+// that keyset comparisons on (expression, id) stay well-defined.
+var entrySortColumns = map[models.EntrySort]struct{ expr, cast string }{
+	models.EntrySortUpdated:  {"e.updated_at", "timestamptz"},
+	models.EntrySortRating:   {"COALESCE(e.rating, -1)", "numeric"},
+	models.EntrySortTitle:    {"lower(m.title)", "text"},
+	models.EntrySortStarted:  {"COALESCE(e.started_at, DATE '0001-01-01')", "date"},
+	models.EntrySortFinished: {"COALESCE(e.finished_at, DATE '0001-01-01')", "date"},
+	models.EntrySortProgress: {"COALESCE(e.completion, -1)", "numeric"},
+}
+
+// ListByUser returns one page of a user's entries matching the query, and the
+// cursor of the next page ("" on the last page).
+func (r *EntryRepository) ListByUser(ctx context.Context, userID uuid.UUID, q *models.EntryListQuery) ([]*models.Entry, string, error) {
+	sort, ok := entrySortColumns[q.Sort]
+	if !ok {
+		sort = entrySortColumns[models.EntrySortUpdated]
+	}
+
+	query := `SELECT ` + entryWithMediaColumns + `, (` + sort.expr + `)::text
 			  FROM entries e 
 			  JOIN media_items m ON e.media_id = m.id 
-			  WHERE e.user_id = $1`
+			  WHERE e.user_id = $1 AND e.deleted_at IS NULL`
 	args := []interface{}{userID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Status != nil {
+		query += " AND e.status = " + arg(*q.Status)
+	}
+	if q.Type != nil {
+		query += " AND m.type = " + arg(*q.Type)
+	}
+	if q.RatingMin != nil {
+		query += " AND e.rating >= " + arg(*q.RatingMin)
+	}
+	if q.RatingMax != nil {
+		query += " AND e.rating <= " + arg(*q.RatingMax)
+	}
+	if q.Genre != nil {
+		query += " AND EXISTS (SELECT 1 FROM unnest(m.genres) g WHERE lower(g) = lower(" + arg(*q.Genre) + "))"
+	}
+	if len(q.Tags) > 0 {
+		query += " AND NOT EXISTS (SELECT unnest(" + arg(pq.Array(q.Tags)) + "::text[]) EXCEPT SELECT t.tag FROM entry_tags t WHERE t.entry_id = e.id)"
+	}
+	if q.Year != nil {
+		query += " AND m.year = " + arg(*q.Year)
+	}
+	if q.FinishedFrom != nil {
+		query += " AND e.finished_at >= " + arg(*q.FinishedFrom)
+	}
+	if q.FinishedTo != nil {
+		query += " AND e.finished_at <= " + arg(*q.FinishedTo)
+	}
+	if q.HasReview != nil {
+		query += " AND (COALESCE(e.review_md, '') <> '') = " + arg(*q.HasReview)
+	}
+	if q.Visibility != nil {
+		query += " AND e.visibility = " + arg(*q.Visibility)
+	}
+	if q.Search != "" {
+		pattern := arg("%" + escapeLike(q.Search) + "%")
+		query += " AND (m.title ILIKE " + pattern + " OR m.original_title ILIKE " + pattern + " OR e.review_md ILIKE " + pattern + ")"
+	}
 
-	if status != nil {
-		query += " AND e.status = $2"
-		args = append(args, *status)
+	direction, comparison := "ASC", ">"
+	if q.Descending {
+		direction, comparison = "DESC", "<"
 	}
 
-	if mediaType != nil {
-		query += " AND m.type = $3"
-		args = append(args, *mediaType)
+	if q.Cursor != nil {
+		query += fmt.Sprintf(" AND (%s, e.id) %s (%s::%s, %s)", sort.expr, comparison, arg(q.Cursor.Key), sort.cast, arg(q.Cursor.ID))
 	}
 
-	query += " ORDER BY e.updated_at DESC"
+	query += fmt.Sprintf(" ORDER BY %s %s, e.id %s", sort.expr, direction, direction)
+
+	if q.Limit > 0 {
+		// Fetch one extra row to know whether there is a next page
+		query += " LIMIT " + arg(q.Limit+1)
+	}
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
 	var entries []*models.Entry
+	var keys []string
 	for rows.Next() {
-		entry := &models.Entry{Media: &models.MediaItem{}}
-		var genresBytes []byte
-		err := rows.Scan(
-			&entry.ID, &entry.UserID, &entry.MediaID, &entry.Status, &entry.Rating, &entry.ReviewMD, &entry.Progress,
-			&entry.StartedAt, &entry.FinishedAt, &entry.UpdatedAt,
-			&entry.Media.ID, &entry.Media.Type, &entry.Media.Title, &entry.Media.OriginalTitle, &entry.Media.Year,
-			&entry.Media.CoverURL, &entry.Media.Creators, &genresBytes, &entry.Media.Duration, &entry.Media.Metadata, &entry.Media.CreatedAt)
+		var key string
+		entry, err := scanEntryWithMedia(rows, &key)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
+		entries = append(entries, entry)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
-		// Convert PostgreSQL array bytes to string slice
-		if genresBytes != nil {
-			genresStr := string(genresBytes)
-			// Remove curly braces and split by comma
-			if len(genresStr) >= 2 && genresStr[0] == '{' && genresStr[len(genresStr)-1] == '}' {
-				genresStr = genresStr[1 : len(genresStr)-1]
-				if genresStr != "" {
-					entry.Media.Genres = strings.Split(genresStr, ",")
-					// Trim whitespace from each genre
-					for i, genre := range entry.Media.Genres {
-						entry.Media.Genres[i] = strings.TrimSpace(genre)
-					}
-				}
-			}
-		}
+	nextCursor := ""
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+		last := entries[q.Limit-1]
+		nextCursor = (&models.EntryCursor{
+			Sort:       q.Sort,
+			Descending: q.Descending,
+			Key:        keys[q.Limit-1],
+			ID:         last.ID,
+		}).Encode()
+	}
 
-		entries = append(entries, entry)
+	return entries, nextCursor, nil
+}
+
+// escapeLike escapes the LIKE wildcards in user input.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// uuidStrings formats ids for a uuid[] parameter.
+func uuidStrings(ids []uuid.UUID) []string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
 	}
-	return entries, nil
+	return strs
 }
 
 func (r *EntryRepository) ListByUserAndMedia(ctx context.Context, userID uuid.UUID, mediaID uuid.UUID) ([]*models.Entry, error) {
-	query := `SELECT e.id, e.user_id, e.media_id, e.status, e.rating, e.review_md, e.progress, e.started_at, e.finished_at, e.updated_at,
-			  m.id, m.type, m.title, m.original_title, m.year, m.cover_url, m.creators, m.genres, m.duration, m.metadata, m.created_at
+	query := `SELECT ` + entryWithMediaColumns + `
 			  FROM entries e 
 			  JOIN media_items m ON e.media_id = m.id 
-			  WHERE e.user_id = $1 AND e.media_id = $2
+			  WHERE e.user_id = $1 AND e.media_id = $2 AND e.deleted_at IS NULL
 			  ORDER BY e.updated_at DESC`
 
 	rows, err := r.db.QueryContext(ctx, query, userID, mediaID)
@@ -290,33 +610,10 @@ func (r *EntryRepository) ListByUserAndMedia(ctx context.Context, userID uuid.UU
 
 	var entries []*models.Entry
 	for rows.Next() {
-		entry := &models.Entry{Media: &models.MediaItem{}}
-		var genresBytes []byte
-		err := rows.Scan(
-			&entry.ID, &entry.UserID, &entry.MediaID, &entry.Status, &entry.Rating, &entry.ReviewMD, &entry.Progress,
-			&entry.StartedAt, &entry.FinishedAt, &entry.UpdatedAt,
-			&entry.Media.ID, &entry.Media.Type, &entry.Media.Title, &entry.Media.OriginalTitle, &entry.Media.Year,
-			&entry.Media.CoverURL, &entry.Media.Creators, &genresBytes, &entry.Media.Duration, &entry.Media.Metadata, &entry.Media.CreatedAt)
+		entry, err := scanEntryWithMedia(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		// Convert PostgreSQL array bytes to string slice
-		if genresBytes != nil {
-			genresStr := string(genresBytes)
-			// Remove curly braces and split by comma
-			if len(genresStr) >= 2 && genresStr[0] == '{' && genresStr[len(genresStr)-1] == '}' {
-				genresStr = genresStr[1 : len(genresStr)-1]
-				if genresStr != "" {
-					entry.Media.Genres = strings.Split(genresStr, ",")
-					// Trim whitespace from each genre
-					for i, genre := range entry.Media.Genres {
-						entry.Media.Genres[i] = strings.TrimSpace(genre)
-					}
-				}
-			}
-		}
-
 		entries = append(entries, entry)
 	}
 
@@ -328,161 +625,559 @@ func (r *EntryRepository) ListByUserAndMedia(ctx context.Context, userID uuid.UU
 	return entries, nil
 }
 
+// Update saves an entry if it is still at entry.Version, and bumps the version.
+// It returns ErrVersionConflict if the entry was changed since it was read.
 func (r *EntryRepository) Update(ctx context.Context, entry *models.Entry) error {
-	query := `UPDATE entries SET status = $1, rating = $2, review_md = $3, progress = $4, started_at = $5, finished_at = $6, updated_at = $7 
-			  WHERE id = $8`
-	_, err := r.db.ExecContext(ctx, query, entry.Status, entry.Rating, entry.ReviewMD, entry.Progress,
-		entry.StartedAt, entry.FinishedAt, entry.UpdatedAt, entry.ID)
-	return err
-}
-
-func (r *EntryRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM entries WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+	query := `UPDATE entries SET status = $1, rating = $2, rating_mode = $3, sub_ratings = $4, review_md = $5, private_notes = $6,
+			  visibility = $7, progress = $8, completion = $9, started_at = $10, finished_at = $11, updated_at = $12, version = version + 1
+			  WHERE id = $13 AND version = $14 AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, entry.Status, entry.Rating, entry.RatingMode, entry.SubRatings, entry.ReviewMD, entry.PrivateNotes, entry.Visibility,
+		entry.Progress, entry.Completion, entry.StartedAt, entry.FinishedAt, entry.UpdatedAt, entry.ID, entry.Version)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+	entry.Version++
+	return nil
 }
 
-// CollectionRepository
-type CollectionRepository struct {
-	db *sql.DB
+// expectOneRow turns a conditional write that matched no row into ErrVersionConflict.
+func expectOneRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
 }
 
-func NewCollectionRepository(db *sql.DB) *CollectionRepository {
-	return &CollectionRepository{db: db}
+// AddTags attaches tags to an entry, skipping the ones it already has, and bumps
+// the entry's version if any tag was new.
+func (r *EntryRepository) AddTags(ctx context.Context, entryID uuid.UUID, tags []string) error {
+	query := `WITH added AS (
+				  INSERT INTO entry_tags (entry_id, tag) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING RETURNING entry_id
+			  )
+			  UPDATE entries SET version = version + 1, updated_at = NOW() WHERE id = $1 AND EXISTS (SELECT 1 FROM added)`
+	_, err := r.db.ExecContext(ctx, query, entryID, pq.Array(tags))
+	return err
 }
 
-func (r *CollectionRepository) Create(ctx context.Context, collection *models.Collection) error {
-	query := `INSERT INTO collections (id, user_id, title, is_public, created_at) VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.db.ExecContext(ctx, query, collection.ID, collection.UserID, collection.Title, collection.IsPublic, collection.CreatedAt)
-	return err
+// Delete moves an entry at the given version to the trash. It keeps its cycles,
+// events and collection memberships until it is purged.
+func (r *EntryRepository) Delete(ctx context.Context, id uuid.UUID, version int) error {
+	query := `UPDATE entries SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
 }
 
-func (r *CollectionRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.Collection, error) {
-	query := `SELECT id, user_id, title, is_public, created_at FROM collections WHERE user_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, query, userID)
+// ListChanges returns up to limit of a user's entries whose change sequence is
+// after since, in change order. Trashed entries are included with DeletedAt set.
+func (r *EntryRepository) ListChanges(ctx context.Context, userID uuid.UUID, since int64, limit int) ([]*models.Entry, error) {
+	query := `SELECT ` + entryWithMediaColumns + `, e.deleted_at, e.change_seq
+			  FROM entries e
+			  JOIN media_items m ON e.media_id = m.id
+			  WHERE e.user_id = $1 AND e.change_seq > $2
+			  ORDER BY e.change_seq
+			  LIMIT $3`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, since, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var collections []*models.Collection
+	var entries []*models.Entry
 	for rows.Next() {
-		collection := &models.Collection{}
-		err := rows.Scan(&collection.ID, &collection.UserID, &collection.Title, &collection.IsPublic, &collection.CreatedAt)
+		var deletedAt sql.NullTime
+		var changeSeq int64
+		entry, err := scanEntryWithMedia(rows, &deletedAt, &changeSeq)
 		if err != nil {
 			return nil, err
 		}
-		collections = append(collections, collection)
+		if deletedAt.Valid {
+			entry.DeletedAt = &deletedAt.Time
+		}
+		entry.ChangeSeq = changeSeq
+		entries = append(entries, entry)
 	}
 
-	return collections, nil
+	return entries, rows.Err()
 }
 
-func (r *CollectionRepository) Update(ctx context.Context, collection *models.Collection) error {
-	query := `UPDATE collections SET title = $1, is_public = $2 WHERE id = $3`
-	_, err := r.db.ExecContext(ctx, query, collection.Title, collection.IsPublic, collection.ID)
-	return err
-}
+// ListTombstones returns the tombstones of a user's removed entries whose
+// change_seq is after since, in change_seq order.
+func (r *EntryRepository) ListTombstones(ctx context.Context, userID uuid.UUID, since int64, limit int) ([]models.EntryChange, error) {
+	query := `SELECT entry_id, deleted_at, change_seq
+			  FROM entry_tombstones
+			  WHERE user_id = $1 AND change_seq > $2
+			  ORDER BY change_seq
+			  LIMIT $3`
 
-func (r *CollectionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
-	query := `SELECT id, user_id, title, is_public, created_at FROM collections WHERE id = $1`
-	collection := &models.Collection{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&collection.ID, &collection.UserID, &collection.Title, &collection.IsPublic, &collection.CreatedAt)
+	rows, err := r.db.QueryContext(ctx, query, userID, since, limit)
 	if err != nil {
 		return nil, err
 	}
-	return collection, nil
-}
+	defer rows.Close()
 
-func (r *CollectionRepository) GetByIDWithEntries(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
-	// Get collection basic info
-	collection, err := r.GetByID(ctx, id)
-	if err != nil {
-		return nil, err
+	var tombstones []models.EntryChange
+	for rows.Next() {
+		tombstone := models.EntryChange{Deleted: true}
+		var deletedAt time.Time
+		if err := rows.Scan(&tombstone.EntryID, &deletedAt, &tombstone.ChangeSeq); err != nil {
+			return nil, err
+		}
+		tombstone.DeletedAt = &deletedAt
+		tombstones = append(tombstones, tombstone)
 	}
 
-	// Get entries for this collection
-	entriesQuery := `
-		SELECT e.id, e.user_id, e.media_id, e.status, e.rating, e.review_md, 
-		       e.progress, e.started_at, e.finished_at, e.updated_at,
-		       m.id, m.type, m.title, m.original_title, m.year, m.cover_url, 
-		       m.creators, m.genres, m.duration, m.metadata
-		FROM collection_entries ce
-		JOIN entries e ON ce.entry_id = e.id
-		JOIN media_items m ON e.media_id = m.id
-		WHERE ce.collection_id = $1
-		ORDER BY e.updated_at DESC
-	`
+	return tombstones, rows.Err()
+}
+
+// ListTrash returns a user's trashed entries, most recently deleted first.
+func (r *EntryRepository) ListTrash(ctx context.Context, userID uuid.UUID) ([]*models.Entry, error) {
+	query := `SELECT ` + entryWithMediaColumns + `, e.deleted_at
+			  FROM entries e
+			  JOIN media_items m ON e.media_id = m.id
+			  WHERE e.user_id = $1 AND e.deleted_at IS NOT NULL
+			  ORDER BY e.deleted_at DESC`
 
-	rows, err := r.db.QueryContext(ctx, entriesQuery, id)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var entries []models.Entry
+	var entries []*models.Entry
 	for rows.Next() {
-		var entry models.Entry
-		var media models.MediaItem
-		var creators, genres, metadata []byte
-		var startedAt, finishedAt sql.NullTime
-
-		err := rows.Scan(
-			&entry.ID, &entry.UserID, &entry.MediaID, &entry.Status, &entry.Rating,
-			&entry.ReviewMD, &entry.Progress, &startedAt, &finishedAt,
-			&entry.UpdatedAt,
-			&media.ID, &media.Type, &media.Title, &media.OriginalTitle,
-			&media.Year, &media.CoverURL, &creators, &genres, &media.Duration, &metadata,
-		)
+		var deletedAt time.Time
+		entry, err := scanEntryWithMedia(rows, &deletedAt)
 		if err != nil {
 			return nil, err
 		}
-
-		// Parse JSON fields
-		if len(creators) > 0 {
-			json.Unmarshal(creators, &media.Creators)
-		}
-		if len(genres) > 0 {
-			json.Unmarshal(genres, &media.Genres)
-		}
-		if len(metadata) > 0 {
-			json.Unmarshal(metadata, &media.Metadata)
-		}
-
-		// Handle nullable timestamps
-		if startedAt.Valid {
-			entry.StartedAt = &startedAt.Time
-		}
-		if finishedAt.Valid {
-			entry.FinishedAt = &finishedAt.Time
-		}
-
-		entry.Media = &media
+		entry.DeletedAt = &deletedAt
 		entries = append(entries, entry)
 	}
 
-	collection.Entries = entries
-	return collection, nil
+	return entries, rows.Err()
 }
 
-func (r *CollectionRepository) AddEntries(ctx context.Context, collectionID uuid.UUID, entryIDs []string) error {
-	if len(entryIDs) == 0 {
-		return nil
-	}
+// GetTrashed returns an entry that is in the trash.
+func (r *EntryRepository) GetTrashed(ctx context.Context, id uuid.UUID) (*models.Entry, error) {
+	query := `SELECT ` + entryWithMediaColumns + `, e.deleted_at
+			  FROM entries e
+			  JOIN media_items m ON e.media_id = m.id
+			  WHERE e.id = $1 AND e.deleted_at IS NOT NULL`
 
-	// Convert string IDs to UUIDs
-	entryUUIDs := make([]uuid.UUID, len(entryIDs))
-	for i, idStr := range entryIDs {
-		id, err := uuid.Parse(idStr)
-		if err != nil {
-			return fmt.Errorf("invalid entry ID: %s", idStr)
-		}
-		entryUUIDs[i] = id
+	var deletedAt time.Time
+	entry, err := scanEntryWithMedia(r.db.QueryRowContext(ctx, query, id), &deletedAt)
+	if err != nil {
+		return nil, err
 	}
+	entry.DeletedAt = &deletedAt
+	return entry, nil
+}
 
-	// Insert entries into collection
+// Restore takes an entry out of the trash.
+func (r *EntryRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE entries SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Purge permanently deletes entries trashed before the given time.
+func (r *EntryRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM entries WHERE deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cycleColumns = `id, entry_id, number, completed, started_at, finished_at, rating, notes, created_at, updated_at`
+
+func scanCycle(row rowScanner) (*models.EntryCycle, error) {
+	cycle := &models.EntryCycle{}
+	err := row.Scan(&cycle.ID, &cycle.EntryID, &cycle.Number, &cycle.Completed, &cycle.StartedAt, &cycle.FinishedAt,
+		&cycle.Rating, &cycle.Notes, &cycle.CreatedAt, &cycle.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return cycle, nil
+}
+
+// ListCycles returns the consumption cycles of an entry, oldest first.
+func (r *EntryRepository) ListCycles(ctx context.Context, entryID uuid.UUID) ([]models.EntryCycle, error) {
+	query := `SELECT ` + cycleColumns + ` FROM entry_cycles WHERE entry_id = $1 ORDER BY number ASC`
+	rows, err := r.db.QueryContext(ctx, query, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cycles := []models.EntryCycle{}
+	for rows.Next() {
+		cycle, err := scanCycle(rows)
+		if err != nil {
+			return nil, err
+		}
+		cycles = append(cycles, *cycle)
+	}
+	return cycles, rows.Err()
+}
+
+func (r *EntryRepository) GetCycle(ctx context.Context, entryID uuid.UUID, cycleID uuid.UUID) (*models.EntryCycle, error) {
+	query := `SELECT ` + cycleColumns + ` FROM entry_cycles WHERE entry_id = $1 AND id = $2`
+	return scanCycle(r.db.QueryRowContext(ctx, query, entryID, cycleID))
+}
+
+// CurrentCycle returns the latest cycle of an entry, or sql.ErrNoRows if it has none.
+func (r *EntryRepository) CurrentCycle(ctx context.Context, entryID uuid.UUID) (*models.EntryCycle, error) {
+	query := `SELECT ` + cycleColumns + ` FROM entry_cycles WHERE entry_id = $1 ORDER BY number DESC LIMIT 1`
+	return scanCycle(r.db.QueryRowContext(ctx, query, entryID))
+}
+
+// CreateCycle inserts cycle as the next cycle of its entry and sets its number.
+func (r *EntryRepository) CreateCycle(ctx context.Context, cycle *models.EntryCycle) error {
+	query := `INSERT INTO entry_cycles (id, entry_id, number, completed, started_at, finished_at, rating, notes, created_at, updated_at)
+			  VALUES ($1, $2, (SELECT COALESCE(MAX(number), 0) + 1 FROM entry_cycles WHERE entry_id = $2), $3, $4, $5, $6, $7, $8, $9)
+			  RETURNING number`
+	return r.db.QueryRowContext(ctx, query, cycle.ID, cycle.EntryID, cycle.Completed, cycle.StartedAt, cycle.FinishedAt,
+		cycle.Rating, cycle.Notes, cycle.CreatedAt, cycle.UpdatedAt).Scan(&cycle.Number)
+}
+
+func (r *EntryRepository) UpdateCycle(ctx context.Context, cycle *models.EntryCycle) error {
+	query := `UPDATE entry_cycles SET completed = $1, started_at = $2, finished_at = $3, rating = $4, notes = $5, updated_at = $6
+			  WHERE id = $7`
+	_, err := r.db.ExecContext(ctx, query, cycle.Completed, cycle.StartedAt, cycle.FinishedAt, cycle.Rating, cycle.Notes,
+		cycle.UpdatedAt, cycle.ID)
+	return err
+}
+
+func (r *EntryRepository) DeleteCycle(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM entry_cycles WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *EntryRepository) CreateEvent(ctx context.Context, event *models.EntryEvent) error {
+	query := `INSERT INTO entry_events (id, entry_id, user_id, kind, occurred_on, from_status, to_status, progress_from, progress_to, note, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := r.db.ExecContext(ctx, query, event.ID, event.EntryID, event.UserID, event.Kind, event.OccurredOn,
+		event.FromStatus, event.ToStatus, event.ProgressFrom, event.ProgressTo, event.Note, event.CreatedAt)
+	return err
+}
+
+// ListEvents returns a user's diary between two dates (inclusive), newest first,
+// with the media of each event's entry attached.
+func (r *EntryRepository) ListEvents(ctx context.Context, userID uuid.UUID, query models.DiaryQuery) ([]models.EntryEvent, error) {
+	sqlQuery := `SELECT ev.id, ev.entry_id, ev.user_id, ev.kind, ev.occurred_on, ev.from_status, ev.to_status,
+				 ev.progress_from, ev.progress_to, ev.note, ev.created_at,
+				 m.id, m.type, m.title, m.year, m.cover_url
+				 FROM entry_events ev
+				 JOIN entries e ON ev.entry_id = e.id
+				 JOIN media_items m ON e.media_id = m.id
+				 WHERE ev.user_id = $1 AND ev.occurred_on BETWEEN $2 AND $3 AND e.deleted_at IS NULL`
+	args := []interface{}{userID, query.From, query.To}
+
+	if query.EntryID != nil {
+		args = append(args, *query.EntryID)
+		sqlQuery += fmt.Sprintf(" AND ev.entry_id = $%d", len(args))
+	}
+
+	sqlQuery += " ORDER BY ev.occurred_on DESC, ev.created_at DESC"
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.EntryEvent{}
+	for rows.Next() {
+		event := models.EntryEvent{Media: &models.MediaItem{}}
+		err := rows.Scan(&event.ID, &event.EntryID, &event.UserID, &event.Kind, &event.OccurredOn, &event.FromStatus,
+			&event.ToStatus, &event.ProgressFrom, &event.ProgressTo, &event.Note, &event.CreatedAt,
+			&event.Media.ID, &event.Media.Type, &event.Media.Title, &event.Media.Year, &event.Media.CoverURL)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Stats aggregates a user's library: totals per status and type, how often
+// entries were repeated and the average of each sub-rating.
+func (r *EntryRepository) Stats(ctx context.Context, userID uuid.UUID) (*models.EntryStats, error) {
+	stats := &models.EntryStats{
+		ByStatus:     map[models.Status]int{},
+		ByType:       map[models.MediaType]int{},
+		MostRepeated: []models.RepeatedEntryStat{},
+		SubRatings:   []models.SubRatingStat{},
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.status, m.type, COUNT(*)
+		FROM entries e
+		JOIN media_items m ON e.media_id = m.id
+		WHERE e.user_id = $1 AND e.deleted_at IS NULL
+		GROUP BY e.status, m.type`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status models.Status
+		var mediaType models.MediaType
+		var count int
+		if err := rows.Scan(&status, &mediaType, &count); err != nil {
+			return nil, err
+		}
+		stats.TotalEntries += count
+		stats.ByStatus[status] += count
+		stats.ByType[mediaType] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(times), 0), COUNT(*) FILTER (WHERE times > 1)
+		FROM (
+			SELECT c.entry_id, COUNT(*) AS times
+			FROM entry_cycles c
+			JOIN entries e ON c.entry_id = e.id
+			WHERE e.user_id = $1 AND e.deleted_at IS NULL AND c.completed
+			GROUP BY c.entry_id
+		) completions`, userID).Scan(&stats.TotalCompletions, &stats.RepeatedEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	repeated, err := r.db.QueryContext(ctx, `
+		SELECT e.id, m.title, m.type, COUNT(*) AS times
+		FROM entry_cycles c
+		JOIN entries e ON c.entry_id = e.id
+		JOIN media_items m ON e.media_id = m.id
+		WHERE e.user_id = $1 AND e.deleted_at IS NULL AND c.completed
+		GROUP BY e.id, m.title, m.type
+		HAVING COUNT(*) > 1
+		ORDER BY times DESC, m.title
+		LIMIT 10`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer repeated.Close()
+
+	for repeated.Next() {
+		var stat models.RepeatedEntryStat
+		if err := repeated.Scan(&stat.EntryID, &stat.Title, &stat.Type, &stat.TimesCompleted); err != nil {
+			return nil, err
+		}
+		stats.MostRepeated = append(stats.MostRepeated, stat)
+	}
+	if err := repeated.Err(); err != nil {
+		return nil, err
+	}
+
+	subRatings, err := r.db.QueryContext(ctx, `
+		SELECT m.type, s.key, ROUND(AVG(s.value::numeric), 1), COUNT(*)
+		FROM entries e
+		JOIN media_items m ON e.media_id = m.id
+		CROSS JOIN LATERAL jsonb_each_text(e.sub_ratings) s
+		WHERE e.user_id = $1 AND e.deleted_at IS NULL
+		GROUP BY m.type, s.key
+		ORDER BY m.type, s.key`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer subRatings.Close()
+
+	for subRatings.Next() {
+		var stat models.SubRatingStat
+		if err := subRatings.Scan(&stat.MediaType, &stat.Key, &stat.Average, &stat.Entries); err != nil {
+			return nil, err
+		}
+		stats.SubRatings = append(stats.SubRatings, stat)
+	}
+
+	return stats, subRatings.Err()
+}
+
+// FilterOwned reports which of ids are the user's entries and not in the trash.
+func (r *EntryRepository) FilterOwned(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM entries
+		WHERE user_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL`, userID, pq.Array(uuidStrings(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[uuid.UUID]bool, len(ids))
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		owned[id] = true
+	}
+	return owned, rows.Err()
+}
+
+// ListWeightedIDs returns the user's entries of a media type whose overall
+// rating is computed from their sub-ratings.
+func (r *EntryRepository) ListWeightedIDs(ctx context.Context, userID uuid.UUID, mediaType models.MediaType) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.id
+		FROM entries e
+		JOIN media_items m ON e.media_id = m.id
+		WHERE e.user_id = $1 AND m.type = $2 AND e.rating_mode = 'weighted' AND e.deleted_at IS NULL`, userID, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CollectionRepository
+type CollectionRepository struct {
+	db DBTX
+}
+
+func NewCollectionRepository(db *sql.DB) *CollectionRepository {
+	return &CollectionRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *CollectionRepository) WithTx(tx *sql.Tx) *CollectionRepository {
+	return &CollectionRepository{db: tx}
+}
+
+// collectionColumns selects a collection; rows selected with it are read back
+// with scanCollection.
+const collectionColumns = `id, user_id, title, is_public, mode, tiers, rules, description_md, cover_url,
+	source_collection_id, source_title, source_owner_name, created_at, updated_at, version`
+
+// scanCollection reads a row selected with collectionColumns; extra receives
+// any columns selected after them.
+func scanCollection(row rowScanner, extra ...interface{}) (*models.Collection, error) {
+	collection := &models.Collection{}
+	var sourceID uuid.NullUUID
+	var sourceTitle, sourceOwner sql.NullString
+	dest := []interface{}{
+		&collection.ID, &collection.UserID, &collection.Title, &collection.IsPublic, &collection.Mode, pq.Array(&collection.Tiers),
+		&collection.Rules, &collection.DescriptionMD, &collection.CoverURL, &sourceID, &sourceTitle, &sourceOwner,
+		&collection.CreatedAt, &collection.UpdatedAt, &collection.Version,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if sourceTitle.Valid {
+		collection.Source = &models.CollectionSource{Title: sourceTitle.String, OwnerName: sourceOwner.String}
+		if sourceID.Valid {
+			collection.Source.CollectionID = &sourceID.UUID
+		}
+	}
+	return collection, nil
+}
+
+func (r *CollectionRepository) Create(ctx context.Context, collection *models.Collection) error {
+	var sourceID *uuid.UUID
+	var sourceTitle, sourceOwner *string
+	if source := collection.Source; source != nil {
+		sourceID, sourceTitle, sourceOwner = source.CollectionID, &source.Title, &source.OwnerName
+	}
+
+	query := `INSERT INTO collections (id, user_id, title, is_public, mode, tiers, rules, description_md, cover_url,
+			  source_collection_id, source_title, source_owner_name, created_at, updated_at, version)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := r.db.ExecContext(ctx, query, collection.ID, collection.UserID, collection.Title, collection.IsPublic, collection.Mode,
+		pq.Array(collection.Tiers), collection.Rules, collection.DescriptionMD, collection.CoverURL, sourceID, sourceTitle,
+		sourceOwner, collection.CreatedAt, collection.UpdatedAt, collection.Version)
+	return err
+}
+
+func (r *CollectionRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []*models.Collection
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+
+	return collections, nil
+}
+
+// Update saves a collection if it is still at collection.Version, and bumps the
+// version. It returns ErrVersionConflict if the collection was changed since it was read.
+func (r *CollectionRepository) Update(ctx context.Context, collection *models.Collection) error {
+	query := `UPDATE collections SET title = $1, is_public = $2, mode = $3, tiers = $4, rules = $5, description_md = $6,
+			  cover_url = $7, updated_at = $8, version = version + 1
+			  WHERE id = $9 AND version = $10 AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, collection.Title, collection.IsPublic, collection.Mode, pq.Array(collection.Tiers),
+		collection.Rules, collection.DescriptionMD, collection.CoverURL, collection.UpdatedAt, collection.ID, collection.Version)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+	collection.Version++
+	return nil
+}
+
+func (r *CollectionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE id = $1 AND deleted_at IS NULL`
+	return scanCollection(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetByIDWithPublicEntries returns a collection with only its public entries,
+// which is what anyone viewing it through a share link may see.
+func (r *CollectionRepository) GetByIDWithPublicEntries(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
+	collection, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := r.ListEntries(ctx, []uuid.UUID{id}, true)
+	if err != nil {
+		return nil, err
+	}
+	collection.Entries = entries[id]
+	return collection, nil
+}
+
+// AddEntries inserts entries into a collection at positions 0, 1, ... in order.
+func (r *CollectionRepository) AddEntries(ctx context.Context, collectionID uuid.UUID, entryIDs []uuid.UUID) error {
 	query := `INSERT INTO collection_entries (collection_id, entry_id, position) VALUES ($1, $2, $3) ON CONFLICT (collection_id, entry_id) DO NOTHING`
-	for i, entryID := range entryUUIDs {
+	for i, entryID := range entryIDs {
 		_, err := r.db.ExecContext(ctx, query, collectionID, entryID, i)
 		if err != nil {
 			return err
@@ -492,74 +1187,394 @@ func (r *CollectionRepository) AddEntries(ctx context.Context, collectionID uuid
 	return nil
 }
 
+// AddEntry appends an entry to the end of a collection and bumps the collection's
+// version; it is a no-op if the entry is already in it.
+func (r *CollectionRepository) AddEntry(ctx context.Context, collectionID uuid.UUID, entryID uuid.UUID) error {
+	query := `WITH added AS (
+				  INSERT INTO collection_entries (collection_id, entry_id, position)
+				  SELECT $1, $2, COALESCE(MAX(position) + 1, 0) FROM collection_entries WHERE collection_id = $1
+				  ON CONFLICT (collection_id, entry_id) DO NOTHING
+				  RETURNING collection_id
+			  )
+			  UPDATE collections SET version = version + 1, updated_at = NOW() WHERE id = $1 AND EXISTS (SELECT 1 FROM added)`
+	_, err := r.db.ExecContext(ctx, query, collectionID, entryID)
+	return err
+}
+
+// RemoveEntry takes an entry out of a collection and bumps the collection's
+// version; it is a no-op if the entry is not in it.
+func (r *CollectionRepository) RemoveEntry(ctx context.Context, collectionID uuid.UUID, entryID uuid.UUID) error {
+	query := `WITH removed AS (
+				  DELETE FROM collection_entries WHERE collection_id = $1 AND entry_id = $2
+				  RETURNING collection_id
+			  )
+			  UPDATE collections SET version = version + 1, updated_at = NOW() WHERE id = $1 AND EXISTS (SELECT 1 FROM removed)`
+	_, err := r.db.ExecContext(ctx, query, collectionID, entryID)
+	return err
+}
+
+// ListSlots returns every entry of a collection, including those in the trash,
+// in order.
+func (r *CollectionRepository) ListSlots(ctx context.Context, collectionID uuid.UUID) ([]models.CollectionSlot, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT entry_id, tier FROM collection_entries
+		WHERE collection_id = $1
+		ORDER BY position, entry_id`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []models.CollectionSlot
+	for rows.Next() {
+		var slot models.CollectionSlot
+		if err := rows.Scan(&slot.EntryID, &slot.Tier); err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, rows.Err()
+}
+
+// WriteSlots numbers the given entries of a collection 0, 1, ... in order and
+// sets their tiers, adding the ones not in it yet.
+func (r *CollectionRepository) WriteSlots(ctx context.Context, collectionID uuid.UUID, slots []models.CollectionSlot) error {
+	entryIDs := make([]string, len(slots))
+	tiers := make([]string, len(slots))
+	for i, slot := range slots {
+		entryIDs[i] = slot.EntryID.String()
+		if slot.Tier != nil {
+			tiers[i] = *slot.Tier
+		}
+	}
+
+	query := `INSERT INTO collection_entries (collection_id, entry_id, position, tier)
+			  SELECT $1, s.entry_id, s.ord - 1, NULLIF(s.tier, '')
+			  FROM unnest($2::uuid[], $3::text[]) WITH ORDINALITY AS s(entry_id, tier, ord)
+			  ON CONFLICT (collection_id, entry_id) DO UPDATE SET position = EXCLUDED.position, tier = EXCLUDED.tier`
+	_, err := r.db.ExecContext(ctx, query, collectionID, pq.Array(entryIDs), pq.Array(tiers))
+	return err
+}
+
+// Touch bumps a collection's version after a change to its entries.
+func (r *CollectionRepository) Touch(ctx context.Context, collectionID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE collections SET version = version + 1, updated_at = NOW() WHERE id = $1`, collectionID)
+	return err
+}
+
+// SetEntryNote sets the curator's note on an entry of a collection, clearing it
+// when note is nil, and reports whether the entry is in the collection.
+func (r *CollectionRepository) SetEntryNote(ctx context.Context, collectionID uuid.UUID, entryID uuid.UUID, note *string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE collection_entries SET note = $3 WHERE collection_id = $1 AND entry_id = $2`,
+		collectionID, entryID, note)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RetainEntries takes every entry not in entryIDs out of a collection. The
+// entries that stay keep their tiers and notes.
+func (r *CollectionRepository) RetainEntries(ctx context.Context, collectionID uuid.UUID, entryIDs []uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM collection_entries WHERE collection_id = $1 AND NOT (entry_id = ANY($2::uuid[]))`,
+		collectionID, pq.Array(uuidStrings(entryIDs)))
+	return err
+}
+
 func (r *CollectionRepository) RemoveEntries(ctx context.Context, collectionID uuid.UUID) error {
 	query := `DELETE FROM collection_entries WHERE collection_id = $1`
 	_, err := r.db.ExecContext(ctx, query, collectionID)
 	return err
 }
 
-func (r *CollectionRepository) GetEntries(ctx context.Context, collectionID uuid.UUID) ([]*models.Entry, error) {
-	query := `
-		SELECT e.id, e.user_id, e.media_id, e.status, e.rating, e.review_md, e.progress, 
-		       e.started_at, e.finished_at, e.updated_at,
-		       m.id, m.type, m.title, m.original_title, m.year, m.cover_url, m.creators, m.genres, 
-		       m.duration, m.metadata, m.created_at
-		FROM collection_entries ce
-		JOIN entries e ON ce.entry_id = e.id
-		JOIN media_items m ON e.media_id = m.id
-		WHERE ce.collection_id = $1
-		ORDER BY ce.position ASC
-	`
+// GetEntries returns the entries of a collection, in order.
+func (r *CollectionRepository) GetEntries(ctx context.Context, collectionID uuid.UUID) ([]models.Entry, error) {
+	entries, err := r.ListEntries(ctx, []uuid.UUID{collectionID}, false)
+	if err != nil {
+		return nil, err
+	}
+	return entries[collectionID], nil
+}
 
-	rows, err := r.db.QueryContext(ctx, query, collectionID)
+// ListEntries returns the entries of many collections with their media, each
+// collection's in order, in one query. Entries in the trash are left out, and
+// so are entries that are not public when publicOnly is set; those also come
+// without their private notes.
+func (r *CollectionRepository) ListEntries(ctx context.Context, collectionIDs []uuid.UUID, publicOnly bool) (map[uuid.UUID][]models.Entry, error) {
+	entries := make(map[uuid.UUID][]models.Entry, len(collectionIDs))
+	if len(collectionIDs) == 0 {
+		return entries, nil
+	}
+
+	query := `SELECT ` + entryWithMediaColumns + `, ce.collection_id, ce.tier, ce.note
+			  FROM collection_entries ce
+			  JOIN entries e ON ce.entry_id = e.id
+			  JOIN media_items m ON e.media_id = m.id
+			  WHERE ce.collection_id = ANY($1::uuid[]) AND e.deleted_at IS NULL AND (NOT $2 OR e.visibility = 'public')
+			  ORDER BY ce.collection_id, ce.position, ce.entry_id`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(uuidStrings(collectionIDs)), publicOnly)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var entries []*models.Entry
 	for rows.Next() {
-		entry := &models.Entry{Media: &models.MediaItem{}}
-		var genresBytes []byte
+		var collectionID uuid.UUID
+		var tier, note *string
+		entry, err := scanEntryWithMedia(rows, &collectionID, &tier, &note)
+		if err != nil {
+			return nil, err
+		}
+		entry.Tier, entry.CuratorNote = tier, note
+		if publicOnly {
+			entry.PrivateNotes = nil
+		}
+		entries[collectionID] = append(entries[collectionID], *entry)
+	}
+	return entries, rows.Err()
+}
 
-		err := rows.Scan(
-			&entry.ID, &entry.UserID, &entry.MediaID, &entry.Status, &entry.Rating, &entry.ReviewMD, &entry.Progress,
-			&entry.StartedAt, &entry.FinishedAt, &entry.UpdatedAt,
-			&entry.Media.ID, &entry.Media.Type, &entry.Media.Title, &entry.Media.OriginalTitle, &entry.Media.Year,
-			&entry.Media.CoverURL, &entry.Media.Creators, &genresBytes, &entry.Media.Duration, &entry.Media.Metadata, &entry.Media.CreatedAt)
+// ListSummaries summarizes the entries of many static collections in one
+// query: how many viewerID may see of each (their own entries, and others'
+// that are not private) and the distinct covers of the first covers of them.
+func (r *CollectionRepository) ListSummaries(ctx context.Context, collectionIDs []uuid.UUID, viewerID uuid.UUID,
+	covers int) (map[uuid.UUID]models.CollectionSummary, error) {
+	summaries := make(map[uuid.UUID]models.CollectionSummary, len(collectionIDs))
+	if len(collectionIDs) == 0 {
+		return summaries, nil
+	}
+
+	query := `WITH visible AS (
+				  SELECT ce.collection_id, ce.position, ce.entry_id, m.cover_url
+				  FROM collection_entries ce
+				  JOIN entries e ON ce.entry_id = e.id
+				  JOIN media_items m ON e.media_id = m.id
+				  WHERE ce.collection_id = ANY($1::uuid[]) AND e.deleted_at IS NULL
+				    AND (e.user_id = $2 OR e.visibility <> 'private')
+			  )
+			  SELECT v.collection_id, COUNT(*),
+			         ARRAY(SELECT c.cover_url FROM (
+			                   SELECT DISTINCT ON (w.cover_url) w.cover_url, w.position, w.entry_id
+			                   FROM visible w
+			                   WHERE w.collection_id = v.collection_id AND w.cover_url <> ''
+			                   ORDER BY w.cover_url, w.position, w.entry_id
+			               ) c
+			               ORDER BY c.position, c.entry_id LIMIT $3)
+			  FROM visible v
+			  GROUP BY v.collection_id`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(uuidStrings(collectionIDs)), viewerID, covers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collectionID uuid.UUID
+		var summary models.CollectionSummary
+		if err := rows.Scan(&collectionID, &summary.EntryCount, pq.Array(&summary.Covers)); err != nil {
+			return nil, err
+		}
+		summaries[collectionID] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// ListShared returns the collections shared with a user, each with the
+// user's role in it.
+func (r *CollectionRepository) ListShared(ctx context.Context, userID uuid.UUID) ([]*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + `,
+			  (SELECT role FROM collection_members WHERE collection_id = collections.id AND user_id = $1)
+			  FROM collections
+			  WHERE id IN (SELECT collection_id FROM collection_members WHERE user_id = $1) AND deleted_at IS NULL
+			  ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []*models.Collection
+	for rows.Next() {
+		var role models.CollectionRole
+		collection, err := scanCollection(rows, &role)
 		if err != nil {
 			return nil, err
 		}
+		collection.Role = role
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
 
-		// Parse genres from PostgreSQL array
-		if genresBytes != nil {
-			genresStr := string(genresBytes)
-			if len(genresStr) >= 2 && genresStr[0] == '{' && genresStr[len(genresStr)-1] == '}' {
-				genresStr = genresStr[1 : len(genresStr)-1]
-				if genresStr != "" {
-					entry.Media.Genres = strings.Split(genresStr, ",")
-					for i, genre := range entry.Media.Genres {
-						entry.Media.Genres[i] = strings.TrimSpace(genre)
-					}
-				}
-			}
+// MemberRole returns a user's role in a collection they are a member of, or ""
+// if they are not one.
+func (r *CollectionRepository) MemberRole(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) (models.CollectionRole, error) {
+	var role models.CollectionRole
+	err := r.db.QueryRowContext(ctx, `SELECT role FROM collection_members WHERE collection_id = $1 AND user_id = $2`,
+		collectionID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// ListMembers returns the members of a collection, oldest first. The owner is
+// not one of them.
+func (r *CollectionRepository) ListMembers(ctx context.Context, collectionID uuid.UUID) ([]models.CollectionMember, error) {
+	query := `SELECT m.user_id, u.name, u.email, m.role, m.created_at
+			  FROM collection_members m
+			  JOIN users u ON u.id = m.user_id
+			  WHERE m.collection_id = $1
+			  ORDER BY m.created_at, m.user_id`
+	rows, err := r.db.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.CollectionMember{}
+	for rows.Next() {
+		var member models.CollectionMember
+		if err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.Role, &member.AddedAt); err != nil {
+			return nil, err
 		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
 
-		entries = append(entries, entry)
+// UpsertMember adds a member to a collection, or changes their role.
+func (r *CollectionRepository) UpsertMember(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID, role models.CollectionRole,
+	addedBy uuid.UUID) error {
+	query := `INSERT INTO collection_members (collection_id, user_id, role, added_by)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (collection_id, user_id) DO UPDATE SET role = EXCLUDED.role`
+	_, err := r.db.ExecContext(ctx, query, collectionID, userID, role, addedBy)
+	return err
+}
+
+// RemoveMember takes a member out of a collection, along with the entries of
+// theirs in it, and reports whether they were a member.
+func (r *CollectionRepository) RemoveMember(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM collection_members WHERE collection_id = $1 AND user_id = $2`, collectionID, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil || removed == 0 {
+		return false, err
 	}
 
-	return entries, nil
+	query := `DELETE FROM collection_entries ce USING entries e
+			  WHERE ce.collection_id = $1 AND ce.entry_id = e.id AND e.user_id = $2`
+	if _, err := r.db.ExecContext(ctx, query, collectionID, userID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddMemberEvent records a membership change.
+func (r *CollectionRepository) AddMemberEvent(ctx context.Context, event *models.CollectionMemberEvent) error {
+	query := `INSERT INTO collection_member_events (collection_id, actor_id, user_id, action, role)
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, event.CollectionID, event.ActorID, event.UserID, event.Action, event.Role).
+		Scan(&event.ID, &event.CreatedAt)
 }
 
-func (r *CollectionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM collections WHERE id = $1`
+// ListMemberEvents returns the membership changes of a collection, newest first.
+func (r *CollectionRepository) ListMemberEvents(ctx context.Context, collectionID uuid.UUID) ([]models.CollectionMemberEvent, error) {
+	query := `SELECT ev.id, ev.collection_id, ev.actor_id, COALESCE(actor.name, ''), ev.user_id, COALESCE(member.name, ''),
+			  ev.action, ev.role, ev.created_at
+			  FROM collection_member_events ev
+			  LEFT JOIN users actor ON actor.id = ev.actor_id
+			  LEFT JOIN users member ON member.id = ev.user_id
+			  WHERE ev.collection_id = $1
+			  ORDER BY ev.created_at DESC, ev.id DESC`
+	rows, err := r.db.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.CollectionMemberEvent{}
+	for rows.Next() {
+		var event models.CollectionMemberEvent
+		if err := rows.Scan(&event.ID, &event.CollectionID, &event.ActorID, &event.ActorName, &event.UserID, &event.UserName,
+			&event.Action, &event.Role, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Delete moves a collection at the given version to the trash, keeping its entries in it.
+func (r *CollectionRepository) Delete(ctx context.Context, id uuid.UUID, version int) error {
+	query := `UPDATE collections SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// ListTrash returns a user's trashed collections, most recently deleted first.
+func (r *CollectionRepository) ListTrash(ctx context.Context, userID uuid.UUID) ([]*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + `, deleted_at FROM collections
+			  WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []*models.Collection
+	for rows.Next() {
+		var deletedAt *time.Time
+		collection, err := scanCollection(rows, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		collection.DeletedAt = deletedAt
+		collections = append(collections, collection)
+	}
+
+	return collections, rows.Err()
+}
+
+// GetTrashed returns a collection that is in the trash.
+func (r *CollectionRepository) GetTrashed(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
+	query := `SELECT ` + collectionColumns + `, deleted_at FROM collections WHERE id = $1 AND deleted_at IS NOT NULL`
+	var deletedAt *time.Time
+	collection, err := scanCollection(r.db.QueryRowContext(ctx, query, id), &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	collection.DeletedAt = deletedAt
+	return collection, nil
+}
+
+// Restore takes a collection out of the trash.
+func (r *CollectionRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE collections SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
 	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
+// Purge permanently deletes collections trashed before the given time.
+func (r *CollectionRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM collections WHERE deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // ShareRepository
 type ShareRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewShareRepository(db *sql.DB) *ShareRepository {
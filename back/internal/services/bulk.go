@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"media-tracker/internal/models"
+	"media-tracker/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// maxBulkItems caps the number of (operation, entry) pairs in one bulk request.
+const maxBulkItems = 1000
+
+const maxTagLength = 50
+
+// errBulkFailed rolls back a bulk transaction in which some item failed.
+var errBulkFailed = errors.New("bulk operation failed")
+
+// Bulk applies a batch of operations to the user's entries in one transaction.
+// Operations run in order, each on every one of its entries. Every item is
+// attempted, in its own savepoint, so the result reports all failures; if any
+// item failed the whole batch is rolled back and Applied is false.
+func (s *EntryService) Bulk(ctx context.Context, userID uuid.UUID, req *models.BulkEntryRequest) (*models.BulkEntryResult, error) {
+	total := 0
+	for _, op := range req.Operations {
+		total += len(op.EntryIDs)
+	}
+	if total > maxBulkItems {
+		return nil, fmt.Errorf("%w: a bulk request can change at most %d items", ErrValidation, maxBulkItems)
+	}
+
+	result := &models.BulkEntryResult{Results: make([]models.BulkItemResult, 0, total)}
+
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		failed := false
+
+		for i := range req.Operations {
+			op := &req.Operations[i]
+			opErr := txService.prepareBulkOperation(ctx, userID, op)
+
+			for _, entryID := range op.EntryIDs {
+				err := opErr
+				if err == nil {
+					err = repository.Savepoint(ctx, tx, "bulk_item", func() error {
+						return txService.applyBulkOperation(ctx, userID, op, entryID)
+					})
+				}
+
+				item := models.BulkItemResult{Operation: i, EntryID: entryID, OK: err == nil}
+				if err != nil {
+					if errors.Is(err, sql.ErrNoRows) {
+						err = ErrNotFound
+					}
+					if !errors.Is(err, ErrValidation) && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrStale) {
+						return err
+					}
+					item.Error = err.Error()
+					failed = true
+				}
+				result.Results = append(result.Results, item)
+			}
+		}
+
+		if failed {
+			return errBulkFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBulkFailed) {
+		return nil, err
+	}
+
+	result.Applied = err == nil
+	if result.Applied {
+		s.events.publishAll(ctx, userID, bulkEvents(req))
+	}
+	return result, nil
+}
+
+// bulkEvents lists the change events of an applied bulk request. Updated
+// entries are announced without their new state; clients fetch it from the
+// change feed.
+func bulkEvents(req *models.BulkEntryRequest) []pendingEvent {
+	var events []pendingEvent
+	for _, op := range req.Operations {
+		switch op.Action {
+		case models.BulkActionDelete:
+			for _, entryID := range op.EntryIDs {
+				events = append(events, pendingEvent{eventType: models.ChangeEntryDeleted, id: entryID})
+			}
+		case models.BulkActionAddToCollection:
+			if len(op.EntryIDs) > 0 {
+				events = append(events, pendingEvent{eventType: models.ChangeCollectionUpdated, id: *op.CollectionID})
+			}
+		default:
+			for _, entryID := range op.EntryIDs {
+				events = append(events, pendingEvent{eventType: models.ChangeEntryUpdated, id: entryID})
+			}
+		}
+	}
+	return events
+}
+
+// prepareBulkOperation validates an operation and normalizes its arguments
+// before it is applied to any entry.
+func (s *EntryService) prepareBulkOperation(ctx context.Context, userID uuid.UUID, op *models.BulkOperation) error {
+	switch op.Action {
+	case models.BulkActionStatus:
+		if op.Status == nil || !op.Status.Valid() {
+			return fmt.Errorf("%w: the status action needs a valid status", ErrValidation)
+		}
+	case models.BulkActionRating:
+		if !op.Rating.Set {
+			return fmt.Errorf("%w: the rating action needs a rating (or null to clear it)", ErrValidation)
+		}
+		// The rating is converted from the user's scale when each entry is updated.
+		settings, err := s.userRepo.GetSettings(ctx, userID)
+		if err != nil {
+			return err
+		}
+		_, err = canonicalRating(settings.RatingScale, op.Rating.Ptr())
+		return err
+	case models.BulkActionDelete:
+	case models.BulkActionAddToCollection:
+		if op.CollectionID == nil {
+			return fmt.Errorf("%w: the add_to_collection action needs a collection_id", ErrValidation)
+		}
+		collection, err := s.collectionRepo.GetByID(ctx, *op.CollectionID)
+		if err != nil {
+			return err
+		}
+		if collection.UserID != userID {
+			// Editors may add their entries to collections shared with them.
+			role, err := s.collectionRepo.MemberRole(ctx, collection.ID, userID)
+			if err != nil {
+				return err
+			}
+			if role == "" {
+				return ErrNotFound
+			}
+			if !role.Includes(models.CollectionRoleEditor) {
+				return fmt.Errorf("%w: this needs the editor role in the collection", ErrForbidden)
+			}
+		}
+		if collection.Rules != nil {
+			return errSmartCollection
+		}
+	case models.BulkActionTag:
+		tags, err := normalizeTags(op.Tags)
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return fmt.Errorf("%w: the tag action needs at least one tag", ErrValidation)
+		}
+		op.Tags = tags
+	case models.BulkActionVisibility:
+		if op.Visibility == nil || !op.Visibility.Valid() {
+			return fmt.Errorf("%w: the visibility action needs a valid visibility", ErrValidation)
+		}
+	default:
+		return fmt.Errorf("%w: unknown bulk action %q", ErrValidation, op.Action)
+	}
+	return nil
+}
+
+// applyBulkOperation applies a prepared operation to one entry.
+func (s *EntryService) applyBulkOperation(ctx context.Context, userID uuid.UUID, op *models.BulkOperation, entryID uuid.UUID) error {
+	entry, err := s.getOwnedEntry(ctx, userID, entryID)
+	if err != nil {
+		return err
+	}
+
+	switch op.Action {
+	case models.BulkActionStatus:
+		_, err := s.Update(ctx, userID, entryID, &models.UpdateEntryRequest{Status: models.Some(*op.Status)}, nil)
+		return err
+	case models.BulkActionRating:
+		_, err := s.Update(ctx, userID, entryID, &models.UpdateEntryRequest{Rating: op.Rating}, nil)
+		return err
+	case models.BulkActionDelete:
+		return s.entryRepo.Delete(ctx, entryID, entry.Version)
+	case models.BulkActionAddToCollection:
+		return s.collectionRepo.AddEntry(ctx, *op.CollectionID, entryID)
+	case models.BulkActionTag:
+		return s.entryRepo.AddTags(ctx, entryID, op.Tags)
+	case models.BulkActionVisibility:
+		_, err := s.Update(ctx, userID, entryID, &models.UpdateEntryRequest{Visibility: models.Some(*op.Visibility)}, nil)
+		return err
+	}
+	return nil
+}
+
+// normalizeTags trims and lowercases tags and drops duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrValidation, tag, maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", tags: nil, want: []string{}},
+		{name: "only blanks", tags: []string{"", "  "}, want: []string{}},
+		{name: "trims, lowercases and dedupes", tags: []string{" Cozy", "cozy ", "Rainy Day"}, want: []string{"cozy", "rainy day"}},
+		{name: "longest tag", tags: []string{strings.Repeat("x", maxTagLength)}, want: []string{strings.Repeat("x", maxTagLength)}},
+		{name: "too long", tags: []string{strings.Repeat("x", maxTagLength+1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.tags)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareBulkTagOperation(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "normalized tags", tags: []string{" Cozy", "cozy"}, want: []string{"cozy"}},
+		{name: "no tags", tags: nil, wantErr: true},
+		{name: "only blank tags", tags: []string{" "}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &models.BulkOperation{Action: models.BulkActionTag, EntryIDs: []uuid.UUID{uuid.New()}, Tags: tt.tags}
+			err := (&EntryService{}).prepareBulkOperation(context.Background(), uuid.New(), op)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(op.Tags, tt.want) {
+				t.Errorf("tags = %q, want %q", op.Tags, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Clone copies a shared collection, as its share shows it, into a private
+// collection of the user's that credits it as the source. Each entry of the
+// copy is the user's own entry for the same media: their existing one, left as
+// it is, or a new planned one. The copy keeps the order, tiers and curator
+// notes; a smart collection becomes a static list of the entries it matched.
+func (s *CollectionService) Clone(ctx context.Context, userID uuid.UUID, source *models.Collection) (*models.Collection, error) {
+	owner, err := s.userRepo.GetByID(ctx, source.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	collection := &models.Collection{
+		ID:            uuid.New(),
+		UserID:        userID,
+		Title:         source.Title,
+		Mode:          source.Mode,
+		Tiers:         source.Tiers,
+		DescriptionMD: source.DescriptionMD,
+		CoverURL:      source.CoverURL,
+		Source:        &models.CollectionSource{CollectionID: &source.ID, Title: source.Title, OwnerName: owner.Name},
+		Role:          models.CollectionRoleOwner,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Version:       1,
+	}
+
+	var created []*models.Entry
+	err = s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		if err := txService.collectionRepo.Create(ctx, collection); err != nil {
+			return err
+		}
+
+		var slots []models.CollectionSlot
+		notes := make(map[uuid.UUID]*string)
+		seen := make(map[uuid.UUID]bool)
+		for _, sourceEntry := range source.Entries {
+			// Members' entries for the same media become one entry of the user's.
+			if seen[sourceEntry.MediaID] {
+				continue
+			}
+			seen[sourceEntry.MediaID] = true
+
+			entryID, entry, err := txService.trackMedia(ctx, userID, sourceEntry.MediaID)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				created = append(created, entry)
+			}
+			slots = append(slots, models.CollectionSlot{EntryID: entryID, Tier: sourceEntry.Tier})
+			notes[entryID] = sourceEntry.CuratorNote
+		}
+
+		if err := txService.collectionRepo.WriteSlots(ctx, collection.ID, slots); err != nil {
+			return err
+		}
+		for entryID, note := range notes {
+			if note == nil {
+				continue
+			}
+			if _, err := txService.collectionRepo.SetEntryNote(ctx, collection.ID, entryID, note); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range created {
+		s.events.Publish(ctx, userID, models.ChangeEntryCreated, entry.ID, entry)
+	}
+	if err := s.loadEntries(ctx, collection, userID); err != nil {
+		return nil, err
+	}
+	s.events.Publish(ctx, userID, models.ChangeCollectionCreated, collection.ID, collection)
+	return collection, nil
+}
+
+// trackMedia returns the ID of the user's entry for a media item, adding a
+// planned entry, which it also returns, if they have none.
+func (s *CollectionService) trackMedia(ctx context.Context, userID uuid.UUID, mediaID uuid.UUID) (uuid.UUID, *models.Entry, error) {
+	existing, err := s.entryRepo.ListByUserAndMedia(ctx, userID, mediaID)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	if len(existing) > 0 {
+		return existing[0].ID, nil, nil
+	}
+
+	entry, err := s.entries.Create(ctx, userID, &models.CreateEntryRequest{MediaID: mediaID, Status: models.StatusPlanned})
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	return entry.ID, entry, nil
+}
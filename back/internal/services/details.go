@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"media-tracker/internal/markdown"
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxDescriptionLength and maxCuratorNoteLength cap, in characters, the
+	// description of a collection and the notes on its entries.
+	maxDescriptionLength = 10000
+	maxCuratorNoteLength = 1000
+
+	// coverMosaicSize is how many entry covers a collection without a cover of
+	// its own shows.
+	coverMosaicSize = 4
+)
+
+// applyCollectionDetails sets the description and cover req gives. Unset
+// fields keep their value; empty ones clear it.
+func applyCollectionDetails(collection *models.Collection, req *models.CreateCollectionRequest) error {
+	if req.DescriptionMD != nil {
+		description := strings.TrimSpace(*req.DescriptionMD)
+		if utf8.RuneCountInString(description) > maxDescriptionLength {
+			return fmt.Errorf("%w: description must be at most %d characters", ErrValidation, maxDescriptionLength)
+		}
+		collection.DescriptionMD = optionalString(description)
+	}
+	if req.CoverURL != nil {
+		cover := strings.TrimSpace(*req.CoverURL)
+		if cover != "" {
+			parsed, err := url.Parse(cover)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("%w: cover_url must be an http(s) URL", ErrValidation)
+			}
+		}
+		collection.CoverURL = optionalString(cover)
+	}
+	return nil
+}
+
+// optionalString returns nil for an empty string.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// renderDescription fills in the sanitized HTML of a collection's description.
+func renderDescription(collection *models.Collection) {
+	collection.DescriptionHTML = markdown.RenderPtr(collection.DescriptionMD)
+}
+
+// setCoverMosaic gives a collection without a cover of its own the distinct
+// covers of its first entries, in order.
+func setCoverMosaic(collection *models.Collection) {
+	collection.CoverMosaic = nil
+	if collection.CoverURL != nil {
+		return
+	}
+	for _, entry := range collection.Entries {
+		if entry.Media == nil || entry.Media.CoverURL == nil || *entry.Media.CoverURL == "" {
+			continue
+		}
+		if !slices.Contains(collection.CoverMosaic, *entry.Media.CoverURL) {
+			collection.CoverMosaic = append(collection.CoverMosaic, *entry.Media.CoverURL)
+		}
+		if len(collection.CoverMosaic) == coverMosaicSize {
+			return
+		}
+	}
+}
+
+// SetEntryNote sets the note saying why an entry is in a collection the user
+// may edit, and returns the collection. An empty note clears it.
+func (s *CollectionService) SetEntryNote(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryID uuid.UUID,
+	req *models.CollectionEntryNoteRequest) (*models.Collection, error) {
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > maxCuratorNoteLength {
+		return nil, fmt.Errorf("%w: note must be at most %d characters", ErrValidation, maxCuratorNoteLength)
+	}
+
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		if _, err := txService.getStatic(ctx, id, userID); err != nil {
+			return err
+		}
+		found, err := txService.collectionRepo.SetEntryNote(ctx, id, entryID, optionalString(note))
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrNotFound
+		}
+		return txService.collectionRepo.Touch(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reloadAndPublish(ctx, id, userID)
+}
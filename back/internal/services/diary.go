@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// LogSession records a consumption session on an entry ("read pages 120-180 on Oct 3").
+// The session progress is merged into the entry's progress (as a JSON Merge Patch)
+// and the entry is updated.
+func (s *EntryService) LogSession(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, req *models.LogSessionRequest) (*models.EntryEvent, error) {
+	entry, err := s.getOwnedEntry(ctx, userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Progress) == 0 && req.Status == nil && req.Note == nil {
+		return nil, fmt.Errorf("%w: a session needs progress, a status or a note", ErrValidation)
+	}
+
+	before := *entry
+	now := time.Now()
+	occurredOn := truncateToDate(now)
+	if req.Date != nil {
+		occurredOn = truncateToDate(*req.Date)
+	}
+
+	if len(req.Progress) > 0 {
+		entry.Progress = entry.Progress.MergePatch(req.Progress)
+	}
+	if req.Status != nil {
+		entry.Status = *req.Status
+		if err := validateTransition(before.Status, entry.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	settings, err := s.userRepo.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	applyTransitionRules(entry, &before, settings, occurredOn)
+
+	if err := validateEntry(entry); err != nil {
+		return nil, err
+	}
+
+	event := &models.EntryEvent{
+		ID:         uuid.New(),
+		EntryID:    entry.ID,
+		UserID:     userID,
+		Kind:       models.EventKindSession,
+		OccurredOn: occurredOn,
+		Note:       req.Note,
+		CreatedAt:  now,
+	}
+	if !equalProgress(before.Progress, entry.Progress) {
+		event.ProgressFrom = before.Progress
+		event.ProgressTo = entry.Progress
+	}
+	if before.Status != entry.Status {
+		event.FromStatus = &before.Status
+		event.ToStatus = &entry.Status
+	}
+
+	entry.UpdatedAt = now
+	if err := s.entryRepo.Update(ctx, entry); err != nil {
+		return nil, err
+	}
+	if event.ToStatus != nil {
+		if err := s.syncCurrentCycle(ctx, entry, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.entryRepo.CreateEvent(ctx, event); err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(ctx, userID, models.ChangeEntryUpdated, entry.ID, entry)
+
+	event.Media = entry.Media
+	event.Summary = describeEvent(entry.Media.Type, event)
+	return event, nil
+}
+
+// Diary returns the user's dated events across all entries in the query's date range.
+func (s *EntryService) Diary(ctx context.Context, userID uuid.UUID, query models.DiaryQuery) ([]models.EntryEvent, error) {
+	if query.To.Before(query.From) {
+		return nil, fmt.Errorf("%w: 'to' is before 'from'", ErrValidation)
+	}
+
+	events, err := s.entryRepo.ListEvents(ctx, userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		events[i].Summary = describeEvent(events[i].Media.Type, &events[i])
+	}
+
+	return events, nil
+}
+
+// recordChanges writes diary events for the status and progress changes between
+// before and after. before is nil for a newly created entry.
+func (s *EntryService) recordChanges(ctx context.Context, before *models.Entry, after *models.Entry) error {
+	now := time.Now()
+	today := truncateToDate(now)
+
+	var fromStatus *models.Status
+	var fromProgress models.JSONB
+	if before != nil {
+		status := before.Status
+		fromStatus = &status
+		fromProgress = before.Progress
+	}
+
+	if fromStatus == nil || *fromStatus != after.Status {
+		toStatus := after.Status
+		err := s.entryRepo.CreateEvent(ctx, &models.EntryEvent{
+			ID:         uuid.New(),
+			EntryID:    after.ID,
+			UserID:     after.UserID,
+			Kind:       models.EventKindStatus,
+			OccurredOn: today,
+			FromStatus: fromStatus,
+			ToStatus:   &toStatus,
+			CreatedAt:  now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !equalProgress(fromProgress, after.Progress) {
+		err := s.entryRepo.CreateEvent(ctx, &models.EntryEvent{
+			ID:           uuid.New(),
+			EntryID:      after.ID,
+			UserID:       after.UserID,
+			Kind:         models.EventKindProgress,
+			OccurredOn:   today,
+			ProgressFrom: fromProgress,
+			ProgressTo:   after.Progress,
+			CreatedAt:    now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func equalProgress(a, b models.JSONB) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+var statusVerbs = map[models.Status]string{
+	models.StatusPlanned:    "planned",
+	models.StatusInProgress: "started",
+	models.StatusCompleted:  "finished",
+	models.StatusOnHold:     "put on hold",
+	models.StatusDropped:    "dropped",
+}
+
+// describeEvent renders a short human-readable line for a diary event,
+// e.g. "read pages 120–180" or "watched S02E04".
+func describeEvent(mediaType models.MediaType, event *models.EntryEvent) string {
+	var parts []string
+
+	if event.ProgressTo != nil {
+		if progress := describeProgress(mediaType, event.ProgressFrom, event.ProgressTo); progress != "" {
+			parts = append(parts, progress)
+		}
+	}
+
+	if event.ToStatus != nil {
+		if event.FromStatus != nil && *event.FromStatus == models.StatusCompleted && *event.ToStatus == models.StatusInProgress {
+			parts = append(parts, "started again")
+		} else {
+			parts = append(parts, statusVerbs[*event.ToStatus])
+		}
+	}
+
+	if len(parts) == 0 && event.Note != nil {
+		parts = append(parts, "added a note")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func describeProgress(mediaType models.MediaType, from, to models.JSONB) string {
+	switch mediaType {
+	case models.MediaTypeBook:
+		if r := describeRange("read pages", from, to, "pages"); r != "" {
+			return r
+		}
+		return describeRange("read chapters", from, to, "chapters")
+	case models.MediaTypeTV, models.MediaTypeAnime:
+		var p models.EpisodeProgress
+		if decodeProgress(to, &p) == nil && p.Season != nil && p.Episode != nil {
+			return fmt.Sprintf("watched S%02dE%02d", *p.Season, *p.Episode)
+		}
+		return describeRange("watched episodes", from, to, "episodes")
+	case models.MediaTypeGame:
+		fromHours, toHours := progressNumber(from, "hours"), progressNumber(to, "hours")
+		if toHours != nil && fromHours != nil && *toHours > *fromHours {
+			return fmt.Sprintf("played %s hours", formatNumber(*toHours-*fromHours))
+		}
+		if percent := progressNumber(to, "percent"); percent != nil {
+			return fmt.Sprintf("reached %s%%", formatNumber(*percent))
+		}
+		if toHours != nil {
+			return fmt.Sprintf("played %s hours in total", formatNumber(*toHours))
+		}
+		return describeRange("unlocked achievements", from, to, "achievements")
+	case models.MediaTypeVideo, models.MediaTypeMovie:
+		return describeRange("watched minutes", from, to, "minutes")
+	}
+	return ""
+}
+
+// describeRange formats "verb a–b" for a counter that moved forward, or "verb up to b".
+func describeRange(verb string, from, to models.JSONB, key string) string {
+	end := progressNumber(to, key)
+	if end == nil {
+		return ""
+	}
+	start := progressNumber(from, key)
+	if start != nil && *start < *end {
+		return fmt.Sprintf("%s %s–%s", verb, formatNumber(*start), formatNumber(*end))
+	}
+	return fmt.Sprintf("%s up to %s", verb, formatNumber(*end))
+}
+
+func progressNumber(progress models.JSONB, key string) *float64 {
+	if progress == nil {
+		return nil
+	}
+	if value, ok := progress[key].(float64); ok {
+		return &value
+	}
+	return nil
+}
+
+func formatNumber(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", v), "0"), ".")
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+const (
+	eventChannelPrefix = "events:"
+	// eventBufferSize is how many events a stream may fall behind by before it
+	// is dropped; the client then reconnects and catches up from the change feed.
+	eventBufferSize = 64
+)
+
+// EventBus carries change events to users' live event streams. Events are
+// published through Redis pub/sub, so a stream receives the events of writes
+// made on any server instance. Each instance holds one Redis subscription,
+// to the channels of the users with a stream open on it, and fans events out
+// to those streams.
+//
+// Delivery is best-effort: clients should use the change feed to catch up
+// after reconnecting. A nil *EventBus publishes nothing, which is what the
+// transaction-scoped copies of the services use so that nothing is announced
+// before it is committed.
+type EventBus struct {
+	redis  *redis.Client
+	logger *zerolog.Logger
+	pubsub *redis.PubSub
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan models.ChangeEvent]struct{}
+	closed      bool
+}
+
+func NewEventBus(client *redis.Client, logger *zerolog.Logger) *EventBus {
+	return &EventBus{
+		redis:       client,
+		logger:      logger,
+		pubsub:      client.Subscribe(context.Background()),
+		subscribers: make(map[uuid.UUID]map[chan models.ChangeEvent]struct{}),
+	}
+}
+
+// Publish announces a change to the user's streams. data, if not nil, is sent
+// as the resource's new state. Failures are logged, not returned: the write
+// the event is about has already happened.
+func (b *EventBus) Publish(ctx context.Context, userID uuid.UUID, eventType models.ChangeEventType, id uuid.UUID, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := models.ChangeEvent{Type: eventType, ID: id, At: time.Now()}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			b.logger.Error().Err(err).Str("type", string(eventType)).Msg("Failed to encode change event")
+			return
+		}
+		event.Data = raw
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		b.logger.Error().Err(err).Str("type", string(eventType)).Msg("Failed to encode change event")
+		return
+	}
+
+	if err := b.redis.Publish(ctx, eventChannelPrefix+userID.String(), payload).Err(); err != nil {
+		b.logger.Warn().Err(err).Str("type", string(eventType)).Msg("Failed to publish change event")
+	}
+}
+
+// pendingEvent is a change event held back until the transaction that made
+// the change commits.
+type pendingEvent struct {
+	eventType models.ChangeEventType
+	id        uuid.UUID
+	data      interface{}
+}
+
+// publishAll publishes events held back during a transaction, in order.
+func (b *EventBus) publishAll(ctx context.Context, userID uuid.UUID, events []pendingEvent) {
+	for _, event := range events {
+		b.Publish(ctx, userID, event.eventType, event.id, event.data)
+	}
+}
+
+// Subscribe opens a stream of the user's change events. The channel is closed
+// when the stream falls too far behind or the bus is closed; call the returned
+// function to close it otherwise.
+func (b *EventBus) Subscribe(ctx context.Context, userID uuid.UUID) (<-chan models.ChangeEvent, func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan models.ChangeEvent, eventBufferSize)
+	if b.closed {
+		close(events)
+		return events, func() {}, nil
+	}
+
+	streams := b.subscribers[userID]
+	if streams == nil {
+		if err := b.pubsub.Subscribe(ctx, eventChannelPrefix+userID.String()); err != nil {
+			return nil, nil, err
+		}
+		streams = make(map[chan models.ChangeEvent]struct{})
+		b.subscribers[userID] = streams
+	}
+	streams[events] = struct{}{}
+
+	return events, func() { b.unsubscribe(userID, events) }, nil
+}
+
+func (b *EventBus) unsubscribe(userID uuid.UUID, events chan models.ChangeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	streams, ok := b.subscribers[userID]
+	if !ok {
+		return
+	}
+	// The stream may already have been dropped by dispatch.
+	if _, open := streams[events]; open {
+		delete(streams, events)
+		close(events)
+	}
+
+	if len(streams) == 0 {
+		delete(b.subscribers, userID)
+		if err := b.pubsub.Unsubscribe(context.Background(), eventChannelPrefix+userID.String()); err != nil {
+			b.logger.Warn().Err(err).Msg("Failed to unsubscribe from change events")
+		}
+	}
+}
+
+// Run delivers published events to this instance's streams until ctx is done.
+func (b *EventBus) Run(ctx context.Context) {
+	messages := b.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			b.dispatch(msg)
+		}
+	}
+}
+
+func (b *EventBus) dispatch(msg *redis.Message) {
+	userID, err := uuid.Parse(strings.TrimPrefix(msg.Channel, eventChannelPrefix))
+	if err != nil {
+		return
+	}
+	var event models.ChangeEvent
+	if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+		b.logger.Warn().Err(err).Msg("Received a malformed change event")
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	streams := b.subscribers[userID]
+	for events := range streams {
+		select {
+		case events <- event:
+		default:
+			// The stream is not keeping up; drop it rather than block the others.
+			delete(streams, events)
+			close(events)
+		}
+	}
+}
+
+// Close ends every open stream and the Redis subscription.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for userID, streams := range b.subscribers {
+		for events := range streams {
+			close(events)
+		}
+		delete(b.subscribers, userID)
+	}
+	if err := b.pubsub.Close(); err != nil {
+		b.logger.Warn().Err(err).Msg("Failed to close the change event subscription")
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"media-tracker/internal/models"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// fuzzyMatchThreshold is the confidence from which a fuzzy title match is
+	// taken as the same media item.
+	fuzzyMatchThreshold = 0.85
+	// fuzzyMatchMargin is how far ahead of the runner-up a fuzzy match must be
+	// to be taken without asking the client.
+	fuzzyMatchMargin = 0.1
+	// maxMatchCandidates caps the items considered for one title match.
+	maxMatchCandidates = 20
+
+	maxExternalIDs      = 10
+	maxExternalIDLength = 100
+)
+
+// mediaMatch is the result of matching media described by a client against
+// existing media items. Exactly one of media and ambiguous is set when
+// something matched; neither is set when nothing did.
+type mediaMatch struct {
+	media      *models.MediaItem
+	kind       models.MediaMatchKind
+	confidence float64
+	ambiguous  []models.MediaCandidate
+}
+
+// matchMediaByTitle picks the candidate the request describes. An item whose
+// normalized title (or original title), year and type all match is taken as
+// is; failing that, the most similar item is taken if its confidence clears
+// fuzzyMatchThreshold by fuzzyMatchMargin. Several equally good matches are
+// returned as ambiguous rather than picking one. The result depends only on the
+// request and the set of candidates, not on their order.
+func matchMediaByTitle(req *models.CreateMediaRequest, candidates []*models.MediaItem) mediaMatch {
+	candidates = sortedCandidates(candidates)
+
+	var exact []*models.MediaItem
+	for _, candidate := range candidates {
+		if candidate.Type == req.Type && titlesEqual(req, candidate) && (req.Year == nil || yearsEqual(req.Year, candidate.Year)) {
+			exact = append(exact, candidate)
+		}
+	}
+	switch len(exact) {
+	case 0:
+	case 1:
+		return mediaMatch{media: exact[0], kind: models.MediaMatchTitle, confidence: 1}
+	default:
+		ambiguous := make([]models.MediaCandidate, len(exact))
+		for i, candidate := range exact {
+			ambiguous[i] = models.MediaCandidate{Media: candidate, MatchedBy: models.MediaMatchTitle, Confidence: 1}
+		}
+		return mediaMatch{ambiguous: ambiguous}
+	}
+
+	var scored []models.MediaCandidate
+	for _, candidate := range candidates {
+		if candidate.Type != req.Type {
+			continue
+		}
+		if confidence := matchConfidence(req, candidate); confidence >= fuzzyMatchThreshold {
+			scored = append(scored, models.MediaCandidate{Media: candidate, MatchedBy: models.MediaMatchFuzzy, Confidence: confidence})
+		}
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Confidence > scored[j].Confidence })
+
+	switch {
+	case len(scored) == 0:
+		return mediaMatch{}
+	case len(scored) == 1 || scored[0].Confidence-scored[1].Confidence >= fuzzyMatchMargin:
+		return mediaMatch{media: scored[0].Media, kind: models.MediaMatchFuzzy, confidence: scored[0].Confidence}
+	default:
+		return mediaMatch{ambiguous: scored}
+	}
+}
+
+// matchConfidence scores how likely candidate is the media the request
+// describes, from 0 to 1: the best trigram similarity between their titles and
+// original titles, lowered when the years differ or one is unknown.
+func matchConfidence(req *models.CreateMediaRequest, candidate *models.MediaItem) float64 {
+	similarity := 0.0
+	for _, a := range titlesOf(req.Title, req.OriginalTitle) {
+		for _, b := range titlesOf(candidate.Title, candidate.OriginalTitle) {
+			similarity = math.Max(similarity, trigramSimilarity(normalizeTitle(a), normalizeTitle(b)))
+		}
+	}
+
+	factor := 1.0
+	switch {
+	case req.Year == nil && candidate.Year == nil:
+	case req.Year == nil || candidate.Year == nil:
+		factor = 0.9
+	case *req.Year == *candidate.Year:
+	case *req.Year-*candidate.Year == 1 || *candidate.Year-*req.Year == 1:
+		factor = 0.9
+	default:
+		factor = 0.5
+	}
+
+	return math.Round(similarity*factor*100) / 100
+}
+
+func titlesEqual(req *models.CreateMediaRequest, candidate *models.MediaItem) bool {
+	for _, a := range titlesOf(req.Title, req.OriginalTitle) {
+		for _, b := range titlesOf(candidate.Title, candidate.OriginalTitle) {
+			if normalizeTitle(a) == normalizeTitle(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func titlesOf(title string, originalTitle *string) []string {
+	if originalTitle != nil && *originalTitle != "" {
+		return []string{title, *originalTitle}
+	}
+	return []string{title}
+}
+
+func yearsEqual(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// sortedCandidates orders candidates by ID so ties are always broken the same way.
+func sortedCandidates(candidates []*models.MediaItem) []*models.MediaItem {
+	sorted := make([]*models.MediaItem, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID.String() < sorted[j].ID.String() })
+	return sorted
+}
+
+var stripMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// normalizeTitle reduces a title to lowercase words without accents or
+// punctuation, with "&" read as "and" and a leading article dropped, so that
+// "The Lord of the Rings: The Two Towers" and "lord of the rings - the two
+// towers" compare equal.
+func normalizeTitle(title string) string {
+	stripped, _, err := transform.String(stripMarks, title)
+	if err != nil {
+		stripped = title
+	}
+	stripped = strings.ReplaceAll(strings.ToLower(stripped), "&", " and ")
+
+	words := strings.FieldsFunc(stripped, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 {
+		switch words[0] {
+		case "the", "a", "an":
+			words = words[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// trigramSimilarity compares two normalized titles the way pg_trgm does: the
+// share of distinct three-letter sequences (of each word padded with two
+// spaces in front and one behind) the two have in common.
+func trigramSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// normalizeExternalIDs lowercases catalogue names and trims IDs, rejecting
+// empty or oversized ones.
+func normalizeExternalIDs(ids map[string]string) (map[string]string, error) {
+	if len(ids) > maxExternalIDs {
+		return nil, fmt.Errorf("%w: at most %d external IDs are allowed", ErrValidation, maxExternalIDs)
+	}
+	normalized := make(map[string]string, len(ids))
+	for source, id := range ids {
+		source = strings.ToLower(strings.TrimSpace(source))
+		id = strings.TrimSpace(id)
+		if source == "" || id == "" {
+			return nil, fmt.Errorf("%w: external IDs need a catalogue and an ID", ErrValidation)
+		}
+		if len(source) > maxExternalIDLength || len(id) > maxExternalIDLength {
+			return nil, fmt.Errorf("%w: external ID %s:%s is too long", ErrValidation, source, id)
+		}
+		normalized[source] = id
+	}
+	return normalized, nil
+}
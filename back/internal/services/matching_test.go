@@ -0,0 +1,300 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func intPtr(v int) *int { return &v }
+
+func strPtr(v string) *string { return &v }
+
+func media(id string, mediaType models.MediaType, title string, year *int) *models.MediaItem {
+	return &models.MediaItem{ID: uuid.MustParse(id), Type: mediaType, Title: title, Year: year}
+}
+
+const (
+	idA = "00000000-0000-0000-0000-00000000000a"
+	idB = "00000000-0000-0000-0000-00000000000b"
+	idC = "00000000-0000-0000-0000-00000000000c"
+)
+
+func TestMatchMediaByTitle(t *testing.T) {
+	spirited := media(idA, models.MediaTypeAnime, "Spirited Away", intPtr(2001))
+	spirited.OriginalTitle = strPtr("Sen to Chihiro no Kamikakushi")
+
+	tests := []struct {
+		name           string
+		req            models.CreateMediaRequest
+		candidates     []*models.MediaItem
+		wantID         string
+		wantKind       models.MediaMatchKind
+		wantConfidence float64
+		wantAmbiguous  []string
+	}{
+		{
+			name: "exact title and year",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeMovie, Title: "The Matrix", Year: intPtr(1999)},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeMovie, "Matrix", intPtr(1999)),
+				media(idB, models.MediaTypeMovie, "The Matrix Reloaded", intPtr(2003)),
+			},
+			wantID: idA, wantKind: models.MediaMatchTitle, wantConfidence: 1,
+		},
+		{
+			name:       "exact original title",
+			req:        models.CreateMediaRequest{Type: models.MediaTypeAnime, Title: "Sen to Chihiro no Kamikakushi"},
+			candidates: []*models.MediaItem{spirited},
+			wantID:     idA, wantKind: models.MediaMatchTitle, wantConfidence: 1,
+		},
+		{
+			name: "exact title without a year matches any year",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeBook, Title: "Dune"},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeBook, "Dune", intPtr(1965)),
+			},
+			wantID: idA, wantKind: models.MediaMatchTitle, wantConfidence: 1,
+		},
+		{
+			name: "exact titles of another type are ignored",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeBook, Title: "Dune", Year: intPtr(1965)},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeMovie, "Dune", intPtr(1965)),
+			},
+		},
+		{
+			name: "several exact matches are ambiguous",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeMovie, Title: "Dune"},
+			candidates: []*models.MediaItem{
+				media(idB, models.MediaTypeMovie, "Dune", intPtr(2021)),
+				media(idA, models.MediaTypeMovie, "Dune", intPtr(1984)),
+			},
+			wantAmbiguous: []string{idA, idB},
+		},
+		{
+			name: "fuzzy title",
+			req: models.CreateMediaRequest{Type: models.MediaTypeBook, Title: "Harry Potter and the Philosopher's Stone",
+				Year: intPtr(1997)},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeBook, "Harry Potter and the Philosophers Stone", intPtr(1997)),
+				media(idB, models.MediaTypeBook, "Harry Potter and the Chamber of Secrets", intPtr(1998)),
+			},
+			wantID: idA, wantKind: models.MediaMatchFuzzy, wantConfidence: 0.93,
+		},
+		{
+			name: "exact title a year off is a fuzzy match",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeMovie, Title: "Spirited Away", Year: intPtr(2002)},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeMovie, "Spirited Away", intPtr(2001)),
+			},
+			wantID: idA, wantKind: models.MediaMatchFuzzy, wantConfidence: 0.9,
+		},
+		{
+			name: "fuzzy match well ahead of the runner-up",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeAnime, Title: "Neon Genesis Evangelion"},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeAnime, "Neon Genesis Evangelions", nil),
+				media(idB, models.MediaTypeAnime, "Neon Genesis Evangelon", intPtr(1995)),
+			},
+			wantID: idA, wantKind: models.MediaMatchFuzzy, wantConfidence: 0.92,
+		},
+		{
+			name: "equally good fuzzy matches are ambiguous",
+			req: models.CreateMediaRequest{Type: models.MediaTypeBook, Title: "Harry Potter and the Philosopher's Stone",
+				Year: intPtr(1997)},
+			candidates: []*models.MediaItem{
+				media(idC, models.MediaTypeBook, "Harry Potter and the Philosophers Stone", intPtr(1997)),
+				media(idA, models.MediaTypeBook, "Harry Potter and the Philosophers Stone", intPtr(1997)),
+			},
+			wantAmbiguous: []string{idA, idC},
+		},
+		{
+			name: "similar title but a different year",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeMovie, Title: "Dune", Year: intPtr(2021)},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeMovie, "Dune", intPtr(1984)),
+			},
+		},
+		{
+			name: "below the fuzzy threshold",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeTV, Title: "Breaking Bad"},
+			candidates: []*models.MediaItem{
+				media(idA, models.MediaTypeTV, "Braking Bad", nil),
+			},
+		},
+		{
+			name: "no candidates",
+			req:  models.CreateMediaRequest{Type: models.MediaTypeGame, Title: "Hades"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(t *testing.T, got mediaMatch) {
+				t.Helper()
+				gotID := ""
+				if got.media != nil {
+					gotID = got.media.ID.String()
+				}
+				if gotID != tt.wantID {
+					t.Fatalf("media = %q, want %q", gotID, tt.wantID)
+				}
+				if got.kind != tt.wantKind || got.confidence != tt.wantConfidence {
+					t.Errorf("kind, confidence = %q, %v, want %q, %v", got.kind, got.confidence, tt.wantKind, tt.wantConfidence)
+				}
+				var ambiguous []string
+				for _, candidate := range got.ambiguous {
+					ambiguous = append(ambiguous, candidate.Media.ID.String())
+				}
+				if !reflect.DeepEqual(ambiguous, tt.wantAmbiguous) {
+					t.Errorf("ambiguous = %v, want %v", ambiguous, tt.wantAmbiguous)
+				}
+			}
+
+			check(t, matchMediaByTitle(&tt.req, tt.candidates))
+
+			reversed := make([]*models.MediaItem, len(tt.candidates))
+			for i, candidate := range tt.candidates {
+				reversed[len(reversed)-1-i] = candidate
+			}
+			t.Run("reversed candidates", func(t *testing.T) {
+				check(t, matchMediaByTitle(&tt.req, reversed))
+			})
+		})
+	}
+}
+
+func TestMatchConfidence(t *testing.T) {
+	candidate := media(idA, models.MediaTypeMovie, "Alien", intPtr(1979))
+
+	tests := []struct {
+		name string
+		year *int
+		want float64
+	}{
+		{"same year", intPtr(1979), 1},
+		{"unknown year", nil, 0.9},
+		{"a year off", intPtr(1980), 0.9},
+		{"another year", intPtr(1986), 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.CreateMediaRequest{Type: models.MediaTypeMovie, Title: "Alien", Year: tt.year}
+			if got := matchConfidence(req, candidate); got != tt.want {
+				t.Errorf("matchConfidence = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Lord of the Rings: The Two Towers", "lord of the rings the two towers"},
+		{"lord of the rings - the two towers", "lord of the rings the two towers"},
+		{"SPIRITED AWAY", "spirited away"},
+		{"Amélie", "amelie"},
+		{"Pokémon: Let's Go, Pikachu!", "pokemon let s go pikachu"},
+		{"Tom & Jerry", "tom and jerry"},
+		{"A Quiet Place", "quiet place"},
+		{"An Education", "education"},
+		{"Anatomy of a Fall", "anatomy of a fall"},
+		{"The", "the"},
+		{"  1917\t(2019) ", "1917 2019"},
+		{"...", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := normalizeTitle(tt.title); got != tt.want {
+				t.Errorf("normalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"dune", "dune", 1},
+		{"", "", 1},
+		{"dune", "", 0},
+		{"abc", "xyz", 0},
+	}
+	for _, tt := range tests {
+		if got := trigramSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("trigramSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	pairs := [][2]string{
+		{"breaking bad", "braking bad"},
+		{"dune part one", "dune part two"},
+		{"witcher 3 wild hunt", "witcher 3 wild hunt goty"},
+		{"neon genesis evangelion", "neon genesis evangelions"},
+	}
+	for _, pair := range pairs {
+		got := trigramSimilarity(pair[0], pair[1])
+		if got <= 0 || got >= 1 {
+			t.Errorf("trigramSimilarity(%q, %q) = %v, want strictly between 0 and 1", pair[0], pair[1], got)
+		}
+		if back := trigramSimilarity(pair[1], pair[0]); back != got {
+			t.Errorf("trigramSimilarity is not symmetric for %q and %q: %v and %v", pair[0], pair[1], got, back)
+		}
+	}
+}
+
+func TestNormalizeExternalIDs(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxExternalIDs; i++ {
+		tooMany[string(rune('a'+i))] = "1"
+	}
+
+	tests := []struct {
+		name    string
+		ids     map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none", ids: nil, want: map[string]string{}},
+		{
+			name: "lowercases catalogues and trims both",
+			ids:  map[string]string{" TMDB ": " 603 ", "ISBN": "9780441013593"},
+			want: map[string]string{"tmdb": "603", "isbn": "9780441013593"},
+		},
+		{name: "empty catalogue", ids: map[string]string{"  ": "603"}, wantErr: true},
+		{name: "empty ID", ids: map[string]string{"tmdb": " "}, wantErr: true},
+		{name: "catalogue too long", ids: map[string]string{strings.Repeat("x", maxExternalIDLength+1): "1"}, wantErr: true},
+		{name: "ID too long", ids: map[string]string{"tmdb": strings.Repeat("1", maxExternalIDLength+1)}, wantErr: true},
+		{name: "too many", ids: tooMany, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeExternalIDs(tt.ids)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeExternalIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// getAs returns a collection the user has at least role need in, with Role
+// set. Users with no role in it get ErrNotFound, members with too small a
+// role ErrForbidden.
+func (s *CollectionService) getAs(ctx context.Context, id uuid.UUID, userID uuid.UUID, need models.CollectionRole) (*models.Collection, error) {
+	collection, err := s.collectionRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection.UserID == userID {
+		collection.Role = models.CollectionRoleOwner
+	} else {
+		if collection.Role, err = s.collectionRepo.MemberRole(ctx, id, userID); err != nil {
+			return nil, err
+		}
+		if collection.Role == "" {
+			return nil, ErrNotFound
+		}
+	}
+
+	if !collection.Role.Includes(need) {
+		return nil, fmt.Errorf("%w: this needs the %s role in the collection", ErrForbidden, need)
+	}
+	return collection, nil
+}
+
+// memberEntries returns the entries of a collection that userID may see: their
+// own, and other members' entries that are not private, without their private
+// notes.
+func memberEntries(entries []models.Entry, userID uuid.UUID) []models.Entry {
+	visible := entries[:0]
+	for _, entry := range entries {
+		if entry.UserID != userID {
+			if entry.Visibility == models.VisibilityPrivate {
+				continue
+			}
+			entry.PrivateNotes = nil
+		}
+		visible = append(visible, entry)
+	}
+	return visible
+}
+
+// publishCollection announces a change to a collection to its owner and
+// members. The user who made it gets the collection as they see it; the others
+// get it without its entries or the cover mosaic built from them, which they may
+// see differently, and reload it.
+func (s *CollectionService) publishCollection(ctx context.Context, actorID uuid.UUID, eventType models.ChangeEventType,
+	collection *models.Collection) {
+	var data interface{}
+	if eventType != models.ChangeCollectionDeleted {
+		data = collection
+	}
+	s.events.Publish(ctx, actorID, eventType, collection.ID, data)
+
+	members, err := s.collectionRepo.ListMembers(ctx, collection.ID)
+	if err != nil {
+		return
+	}
+	audience := append(members, models.CollectionMember{UserID: collection.UserID, Role: models.CollectionRoleOwner})
+	for _, member := range audience {
+		if member.UserID == actorID {
+			continue
+		}
+		var data interface{}
+		if eventType != models.ChangeCollectionDeleted {
+			summary := *collection
+			summary.Entries = nil
+			summary.CoverMosaic = nil
+			summary.Role = member.Role
+			if member.Role != models.CollectionRoleOwner {
+				summary.Rules = nil
+			}
+			data = &summary
+		}
+		s.events.Publish(ctx, member.UserID, eventType, collection.ID, data)
+	}
+}
+
+// ListMembers returns the owner and members of a collection the user is in.
+func (s *CollectionService) ListMembers(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]models.CollectionMember, error) {
+	collection, err := s.getAs(ctx, id, userID, models.CollectionRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := s.userRepo.GetByID(ctx, collection.UserID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.collectionRepo.ListMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return append([]models.CollectionMember{{
+		UserID:  owner.ID,
+		Name:    owner.Name,
+		Email:   owner.Email,
+		Role:    models.CollectionRoleOwner,
+		AddedAt: collection.CreatedAt,
+	}}, members...), nil
+}
+
+// AddMember shares the user's collection with the user registered under
+// req.Email, or changes their role, and returns the members.
+func (s *CollectionService) AddMember(ctx context.Context, id uuid.UUID, userID uuid.UUID, req *models.AddMemberRequest) ([]models.CollectionMember, error) {
+	if !req.Role.Valid() {
+		return nil, fmt.Errorf("%w: role must be editor or viewer", ErrValidation)
+	}
+	collection, err := s.getOwned(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.userRepo.GetByEmail(ctx, strings.TrimSpace(req.Email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no user is registered under %q", ErrValidation, req.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if member.ID == userID {
+		return nil, fmt.Errorf("%w: you own this collection", ErrValidation)
+	}
+
+	added := false
+	err = s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		current, err := txService.collectionRepo.MemberRole(ctx, id, member.ID)
+		if err != nil || current == req.Role {
+			return err
+		}
+		if err := txService.collectionRepo.UpsertMember(ctx, id, member.ID, req.Role, userID); err != nil {
+			return err
+		}
+
+		added = current == ""
+		action := models.MemberActionRoleChanged
+		if added {
+			action = models.MemberActionAdded
+		}
+		return txService.collectionRepo.AddMemberEvent(ctx, &models.CollectionMemberEvent{
+			CollectionID: id, ActorID: &userID, UserID: &member.ID, Action: action, Role: &req.Role,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if added {
+		collection.Role = req.Role
+		// Only the owner sees the rules of a smart collection.
+		collection.Rules = nil
+		s.events.Publish(ctx, member.ID, models.ChangeCollectionCreated, id, collection)
+	}
+	return s.ListMembers(ctx, id, userID)
+}
+
+// RemoveMember takes a member out of a collection, along with their entries in
+// it. The owner may remove anyone; members may only remove themselves.
+func (s *CollectionService) RemoveMember(ctx context.Context, id uuid.UUID, userID uuid.UUID, memberID uuid.UUID) error {
+	need := models.CollectionRoleOwner
+	action := models.MemberActionRemoved
+	if memberID == userID {
+		need = models.CollectionRoleViewer
+		action = models.MemberActionLeft
+	}
+	collection, err := s.getAs(ctx, id, userID, need)
+	if err != nil {
+		return err
+	}
+	if memberID == collection.UserID {
+		return fmt.Errorf("%w: the owner cannot leave their collection", ErrValidation)
+	}
+
+	err = s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		removed, err := txService.collectionRepo.RemoveMember(ctx, id, memberID)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return ErrNotFound
+		}
+		if err := txService.collectionRepo.Touch(ctx, id); err != nil {
+			return err
+		}
+		return txService.collectionRepo.AddMemberEvent(ctx, &models.CollectionMemberEvent{
+			CollectionID: id, ActorID: &userID, UserID: &memberID, Action: action,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// To the removed member the collection is gone.
+	s.events.Publish(ctx, memberID, models.ChangeCollectionDeleted, id, nil)
+	return nil
+}
+
+// MemberEvents returns the membership changes of the user's collection, newest
+// first.
+func (s *CollectionService) MemberEvents(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]models.CollectionMemberEvent, error) {
+	if _, err := s.getOwned(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return s.collectionRepo.ListMemberEvents(ctx, id)
+}
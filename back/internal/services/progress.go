@@ -0,0 +1,230 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"media-tracker/internal/models"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/progress/*.json
+var progressSchemaFS embed.FS
+
+// progressSchemaFiles maps each media type to the JSON Schema its progress must satisfy.
+var progressSchemaFiles = map[models.MediaType]string{
+	models.MediaTypeBook:  "book.json",
+	models.MediaTypeTV:    "episodes.json",
+	models.MediaTypeAnime: "episodes.json",
+	models.MediaTypeGame:  "game.json",
+	models.MediaTypeVideo: "video.json",
+	models.MediaTypeMovie: "video.json",
+}
+
+var progressSchemas = mustCompileProgressSchemas()
+
+func mustCompileProgressSchemas() map[models.MediaType]*jsonschema.Schema {
+	compiler := jsonschema.NewCompiler()
+	compiled := make(map[string]*jsonschema.Schema)
+	schemas := make(map[models.MediaType]*jsonschema.Schema)
+
+	for mediaType, file := range progressSchemaFiles {
+		if schema, ok := compiled[file]; ok {
+			schemas[mediaType] = schema
+			continue
+		}
+
+		data, err := progressSchemaFS.ReadFile("schemas/progress/" + file)
+		if err != nil {
+			panic(fmt.Sprintf("progress schema %s: %v", file, err))
+		}
+		if err := compiler.AddResource(file, strings.NewReader(string(data))); err != nil {
+			panic(fmt.Sprintf("progress schema %s: %v", file, err))
+		}
+		schema, err := compiler.Compile(file)
+		if err != nil {
+			panic(fmt.Sprintf("progress schema %s: %v", file, err))
+		}
+
+		compiled[file] = schema
+		schemas[mediaType] = schema
+	}
+
+	return schemas
+}
+
+// validateProgress checks progress against the schema for the media type, plus
+// the cross-field rules a schema can't express (current never exceeds total).
+func validateProgress(mediaType models.MediaType, progress models.JSONB) error {
+	if len(progress) == 0 {
+		return nil
+	}
+
+	schema, ok := progressSchemas[mediaType]
+	if !ok {
+		return fmt.Errorf("%w: progress is not supported for media type %q", ErrValidation, mediaType)
+	}
+
+	if err := schema.Validate(map[string]interface{}(progress)); err != nil {
+		var ve *jsonschema.ValidationError
+		if errors.As(err, &ve) {
+			return fmt.Errorf("%w: progress%s", ErrValidation, schemaErrorMessage(ve))
+		}
+		return err
+	}
+
+	var checks [][2]*float64
+	switch mediaType {
+	case models.MediaTypeBook:
+		var p models.BookProgress
+		if err := decodeProgress(progress, &p); err != nil {
+			return err
+		}
+		checks = [][2]*float64{{intPtrToFloat(p.Pages), intPtrToFloat(p.TotalPages)}, {intPtrToFloat(p.Chapters), intPtrToFloat(p.TotalChapters)}}
+	case models.MediaTypeTV, models.MediaTypeAnime:
+		var p models.EpisodeProgress
+		if err := decodeProgress(progress, &p); err != nil {
+			return err
+		}
+		checks = [][2]*float64{{intPtrToFloat(p.Episodes), intPtrToFloat(p.TotalEpisodes)}, {intPtrToFloat(p.Season), intPtrToFloat(p.TotalSeasons)}}
+	case models.MediaTypeGame:
+		var p models.GameProgress
+		if err := decodeProgress(progress, &p); err != nil {
+			return err
+		}
+		checks = [][2]*float64{{intPtrToFloat(p.Achievements), intPtrToFloat(p.TotalAchievements)}}
+	case models.MediaTypeVideo, models.MediaTypeMovie:
+		var p models.VideoProgress
+		if err := decodeProgress(progress, &p); err != nil {
+			return err
+		}
+		checks = [][2]*float64{{intPtrToFloat(p.Minutes), intPtrToFloat(p.TotalMinutes)}}
+	}
+
+	for _, check := range checks {
+		if check[0] != nil && check[1] != nil && *check[0] > *check[1] {
+			return fmt.Errorf("%w: progress exceeds its total (%g > %g)", ErrValidation, *check[0], *check[1])
+		}
+	}
+
+	return nil
+}
+
+// progressCompletion returns the normalized completion percentage (0-100) for
+// progress, or nil when there is not enough information to compute one.
+// Totals missing from progress fall back to what is known about the media.
+func progressCompletion(media *models.MediaItem, progress models.JSONB) *float64 {
+	if media == nil || len(progress) == 0 {
+		return nil
+	}
+
+	var done, total *float64
+	switch media.Type {
+	case models.MediaTypeBook:
+		var p models.BookProgress
+		if decodeProgress(progress, &p) != nil {
+			return nil
+		}
+		if p.Pages != nil {
+			done, total = intPtrToFloat(p.Pages), firstNonNil(intPtrToFloat(p.TotalPages), metadataNumber(media, "pages"))
+		} else if p.Chapters != nil {
+			done, total = intPtrToFloat(p.Chapters), firstNonNil(intPtrToFloat(p.TotalChapters), metadataNumber(media, "chapters"))
+		}
+	case models.MediaTypeTV, models.MediaTypeAnime:
+		var p models.EpisodeProgress
+		if decodeProgress(progress, &p) != nil {
+			return nil
+		}
+		if p.Episodes != nil {
+			done, total = intPtrToFloat(p.Episodes), firstNonNil(intPtrToFloat(p.TotalEpisodes), metadataNumber(media, "episodes"))
+		} else if p.Season != nil {
+			// Only the current season is known, so count the seasons before it as done.
+			finished := float64(*p.Season - 1)
+			done, total = &finished, firstNonNil(intPtrToFloat(p.TotalSeasons), metadataNumber(media, "seasons"))
+		}
+	case models.MediaTypeGame:
+		var p models.GameProgress
+		if decodeProgress(progress, &p) != nil {
+			return nil
+		}
+		if p.Percent != nil {
+			hundred := 100.0
+			done, total = p.Percent, &hundred
+		} else if p.Achievements != nil {
+			done, total = intPtrToFloat(p.Achievements), intPtrToFloat(p.TotalAchievements)
+		}
+	case models.MediaTypeVideo, models.MediaTypeMovie:
+		var p models.VideoProgress
+		if decodeProgress(progress, &p) != nil {
+			return nil
+		}
+		if p.Minutes != nil {
+			done, total = intPtrToFloat(p.Minutes), firstNonNil(intPtrToFloat(p.TotalMinutes), intPtrToFloat(media.Duration))
+		}
+	}
+
+	if done == nil || total == nil || *total <= 0 {
+		return nil
+	}
+
+	percent := math.Round(math.Min(*done / *total * 100, 100)*100) / 100
+	return &percent
+}
+
+// decodeProgress converts the raw JSONB progress into one of the typed progress models.
+func decodeProgress(progress models.JSONB, v interface{}) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// schemaErrorMessage flattens a schema validation error into its leaf causes.
+func schemaErrorMessage(ve *jsonschema.ValidationError) string {
+	if len(ve.Causes) == 0 {
+		location := ve.InstanceLocation
+		if location != "" {
+			location = "." + strings.ReplaceAll(strings.TrimPrefix(location, "/"), "/", ".")
+		}
+		return location + ": " + ve.Message
+	}
+
+	messages := make([]string, 0, len(ve.Causes))
+	for _, cause := range ve.Causes {
+		messages = append(messages, schemaErrorMessage(cause))
+	}
+	return strings.Join(messages, "; progress")
+}
+
+func metadataNumber(media *models.MediaItem, key string) *float64 {
+	if media.Metadata == nil {
+		return nil
+	}
+	if value, ok := media.Metadata[key].(float64); ok {
+		return &value
+	}
+	return nil
+}
+
+func intPtrToFloat(v *int) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+func firstNonNil(values ...*float64) *float64 {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"media-tracker/internal/models"
+)
+
+func TestValidateProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaType models.MediaType
+		progress  models.JSONB
+		wantErr   bool
+	}{
+		{name: "no progress", mediaType: models.MediaTypeBook},
+		{name: "book pages", mediaType: models.MediaTypeBook, progress: models.JSONB{"pages": 120.0, "total_pages": 300.0}},
+		{name: "book at its last page", mediaType: models.MediaTypeBook, progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}},
+		{name: "book past its last page", mediaType: models.MediaTypeBook, progress: models.JSONB{"pages": 301.0, "total_pages": 300.0}, wantErr: true},
+		{name: "fractional pages", mediaType: models.MediaTypeBook, progress: models.JSONB{"pages": 1.5}, wantErr: true},
+		{name: "unknown book field", mediaType: models.MediaTypeBook, progress: models.JSONB{"minutes": 10.0}, wantErr: true},
+		{name: "tv episodes", mediaType: models.MediaTypeTV, progress: models.JSONB{"season": 2.0, "episode": 3.0, "total_seasons": 4.0}},
+		{name: "anime uses the episode schema", mediaType: models.MediaTypeAnime, progress: models.JSONB{"episodes": 12.0, "total_episodes": 24.0}},
+		{name: "season past the last one", mediaType: models.MediaTypeTV, progress: models.JSONB{"season": 5.0, "total_seasons": 4.0}, wantErr: true},
+		{name: "season zero", mediaType: models.MediaTypeTV, progress: models.JSONB{"season": 0.0}, wantErr: true},
+		{name: "game hours and percent", mediaType: models.MediaTypeGame, progress: models.JSONB{"hours": 12.5, "percent": 40.0}},
+		{name: "game percent above 100", mediaType: models.MediaTypeGame, progress: models.JSONB{"percent": 101.0}, wantErr: true},
+		{name: "too many achievements", mediaType: models.MediaTypeGame, progress: models.JSONB{"achievements": 51.0, "total_achievements": 50.0}, wantErr: true},
+		{name: "movie minutes", mediaType: models.MediaTypeMovie, progress: models.JSONB{"minutes": 45.0, "total_minutes": 120.0}},
+		{name: "negative minutes", mediaType: models.MediaTypeVideo, progress: models.JSONB{"minutes": -1.0}, wantErr: true},
+		{name: "minutes as text", mediaType: models.MediaTypeVideo, progress: models.JSONB{"minutes": "45"}, wantErr: true},
+		{name: "unknown media type", mediaType: "podcast", progress: models.JSONB{"minutes": 45.0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProgress(tt.mediaType, tt.progress)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProgressCompletion(t *testing.T) {
+	book := &models.MediaItem{Type: models.MediaTypeBook, Metadata: models.JSONB{"pages": 400.0, "chapters": 20.0}}
+	show := &models.MediaItem{Type: models.MediaTypeTV, Metadata: models.JSONB{"episodes": 50.0, "seasons": 5.0}}
+	game := &models.MediaItem{Type: models.MediaTypeGame}
+	movie := &models.MediaItem{Type: models.MediaTypeMovie, Duration: intPtr(120)}
+
+	tests := []struct {
+		name     string
+		media    *models.MediaItem
+		progress models.JSONB
+		want     *float64
+	}{
+		{name: "no media", progress: models.JSONB{"pages": 10.0}},
+		{name: "no progress", media: book},
+		{name: "pages against the total in progress", media: book, progress: models.JSONB{"pages": 50.0, "total_pages": 200.0}, want: floatPtr(25)},
+		{name: "pages against the media's page count", media: book, progress: models.JSONB{"pages": 100.0}, want: floatPtr(25)},
+		{name: "chapters", media: book, progress: models.JSONB{"chapters": 5.0}, want: floatPtr(25)},
+		{name: "rounded to two decimals", media: book, progress: models.JSONB{"pages": 1.0, "total_pages": 3.0}, want: floatPtr(33.33)},
+		{name: "capped at 100", media: book, progress: models.JSONB{"pages": 500.0}, want: floatPtr(100)},
+		{name: "episodes", media: show, progress: models.JSONB{"episodes": 10.0}, want: floatPtr(20)},
+		{name: "seasons before the current one", media: show, progress: models.JSONB{"season": 3.0}, want: floatPtr(40)},
+		{name: "game percent", media: game, progress: models.JSONB{"percent": 42.5}, want: floatPtr(42.5)},
+		{name: "achievements", media: game, progress: models.JSONB{"achievements": 10.0, "total_achievements": 40.0}, want: floatPtr(25)},
+		{name: "hours alone say nothing", media: game, progress: models.JSONB{"hours": 30.0}},
+		{name: "minutes against the duration", media: movie, progress: models.JSONB{"minutes": 30.0}, want: floatPtr(25)},
+		{name: "unknown total", media: &models.MediaItem{Type: models.MediaTypeBook}, progress: models.JSONB{"pages": 10.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := progressCompletion(tt.media, tt.progress)
+			if !equalFloatPtr(got, tt.want) {
+				t.Errorf("progressCompletion = %v, want %v", fmtFloatPtr(got), fmtFloatPtr(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxTiers       = 20
+	maxTierNameLen = 32
+)
+
+// normalizeTiers trims tier names and checks that they are non-empty and unique.
+func normalizeTiers(tiers []string) ([]string, error) {
+	if len(tiers) > maxTiers {
+		return nil, fmt.Errorf("%w: a collection has at most %d tiers", ErrValidation, maxTiers)
+	}
+
+	normalized := make([]string, 0, len(tiers))
+	seen := make(map[string]bool, len(tiers))
+	for _, tier := range tiers {
+		tier = strings.TrimSpace(tier)
+		if tier == "" || len(tier) > maxTierNameLen {
+			return nil, fmt.Errorf("%w: tier names must be 1-%d characters", ErrValidation, maxTierNameLen)
+		}
+		if seen[tier] {
+			return nil, fmt.Errorf("%w: duplicate tier %q", ErrValidation, tier)
+		}
+		seen[tier] = true
+		normalized = append(normalized, tier)
+	}
+	return normalized, nil
+}
+
+// applyCollectionMode sets the mode and tiers req asks for. A new collection is
+// unordered unless req says otherwise, and a tiered one without tiers gets
+// DefaultTiers.
+func applyCollectionMode(collection *models.Collection, req *models.CreateCollectionRequest) error {
+	if req.Mode != "" {
+		if !req.Mode.Valid() {
+			return fmt.Errorf("%w: unknown collection mode %q", ErrValidation, req.Mode)
+		}
+		collection.Mode = req.Mode
+	}
+	if req.Tiers != nil {
+		tiers, err := normalizeTiers(req.Tiers)
+		if err != nil {
+			return err
+		}
+		collection.Tiers = tiers
+	}
+
+	if collection.Mode == "" {
+		collection.Mode = models.CollectionModeUnordered
+	}
+	if collection.Mode == models.CollectionModeTiered && len(collection.Tiers) == 0 {
+		collection.Tiers = append([]string(nil), models.DefaultTiers...)
+	}
+	return nil
+}
+
+// tierIndex returns the position of tier among tiers. Unsorted entries, and
+// entries in a tier the collection no longer has, come after every tier.
+func tierIndex(tiers []string, tier *string) int {
+	if tier != nil {
+		for i, name := range tiers {
+			if name == *tier {
+				return i
+			}
+		}
+	}
+	return len(tiers)
+}
+
+// groupSlots stably sorts slots by tier and unsorts those whose tier the
+// collection no longer has.
+func groupSlots(slots []models.CollectionSlot, tiers []string) {
+	for i := range slots {
+		if tierIndex(tiers, slots[i].Tier) == len(tiers) {
+			slots[i].Tier = nil
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool {
+		return tierIndex(tiers, slots[i].Tier) < tierIndex(tiers, slots[j].Tier)
+	})
+}
+
+// placeSlot adds entryID to slots, or moves it there, as req says. Without a
+// rank the entry goes last (in its tier); an entry already in the collection
+// stays put unless it is given a rank or another tier. changed is false when
+// nothing moved.
+func placeSlot(collection *models.Collection, slots []models.CollectionSlot, entryID uuid.UUID,
+	req *models.PlaceEntryRequest) (placed []models.CollectionSlot, changed bool, err error) {
+	if req.Rank != nil && *req.Rank < 1 {
+		return nil, false, fmt.Errorf("%w: rank must be at least 1", ErrValidation)
+	}
+	switch collection.Mode {
+	case models.CollectionModeUnordered:
+		if req.Rank != nil || req.Tier != nil {
+			return nil, false, fmt.Errorf("%w: entries of an unordered collection have no rank or tier", ErrValidation)
+		}
+	case models.CollectionModeRanked:
+		if req.Tier != nil {
+			return nil, false, fmt.Errorf("%w: only tiered collections have tiers", ErrValidation)
+		}
+	case models.CollectionModeTiered:
+		if req.Tier != nil && tierIndex(collection.Tiers, req.Tier) == len(collection.Tiers) {
+			return nil, false, fmt.Errorf("%w: the collection has no tier %q", ErrValidation, *req.Tier)
+		}
+	}
+
+	current := -1
+	for i, slot := range slots {
+		if slot.EntryID == entryID {
+			current = i
+			break
+		}
+	}
+
+	var tier *string
+	if collection.Mode == models.CollectionModeTiered {
+		tier = req.Tier
+		if tier == nil && current >= 0 {
+			tier = slots[current].Tier
+		}
+	}
+	if current >= 0 && req.Rank == nil && tierIndex(collection.Tiers, tier) == tierIndex(collection.Tiers, slots[current].Tier) {
+		return slots, false, nil
+	}
+
+	placed = make([]models.CollectionSlot, 0, len(slots)+1)
+	for i, slot := range slots {
+		if i != current {
+			placed = append(placed, slot)
+		}
+	}
+
+	// The entry goes into the run of slots of its tier; in ranked collections
+	// that run is the whole collection.
+	start, end := 0, len(placed)
+	if collection.Mode == models.CollectionModeTiered {
+		index := tierIndex(collection.Tiers, tier)
+		start = sort.Search(len(placed), func(i int) bool { return tierIndex(collection.Tiers, placed[i].Tier) >= index })
+		end = sort.Search(len(placed), func(i int) bool { return tierIndex(collection.Tiers, placed[i].Tier) > index })
+	}
+	at := end
+	if req.Rank != nil && start+*req.Rank-1 < end {
+		at = start + *req.Rank - 1
+	}
+
+	placed = append(placed, models.CollectionSlot{})
+	copy(placed[at+1:], placed[at:])
+	placed[at] = models.CollectionSlot{EntryID: entryID, Tier: tier}
+	return placed, true, nil
+}
+
+// rankEntries numbers the listed entries of a ranked collection, and those of
+// a tiered collection within their tier. Entries hidden from the listing (in
+// the trash, or not public on a share) are not counted.
+func rankEntries(collection *models.Collection) {
+	tierCounts := make(map[string]int, len(collection.Tiers))
+	for i := range collection.Entries {
+		entry := &collection.Entries[i]
+		entry.Rank = nil
+
+		switch collection.Mode {
+		case models.CollectionModeRanked:
+			rank := i + 1
+			entry.Rank = &rank
+			entry.Tier = nil
+		case models.CollectionModeTiered:
+			if tierIndex(collection.Tiers, entry.Tier) == len(collection.Tiers) {
+				entry.Tier = nil
+				continue
+			}
+			tierCounts[*entry.Tier]++
+			rank := tierCounts[*entry.Tier]
+			entry.Rank = &rank
+		default:
+			entry.Tier = nil
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const idD = "00000000-0000-0000-0000-00000000000d"
+
+// slots builds collection slots from "a", "b:S" style specs: the last letter of
+// the entry ID, then its tier if it has one.
+func slots(specs ...string) []models.CollectionSlot {
+	result := make([]models.CollectionSlot, 0, len(specs))
+	for _, spec := range specs {
+		id, tier, tiered := strings.Cut(spec, ":")
+		slot := models.CollectionSlot{EntryID: uuid.MustParse(idA[:len(idA)-1] + id)}
+		if tiered {
+			slot.Tier = &tier
+		}
+		result = append(result, slot)
+	}
+	return result
+}
+
+func slotSpecs(slots []models.CollectionSlot) []string {
+	specs := make([]string, 0, len(slots))
+	for _, slot := range slots {
+		id := slot.EntryID.String()
+		spec := id[len(id)-1:]
+		if slot.Tier != nil {
+			spec += ":" + *slot.Tier
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func TestNormalizeTiers(t *testing.T) {
+	tooMany := make([]string, maxTiers+1)
+	for i := range tooMany {
+		tooMany[i] = string(rune('A' + i))
+	}
+
+	tests := []struct {
+		name    string
+		tiers   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", tiers: []string{}, want: []string{}},
+		{name: "trimmed", tiers: []string{" S ", "A", "Must watch"}, want: []string{"S", "A", "Must watch"}},
+		{name: "too many", tiers: tooMany, wantErr: true},
+		{name: "empty name", tiers: []string{"S", " "}, wantErr: true},
+		{name: "name too long", tiers: []string{strings.Repeat("x", maxTierNameLen+1)}, wantErr: true},
+		{name: "duplicate after trimming", tiers: []string{"S", "S "}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTiers(tt.tiers)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTiers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCollectionMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection models.Collection
+		req        models.CreateCollectionRequest
+		wantMode   models.CollectionMode
+		wantTiers  []string
+		wantErr    bool
+	}{
+		{name: "new collections are unordered", wantMode: models.CollectionModeUnordered},
+		{name: "ranked", req: models.CreateCollectionRequest{Mode: models.CollectionModeRanked}, wantMode: models.CollectionModeRanked},
+		{
+			name:      "tiered without tiers gets the defaults",
+			req:       models.CreateCollectionRequest{Mode: models.CollectionModeTiered},
+			wantMode:  models.CollectionModeTiered,
+			wantTiers: models.DefaultTiers,
+		},
+		{
+			name:      "tiered with its own tiers",
+			req:       models.CreateCollectionRequest{Mode: models.CollectionModeTiered, Tiers: []string{" Loved", "Liked"}},
+			wantMode:  models.CollectionModeTiered,
+			wantTiers: []string{"Loved", "Liked"},
+		},
+		{
+			name:       "an update without a mode keeps it",
+			collection: models.Collection{Mode: models.CollectionModeTiered, Tiers: []string{"Top"}},
+			wantMode:   models.CollectionModeTiered,
+			wantTiers:  []string{"Top"},
+		},
+		{name: "unknown mode", req: models.CreateCollectionRequest{Mode: "shuffled"}, wantErr: true},
+		{name: "bad tiers", req: models.CreateCollectionRequest{Mode: models.CollectionModeTiered, Tiers: []string{""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := tt.collection
+			err := applyCollectionMode(&collection, &tt.req)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if collection.Mode != tt.wantMode || !reflect.DeepEqual(collection.Tiers, tt.wantTiers) {
+				t.Errorf("mode, tiers = %q, %q, want %q, %q", collection.Mode, collection.Tiers, tt.wantMode, tt.wantTiers)
+			}
+		})
+	}
+}
+
+func TestGroupSlots(t *testing.T) {
+	got := slots("a:B", "b", "c:S", "d:Gone")
+	groupSlots(got, []string{"S", "A", "B"})
+	if want := []string{"c:S", "a:B", "b", "d"}; !reflect.DeepEqual(slotSpecs(got), want) {
+		t.Errorf("groupSlots = %q, want %q", slotSpecs(got), want)
+	}
+}
+
+func TestPlaceSlot(t *testing.T) {
+	unordered := &models.Collection{Mode: models.CollectionModeUnordered}
+	ranked := &models.Collection{Mode: models.CollectionModeRanked}
+	tiered := &models.Collection{Mode: models.CollectionModeTiered, Tiers: []string{"S", "A", "B"}}
+	tierS, tierA, tierX := "S", "A", "X"
+
+	tests := []struct {
+		name        string
+		collection  *models.Collection
+		slots       []string
+		entry       string
+		req         models.PlaceEntryRequest
+		want        []string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{name: "unordered adds last", collection: unordered, slots: []string{"a", "b"}, entry: idC, want: []string{"a", "b", "c"}, wantChanged: true},
+		{name: "unordered keeps a present entry", collection: unordered, slots: []string{"a", "b"}, entry: idA, want: []string{"a", "b"}},
+		{name: "unordered has no ranks", collection: unordered, entry: idA, req: models.PlaceEntryRequest{Rank: intPtr(1)}, wantErr: true},
+		{
+			name: "ranked inserts at its rank", collection: ranked, slots: []string{"a", "b", "c"}, entry: idD,
+			req: models.PlaceEntryRequest{Rank: intPtr(2)}, want: []string{"a", "d", "b", "c"}, wantChanged: true,
+		},
+		{
+			name: "ranked moves down", collection: ranked, slots: []string{"a", "b", "c"}, entry: idA,
+			req: models.PlaceEntryRequest{Rank: intPtr(3)}, want: []string{"b", "c", "a"}, wantChanged: true,
+		},
+		{
+			name: "ranked moves up", collection: ranked, slots: []string{"a", "b", "c"}, entry: idC,
+			req: models.PlaceEntryRequest{Rank: intPtr(1)}, want: []string{"c", "a", "b"}, wantChanged: true,
+		},
+		{
+			name: "a rank past the end goes last", collection: ranked, slots: []string{"a", "b"}, entry: idC,
+			req: models.PlaceEntryRequest{Rank: intPtr(10)}, want: []string{"a", "b", "c"}, wantChanged: true,
+		},
+		{name: "ranked keeps a present entry without a rank", collection: ranked, slots: []string{"a", "b"}, entry: idB, want: []string{"a", "b"}},
+		{name: "rank 0", collection: ranked, entry: idA, req: models.PlaceEntryRequest{Rank: intPtr(0)}, wantErr: true},
+		{name: "ranked has no tiers", collection: ranked, entry: idA, req: models.PlaceEntryRequest{Tier: &tierS}, wantErr: true},
+		{
+			name: "tiered adds last in its tier", collection: tiered, slots: []string{"a:S", "b:A", "c"}, entry: idD,
+			req: models.PlaceEntryRequest{Tier: &tierS}, want: []string{"a:S", "d:S", "b:A", "c"}, wantChanged: true,
+		},
+		{
+			name: "tiered ranks within its tier", collection: tiered, slots: []string{"a:S", "b:A", "c:A"}, entry: idD,
+			req: models.PlaceEntryRequest{Tier: &tierA, Rank: intPtr(1)}, want: []string{"a:S", "d:A", "b:A", "c:A"}, wantChanged: true,
+		},
+		{
+			name: "tiered without a tier is unsorted", collection: tiered, slots: []string{"a:S"}, entry: idB,
+			want: []string{"a:S", "b"}, wantChanged: true,
+		},
+		{
+			name: "moving to another tier", collection: tiered, slots: []string{"a:S", "b:A"}, entry: idA,
+			req: models.PlaceEntryRequest{Tier: &tierA}, want: []string{"b:A", "a:A"}, wantChanged: true,
+		},
+		{
+			name: "a rank alone keeps the tier", collection: tiered, slots: []string{"a:A", "b:A"}, entry: idB,
+			req: models.PlaceEntryRequest{Rank: intPtr(1)}, want: []string{"b:A", "a:A"}, wantChanged: true,
+		},
+		{
+			name: "the same tier again changes nothing", collection: tiered, slots: []string{"a:S", "b:S"}, entry: idA,
+			req: models.PlaceEntryRequest{Tier: &tierS}, want: []string{"a:S", "b:S"},
+		},
+		{name: "unknown tier", collection: tiered, entry: idA, req: models.PlaceEntryRequest{Tier: &tierX}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := placeSlot(tt.collection, slots(tt.slots...), uuid.MustParse(tt.entry), &tt.req)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(slotSpecs(got), tt.want) || changed != tt.wantChanged {
+				t.Errorf("placeSlot = %q, %v, want %q, %v", slotSpecs(got), changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestRankEntries(t *testing.T) {
+	tierS, tierA, gone := "S", "A", "Gone"
+
+	tests := []struct {
+		name      string
+		mode      models.CollectionMode
+		tiers     []*string
+		wantRanks []*int
+		wantTiers []*string
+	}{
+		{
+			name:      "ranked numbers every entry and drops tiers",
+			mode:      models.CollectionModeRanked,
+			tiers:     []*string{nil, &tierS, nil},
+			wantRanks: []*int{intPtr(1), intPtr(2), intPtr(3)},
+			wantTiers: []*string{nil, nil, nil},
+		},
+		{
+			name:      "tiered numbers entries within their tier",
+			mode:      models.CollectionModeTiered,
+			tiers:     []*string{&tierS, &tierS, &tierA, nil, &gone},
+			wantRanks: []*int{intPtr(1), intPtr(2), intPtr(1), nil, nil},
+			wantTiers: []*string{&tierS, &tierS, &tierA, nil, nil},
+		},
+		{
+			name:      "unordered has no ranks or tiers",
+			mode:      models.CollectionModeUnordered,
+			tiers:     []*string{&tierS, nil},
+			wantRanks: []*int{nil, nil},
+			wantTiers: []*string{nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := &models.Collection{Mode: tt.mode, Tiers: []string{"S", "A"}}
+			for _, tier := range tt.tiers {
+				collection.Entries = append(collection.Entries, models.Entry{Tier: tier, Rank: intPtr(99)})
+			}
+
+			rankEntries(collection)
+
+			for i, entry := range collection.Entries {
+				if !reflect.DeepEqual(entry.Rank, tt.wantRanks[i]) || !reflect.DeepEqual(entry.Tier, tt.wantTiers[i]) {
+					t.Errorf("entry %d: rank, tier = %v, %v, want %v, %v", i, entry.Rank, entry.Tier, tt.wantRanks[i], tt.wantTiers[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"media-tracker/internal/models"
+	"media-tracker/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// canonicalRating converts a rating written on scale to the canonical 0-10
+// scale ratings are stored on, rounded to the stored precision of 0.1.
+func canonicalRating(scale models.RatingScale, rating *float64) (*float64, error) {
+	if rating == nil {
+		return nil, nil
+	}
+	value := *rating
+	if value < 0 || value > scale.Max() {
+		return nil, fmt.Errorf("%w: rating must be between 0 and %g", ErrValidation, scale.Max())
+	}
+
+	var canonical float64
+	switch scale {
+	case models.RatingScaleFiveStar:
+		canonical = value * 2
+	case models.RatingScaleHundred:
+		canonical = value / 10
+	case models.RatingScaleLikeDislike:
+		if value != 0 && value != 1 {
+			return nil, fmt.Errorf("%w: a like/dislike rating is 1 (like) or 0 (dislike)", ErrValidation)
+		}
+		canonical = value * 10
+	default:
+		canonical = value
+	}
+	canonical = math.Round(canonical*10) / 10
+	return &canonical, nil
+}
+
+// canonicalRatingBound converts a rating filter bound written on scale. The
+// bound is widened to every canonical rating that displays within it, which
+// only makes a difference for like/dislike: "at least 1" is every like.
+func canonicalRatingBound(scale models.RatingScale, bound *float64, upper bool) (*float64, error) {
+	if bound == nil {
+		return nil, nil
+	}
+	if *bound < 0 || *bound > scale.Max() {
+		return nil, fmt.Errorf("%w: rating bounds must be between 0 and %g", ErrValidation, scale.Max())
+	}
+	if scale != models.RatingScaleLikeDislike {
+		return canonicalRating(scale, bound)
+	}
+
+	var canonical float64
+	switch {
+	case upper && *bound < 1:
+		canonical = models.LikeThreshold - 0.1
+	case upper:
+		canonical = 10
+	case *bound > 0:
+		canonical = models.LikeThreshold
+	}
+	return &canonical, nil
+}
+
+const (
+	maxRatingCriteria  = 10
+	maxCriterionKeyLen = 32
+)
+
+var criterionKeyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// validateRatingCriteria checks the criteria of a rating template about to be
+// saved. Labels default to their keys.
+func validateRatingCriteria(criteria models.RatingCriteria) error {
+	if len(criteria) > maxRatingCriteria {
+		return fmt.Errorf("%w: a rating template has at most %d criteria", ErrValidation, maxRatingCriteria)
+	}
+
+	seen := make(map[string]bool, len(criteria))
+	totalWeight := 0.0
+	for i := range criteria {
+		criterion := &criteria[i]
+		if len(criterion.Key) > maxCriterionKeyLen || !criterionKeyPattern.MatchString(criterion.Key) {
+			return fmt.Errorf("%w: criterion key %q must be 1-%d lowercase letters, digits or underscores",
+				ErrValidation, criterion.Key, maxCriterionKeyLen)
+		}
+		if seen[criterion.Key] {
+			return fmt.Errorf("%w: duplicate criterion key %q", ErrValidation, criterion.Key)
+		}
+		seen[criterion.Key] = true
+
+		criterion.Label = strings.TrimSpace(criterion.Label)
+		if criterion.Label == "" {
+			criterion.Label = criterion.Key
+		}
+		if criterion.Weight < 0 {
+			return fmt.Errorf("%w: criterion %q has a negative weight", ErrValidation, criterion.Key)
+		}
+		totalWeight += criterion.Weight
+	}
+	if len(criteria) > 0 && totalWeight == 0 {
+		return fmt.Errorf("%w: at least one criterion needs a weight above 0", ErrValidation)
+	}
+	return nil
+}
+
+// canonicalSubRatings converts sub-ratings written on scale, rejecting keys the
+// template does not define. An empty map clears the sub-ratings.
+func canonicalSubRatings(template *models.RatingTemplate, scale models.RatingScale, subRatings models.SubRatings) (models.SubRatings, error) {
+	if len(subRatings) == 0 {
+		return nil, nil
+	}
+
+	canonical := make(models.SubRatings, len(subRatings))
+	for key, value := range subRatings {
+		if _, ok := template.Criteria.Find(key); !ok {
+			return nil, fmt.Errorf("%w: %s ratings have no %q criterion", ErrValidation, template.MediaType, key)
+		}
+		rating, err := canonicalRating(scale, &value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		canonical[key] = *rating
+	}
+	return canonical, nil
+}
+
+// weightedRating is the weighted average of the sub-ratings the template
+// weighs, or nil when there are none. Keys the template no longer defines are
+// ignored.
+func weightedRating(template *models.RatingTemplate, subRatings models.SubRatings) *float64 {
+	var sum, weights float64
+	for key, rating := range subRatings {
+		criterion, ok := template.Criteria.Find(key)
+		if !ok || criterion.Weight == 0 {
+			continue
+		}
+		sum += rating * criterion.Weight
+		weights += criterion.Weight
+	}
+	if weights == 0 {
+		return nil
+	}
+	rating := math.Round(sum/weights*10) / 10
+	return &rating
+}
+
+// applyRatingMode recomputes the overall rating of a weighted entry. An explicit
+// rating (ratingSet) is rejected there, since it would be overwritten.
+func applyRatingMode(entry *models.Entry, template *models.RatingTemplate, ratingSet bool) error {
+	if !entry.RatingMode.Valid() {
+		return fmt.Errorf("%w: unknown rating mode %q", ErrValidation, entry.RatingMode)
+	}
+	if entry.RatingMode != models.RatingModeWeighted {
+		return nil
+	}
+	if ratingSet {
+		return fmt.Errorf("%w: rating is computed from sub_ratings while rating_mode is weighted", ErrValidation)
+	}
+	entry.Rating = weightedRating(template, entry.SubRatings)
+	return nil
+}
+
+// RatingTemplates returns the user's rating template for every media type,
+// falling back to the built-in defaults.
+func (s *EntryService) RatingTemplates(ctx context.Context, userID uuid.UUID) ([]*models.RatingTemplate, error) {
+	custom, err := s.userRepo.ListRatingTemplates(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	byType := make(map[models.MediaType]*models.RatingTemplate, len(custom))
+	for _, template := range custom {
+		byType[template.MediaType] = template
+	}
+
+	templates := make([]*models.RatingTemplate, 0, len(models.MediaTypes))
+	for _, mediaType := range models.MediaTypes {
+		template, ok := byType[mediaType]
+		if !ok {
+			template = models.DefaultRatingTemplate(mediaType)
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+// PutRatingTemplate replaces the user's rating template for a media type.
+// Weighted ratings of the user's entries of that type are recomputed with it.
+func (s *EntryService) PutRatingTemplate(ctx context.Context, userID uuid.UUID, mediaType models.MediaType,
+	req *models.RatingTemplateRequest) (*models.RatingTemplate, error) {
+	if !mediaType.Valid() {
+		return nil, fmt.Errorf("%w: unknown media type %q", ErrValidation, mediaType)
+	}
+	if err := validateRatingCriteria(req.Criteria); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &models.RatingTemplate{MediaType: mediaType, Criteria: req.Criteria, Custom: true, UpdatedAt: &now}
+	err := s.changeRatingTemplate(ctx, userID, mediaType, func(userRepo *repository.UserRepository) error {
+		return userRepo.UpsertRatingTemplate(ctx, userID, template)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// ResetRatingTemplate puts the built-in template for a media type back in place
+// of the user's own, and returns it.
+func (s *EntryService) ResetRatingTemplate(ctx context.Context, userID uuid.UUID, mediaType models.MediaType) (*models.RatingTemplate, error) {
+	if !mediaType.Valid() {
+		return nil, fmt.Errorf("%w: unknown media type %q", ErrValidation, mediaType)
+	}
+
+	err := s.changeRatingTemplate(ctx, userID, mediaType, func(userRepo *repository.UserRepository) error {
+		return userRepo.DeleteRatingTemplate(ctx, userID, mediaType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return models.DefaultRatingTemplate(mediaType), nil
+}
+
+// changeRatingTemplate runs change in a transaction together with recomputing
+// the weighted ratings it affects, and announces the updated entries once the
+// transaction commits.
+func (s *EntryService) changeRatingTemplate(ctx context.Context, userID uuid.UUID, mediaType models.MediaType,
+	change func(userRepo *repository.UserRepository) error) error {
+	var events []pendingEvent
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		if err := change(txService.userRepo); err != nil {
+			return err
+		}
+
+		ids, err := txService.entryRepo.ListWeightedIDs(ctx, userID, mediaType)
+		if err != nil {
+			return err
+		}
+		template, err := txService.userRepo.GetRatingTemplate(ctx, userID, mediaType)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			entry, err := txService.entryRepo.GetByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if equalFloatPtr(entry.Rating, weightedRating(template, entry.SubRatings)) {
+				continue
+			}
+			// An empty update recomputes the weighted rating and keeps the
+			// current cycle, diary and change feed in step with it.
+			entry, err = txService.Update(ctx, userID, id, &models.UpdateEntryRequest{}, nil)
+			if err != nil {
+				return err
+			}
+			events = append(events, pendingEvent{eventType: models.ChangeEntryUpdated, id: entry.ID, data: entry})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.events.publishAll(ctx, userID, events)
+	return nil
+}
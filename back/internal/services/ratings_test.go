@@ -0,0 +1,322 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"media-tracker/internal/models"
+)
+
+func fmtFloatPtr(v *float64) string {
+	if v == nil {
+		return "nil"
+	}
+	return strconv.FormatFloat(*v, 'g', -1, 64)
+}
+
+func TestCanonicalRating(t *testing.T) {
+	tests := []struct {
+		name    string
+		scale   models.RatingScale
+		rating  *float64
+		want    *float64
+		wantErr bool
+	}{
+		{name: "no rating", scale: models.RatingScaleTen},
+		{name: "ten", scale: models.RatingScaleTen, rating: floatPtr(7.5), want: floatPtr(7.5)},
+		{name: "ten, rounded to 0.1", scale: models.RatingScaleTen, rating: floatPtr(7.25), want: floatPtr(7.3)},
+		{name: "ten, lowest", scale: models.RatingScaleTen, rating: floatPtr(0), want: floatPtr(0)},
+		{name: "ten, highest", scale: models.RatingScaleTen, rating: floatPtr(10), want: floatPtr(10)},
+		{name: "ten, above the scale", scale: models.RatingScaleTen, rating: floatPtr(10.5), wantErr: true},
+		{name: "ten, negative", scale: models.RatingScaleTen, rating: floatPtr(-1), wantErr: true},
+		{name: "five stars", scale: models.RatingScaleFiveStar, rating: floatPtr(3.5), want: floatPtr(7)},
+		{name: "five stars, rounded to 0.1", scale: models.RatingScaleFiveStar, rating: floatPtr(3.33), want: floatPtr(6.7)},
+		{name: "five stars, highest", scale: models.RatingScaleFiveStar, rating: floatPtr(5), want: floatPtr(10)},
+		{name: "five stars, above the scale", scale: models.RatingScaleFiveStar, rating: floatPtr(6), wantErr: true},
+		{name: "hundred", scale: models.RatingScaleHundred, rating: floatPtr(84), want: floatPtr(8.4)},
+		{name: "hundred, rounded to 0.1", scale: models.RatingScaleHundred, rating: floatPtr(83.7), want: floatPtr(8.4)},
+		{name: "hundred, highest", scale: models.RatingScaleHundred, rating: floatPtr(100), want: floatPtr(10)},
+		{name: "hundred, above the scale", scale: models.RatingScaleHundred, rating: floatPtr(101), wantErr: true},
+		{name: "like", scale: models.RatingScaleLikeDislike, rating: floatPtr(1), want: floatPtr(10)},
+		{name: "dislike", scale: models.RatingScaleLikeDislike, rating: floatPtr(0), want: floatPtr(0)},
+		{name: "like/dislike, in between", scale: models.RatingScaleLikeDislike, rating: floatPtr(0.5), wantErr: true},
+		{name: "like/dislike, above the scale", scale: models.RatingScaleLikeDislike, rating: floatPtr(2), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalRating(tt.scale, tt.rating)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalFloatPtr(got, tt.want) {
+				t.Errorf("canonicalRating = %v, want %v", fmtFloatPtr(got), fmtFloatPtr(tt.want))
+			}
+		})
+	}
+}
+
+func TestCanonicalRatingBound(t *testing.T) {
+	tests := []struct {
+		name    string
+		scale   models.RatingScale
+		bound   *float64
+		upper   bool
+		want    *float64
+		wantErr bool
+	}{
+		{name: "no bound", scale: models.RatingScaleFiveStar},
+		{name: "five stars", scale: models.RatingScaleFiveStar, bound: floatPtr(3.5), want: floatPtr(7)},
+		{name: "hundred", scale: models.RatingScaleHundred, bound: floatPtr(75), upper: true, want: floatPtr(7.5)},
+		{name: "above the scale", scale: models.RatingScaleFiveStar, bound: floatPtr(6), wantErr: true},
+		{name: "negative", scale: models.RatingScaleTen, bound: floatPtr(-1), wantErr: true},
+		{name: "likes from", scale: models.RatingScaleLikeDislike, bound: floatPtr(1), want: floatPtr(models.LikeThreshold)},
+		{name: "everything from", scale: models.RatingScaleLikeDislike, bound: floatPtr(0), want: floatPtr(0)},
+		{name: "likes up to", scale: models.RatingScaleLikeDislike, bound: floatPtr(1), upper: true, want: floatPtr(10)},
+		{
+			name: "dislikes up to", scale: models.RatingScaleLikeDislike, bound: floatPtr(0), upper: true,
+			want: floatPtr(models.LikeThreshold - 0.1),
+		},
+		{name: "in between likes and dislikes", scale: models.RatingScaleLikeDislike, bound: floatPtr(0.5), want: floatPtr(models.LikeThreshold)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalRatingBound(tt.scale, tt.bound, tt.upper)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalFloatPtr(got, tt.want) {
+				t.Errorf("canonicalRatingBound = %v, want %v", fmtFloatPtr(got), fmtFloatPtr(tt.want))
+			}
+		})
+	}
+}
+
+func TestRatingScaleRoundTrip(t *testing.T) {
+	scales := map[models.RatingScale][]float64{
+		models.RatingScaleTen:         {0, 0.5, 7.3, 10},
+		models.RatingScaleFiveStar:    {0, 0.5, 3.5, 5},
+		models.RatingScaleHundred:     {0, 1, 84, 100},
+		models.RatingScaleLikeDislike: {0, 1},
+	}
+	for scale, ratings := range scales {
+		for _, rating := range ratings {
+			canonical, err := canonicalRating(scale, &rating)
+			if err != nil {
+				t.Fatalf("canonicalRating(%s, %v): %v", scale, rating, err)
+			}
+			if got := scale.Display(*canonical); got != rating {
+				t.Errorf("%s: %v is stored as %v and displayed as %v", scale, rating, *canonical, got)
+			}
+		}
+	}
+}
+
+func TestValidateRatingCriteria(t *testing.T) {
+	tooMany := make(models.RatingCriteria, maxRatingCriteria+1)
+	for i := range tooMany {
+		tooMany[i] = models.RatingCriterion{Key: string(rune('a' + i)), Weight: 1}
+	}
+
+	tests := []struct {
+		name     string
+		criteria models.RatingCriteria
+		want     models.RatingCriteria
+		wantErr  bool
+	}{
+		{name: "none", criteria: models.RatingCriteria{}, want: models.RatingCriteria{}},
+		{
+			name:     "labels are trimmed and default to the key",
+			criteria: models.RatingCriteria{{Key: "story", Label: " Story ", Weight: 2}, {Key: "sound_design", Weight: 0}},
+			want:     models.RatingCriteria{{Key: "story", Label: "Story", Weight: 2}, {Key: "sound_design", Label: "sound_design"}},
+		},
+		{name: "too many", criteria: tooMany, wantErr: true},
+		{name: "empty key", criteria: models.RatingCriteria{{Key: "", Weight: 1}}, wantErr: true},
+		{name: "uppercase key", criteria: models.RatingCriteria{{Key: "Story", Weight: 1}}, wantErr: true},
+		{name: "key too long", criteria: models.RatingCriteria{{Key: strings.Repeat("x", maxCriterionKeyLen+1), Weight: 1}}, wantErr: true},
+		{name: "duplicate key", criteria: models.RatingCriteria{{Key: "story", Weight: 1}, {Key: "story", Weight: 1}}, wantErr: true},
+		{name: "negative weight", criteria: models.RatingCriteria{{Key: "story", Weight: -1}, {Key: "art", Weight: 2}}, wantErr: true},
+		{name: "no weight at all", criteria: models.RatingCriteria{{Key: "story"}, {Key: "art"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRatingCriteria(tt.criteria)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tt.criteria, tt.want) {
+				t.Errorf("criteria = %+v, want %+v", tt.criteria, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalSubRatings(t *testing.T) {
+	game := models.DefaultRatingTemplate(models.MediaTypeGame)
+
+	tests := []struct {
+		name       string
+		scale      models.RatingScale
+		subRatings models.SubRatings
+		want       models.SubRatings
+		wantErr    bool
+	}{
+		{name: "none", scale: models.RatingScaleTen},
+		{name: "empty map clears them", scale: models.RatingScaleTen, subRatings: models.SubRatings{}},
+		{
+			name:       "converted from the user's scale",
+			scale:      models.RatingScaleFiveStar,
+			subRatings: models.SubRatings{"story": 4.5, "visuals": 3},
+			want:       models.SubRatings{"story": 9, "visuals": 6},
+		},
+		{name: "unknown criterion", scale: models.RatingScaleTen, subRatings: models.SubRatings{"plot": 8}, wantErr: true},
+		{name: "off the scale", scale: models.RatingScaleFiveStar, subRatings: models.SubRatings{"story": 8}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalSubRatings(game, tt.scale, tt.subRatings)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("canonicalSubRatings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRating(t *testing.T) {
+	template := &models.RatingTemplate{MediaType: models.MediaTypeGame, Criteria: models.RatingCriteria{
+		{Key: "story", Weight: 2},
+		{Key: "gameplay", Weight: 1},
+		{Key: "music", Weight: 0},
+	}}
+
+	tests := []struct {
+		name       string
+		subRatings models.SubRatings
+		want       *float64
+	}{
+		{name: "none"},
+		{name: "one criterion", subRatings: models.SubRatings{"gameplay": 7}, want: floatPtr(7)},
+		{name: "weighted average", subRatings: models.SubRatings{"story": 9, "gameplay": 6}, want: floatPtr(8)},
+		{name: "rounded to 0.1", subRatings: models.SubRatings{"story": 8, "gameplay": 7}, want: floatPtr(7.7)},
+		{name: "unweighted criteria are ignored", subRatings: models.SubRatings{"story": 9, "music": 1}, want: floatPtr(9)},
+		{name: "removed criteria are ignored", subRatings: models.SubRatings{"story": 9, "visuals": 1}, want: floatPtr(9)},
+		{name: "only unweighted criteria", subRatings: models.SubRatings{"music": 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := weightedRating(template, tt.subRatings); !equalFloatPtr(got, tt.want) {
+				t.Errorf("weightedRating = %v, want %v", fmtFloatPtr(got), fmtFloatPtr(tt.want))
+			}
+		})
+	}
+}
+
+func TestApplyRatingMode(t *testing.T) {
+	game := models.DefaultRatingTemplate(models.MediaTypeGame)
+
+	tests := []struct {
+		name      string
+		entry     models.Entry
+		ratingSet bool
+		want      *float64
+		wantErr   bool
+	}{
+		{
+			name:      "manual keeps the rating",
+			entry:     models.Entry{RatingMode: models.RatingModeManual, Rating: floatPtr(4), SubRatings: models.SubRatings{"story": 9}},
+			ratingSet: true,
+			want:      floatPtr(4),
+		},
+		{
+			name:  "weighted computes the rating",
+			entry: models.Entry{RatingMode: models.RatingModeWeighted, Rating: floatPtr(4), SubRatings: models.SubRatings{"story": 9, "visuals": 6}},
+			want:  floatPtr(7.5),
+		},
+		{name: "weighted without sub-ratings", entry: models.Entry{RatingMode: models.RatingModeWeighted, Rating: floatPtr(4)}},
+		{
+			name:      "weighted with an explicit rating",
+			entry:     models.Entry{RatingMode: models.RatingModeWeighted, SubRatings: models.SubRatings{"story": 9}},
+			ratingSet: true,
+			wantErr:   true,
+		},
+		{name: "unknown mode", entry: models.Entry{RatingMode: "average"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			err := applyRatingMode(&entry, game, tt.ratingSet)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalFloatPtr(entry.Rating, tt.want) {
+				t.Errorf("rating = %v, want %v", fmtFloatPtr(entry.Rating), fmtFloatPtr(tt.want))
+			}
+		})
+	}
+}
+
+func TestLabelSubRatingStats(t *testing.T) {
+	templates := []*models.RatingTemplate{
+		models.DefaultRatingTemplate(models.MediaTypeGame),
+		{MediaType: models.MediaTypeMovie, Criteria: models.RatingCriteria{{Key: "story", Label: "Screenplay", Weight: 1}}},
+	}
+	stats := []models.SubRatingStat{
+		{MediaType: models.MediaTypeGame, Key: "story", Average: 8.25},
+		{MediaType: models.MediaTypeMovie, Key: "story", Average: 7},
+		{MediaType: models.MediaTypeGame, Key: "soundtrack", Average: 9},
+		{MediaType: models.MediaTypeAnime, Key: "animation", Average: 6.4},
+	}
+
+	labelSubRatingStats(stats, templates, models.RatingScaleFiveStar)
+
+	want := []models.SubRatingStat{
+		{MediaType: models.MediaTypeGame, Key: "story", Label: "Story", Average: 8.25, DisplayAverage: 4.1},
+		{MediaType: models.MediaTypeMovie, Key: "story", Label: "Screenplay", Average: 7, DisplayAverage: 3.5},
+		{MediaType: models.MediaTypeGame, Key: "soundtrack", Label: "soundtrack", Average: 9, DisplayAverage: 4.5},
+		{MediaType: models.MediaTypeAnime, Key: "animation", Label: "animation", Average: 6.4, DisplayAverage: 3.2},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
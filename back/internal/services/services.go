@@ -7,9 +7,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"media-tracker/internal/config"
+	"media-tracker/internal/markdown"
 	"media-tracker/internal/models"
 	"media-tracker/internal/repository"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -17,6 +21,19 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	// ErrValidation is wrapped by every error caused by invalid client input.
+	ErrValidation = errors.New("validation failed")
+	// ErrNotFound is returned for resources that do not exist or belong to someone else.
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned when a member of a shared resource asks for more
+	// than their role allows.
+	ErrForbidden = errors.New("not allowed")
+	// ErrStale is returned when a conditional write names a version that is no
+	// longer current, or when a concurrent write got there first.
+	ErrStale = repository.ErrVersionConflict
+)
+
 // AuthService
 type AuthService struct {
 	userRepo  *repository.UserRepository
@@ -65,6 +82,43 @@ func (s *AuthService) GetUser(ctx context.Context, userID uuid.UUID) (*models.Us
 	return s.userRepo.GetByID(ctx, userID)
 }
 
+func (s *AuthService) GetSettings(ctx context.Context, userID uuid.UUID) (*models.UserSettings, error) {
+	return s.userRepo.GetSettings(ctx, userID)
+}
+
+func (s *AuthService) UpdateSettings(ctx context.Context, userID uuid.UUID, req *models.UpdateSettingsRequest) (*models.UserSettings, error) {
+	settings, err := s.userRepo.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AutoStartDate != nil {
+		settings.AutoStartDate = *req.AutoStartDate
+	}
+	if req.AutoFinishDate != nil {
+		settings.AutoFinishDate = *req.AutoFinishDate
+	}
+	if req.AutoFillProgress != nil {
+		settings.AutoFillProgress = *req.AutoFillProgress
+	}
+	if req.AutoCompleteOnProgress != nil {
+		settings.AutoCompleteOnProgress = *req.AutoCompleteOnProgress
+	}
+	if req.RatingScale != nil {
+		if !req.RatingScale.Valid() {
+			return nil, fmt.Errorf("%w: unknown rating scale %q", ErrValidation, *req.RatingScale)
+		}
+		settings.RatingScale = *req.RatingScale
+	}
+	settings.UpdatedAt = time.Now()
+
+	if err := s.userRepo.UpsertSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
 // MediaService
 type MediaService struct {
 	mediaRepo *repository.MediaRepository
@@ -75,19 +129,12 @@ func NewMediaService(mediaRepo *repository.MediaRepository) *MediaService {
 }
 
 func (s *MediaService) Create(ctx context.Context, req *models.CreateMediaRequest) (*models.MediaItem, error) {
-	media := &models.MediaItem{
-		ID:            uuid.New(),
-		Type:          req.Type,
-		Title:         req.Title,
-		OriginalTitle: req.OriginalTitle,
-		Year:          req.Year,
-		CoverURL:      req.CoverURL,
-		Creators:      req.Creators,
-		Genres:        req.Genres,
-		Duration:      req.Duration,
-		Metadata:      req.Metadata,
-		CreatedAt:     time.Now(),
+	externalIDs, err := normalizeExternalIDs(req.ExternalIDs)
+	if err != nil {
+		return nil, err
 	}
+	media := newMediaItem(req)
+	media.ExternalIDs = externalIDs
 
 	if err := s.mediaRepo.Create(ctx, media); err != nil {
 		return nil, err
@@ -146,14 +193,34 @@ func (s *MediaService) Search(ctx context.Context, query string, mediaType *mode
 
 // EntryService
 type EntryService struct {
-	entryRepo *repository.EntryRepository
-	mediaRepo *repository.MediaRepository
+	entryRepo      *repository.EntryRepository
+	mediaRepo      *repository.MediaRepository
+	userRepo       *repository.UserRepository
+	collectionRepo *repository.CollectionRepository
+	transactor     *repository.Transactor
+	events         *EventBus
+}
+
+func NewEntryService(entryRepo *repository.EntryRepository, mediaRepo *repository.MediaRepository, userRepo *repository.UserRepository,
+	collectionRepo *repository.CollectionRepository, transactor *repository.Transactor, events *EventBus) *EntryService {
+	return &EntryService{entryRepo: entryRepo, mediaRepo: mediaRepo, userRepo: userRepo, collectionRepo: collectionRepo,
+		transactor: transactor, events: events}
 }
 
-func NewEntryService(entryRepo *repository.EntryRepository, mediaRepo *repository.MediaRepository) *EntryService {
-	return &EntryService{entryRepo: entryRepo, mediaRepo: mediaRepo}
+// withTx returns a copy of the service whose repositories run in tx. The copy
+// publishes no events; the caller announces the changes once tx commits.
+func (s *EntryService) withTx(tx *sql.Tx) *EntryService {
+	return &EntryService{
+		entryRepo:      s.entryRepo.WithTx(tx),
+		mediaRepo:      s.mediaRepo.WithTx(tx),
+		userRepo:       s.userRepo.WithTx(tx),
+		collectionRepo: s.collectionRepo.WithTx(tx),
+		transactor:     s.transactor,
+	}
 }
 
+// Create adds an entry, or updates the user's existing entry for the media.
+// The rating is on the user's rating scale.
 func (s *EntryService) Create(ctx context.Context, userID uuid.UUID, req *models.CreateEntryRequest) (*models.Entry, error) {
 	// Verify media exists
 	media, err := s.mediaRepo.GetByID(ctx, req.MediaID)
@@ -161,6 +228,51 @@ func (s *EntryService) Create(ctx context.Context, userID uuid.UUID, req *models
 		return nil, err
 	}
 
+	settings, err := s.userRepo.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rating, err := canonicalRating(settings.RatingScale, req.Rating)
+	if err != nil {
+		return nil, err
+	}
+	template, err := s.userRepo.GetRatingTemplate(ctx, userID, media.Type)
+	if err != nil {
+		return nil, err
+	}
+	subRatings, err := canonicalSubRatings(template, settings.RatingScale, req.SubRatings)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.Entry{
+		ID:           uuid.New(),
+		UserID:       userID,
+		MediaID:      req.MediaID,
+		Status:       req.Status,
+		Rating:       rating,
+		RatingMode:   req.RatingMode,
+		SubRatings:   subRatings,
+		ReviewMD:     req.ReviewMD,
+		PrivateNotes: req.PrivateNotes,
+		Visibility:   req.Visibility,
+		Progress:     req.Progress,
+		StartedAt:    req.StartedAt,
+		FinishedAt:   req.FinishedAt,
+		UpdatedAt:    time.Now(),
+		Version:      1,
+		Media:        media,
+	}
+	if entry.Visibility == "" {
+		entry.Visibility = models.VisibilityPublic
+	}
+	if entry.RatingMode == "" {
+		entry.RatingMode = models.RatingModeManual
+	}
+	if err := applyRatingMode(entry, template, req.Rating != nil); err != nil {
+		return nil, err
+	}
+
 	// Check if entry already exists for this user and media
 	existingEntries, err := s.entryRepo.ListByUserAndMedia(ctx, userID, req.MediaID)
 	if err != nil {
@@ -168,283 +280,1396 @@ func (s *EntryService) Create(ctx context.Context, userID uuid.UUID, req *models
 	}
 
 	if len(existingEntries) > 0 {
-		// Update existing entry instead of creating new one
-		existingEntry := existingEntries[0]
-		return s.Update(ctx, existingEntry.ID, req)
+		// Update existing entry instead of creating new one. If the previous pass was
+		// already finished this is a rewatch/reread, so it gets a cycle of its own
+		// rather than overwriting the dates and rating of the first one.
+		existingID := existingEntries[0].ID
+		err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+			txService := s.withTx(tx)
+			if err := txService.startCycleIfRepeated(ctx, existingID, req); err != nil {
+				return err
+			}
+			_, err := txService.Update(ctx, userID, existingID, req.AsUpdate(), nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s.reloadAndPublish(ctx, userID, existingID)
 	}
 
-	entry := &models.Entry{
-		ID:         uuid.New(),
-		UserID:     userID,
-		MediaID:    req.MediaID,
-		Status:     req.Status,
-		Rating:     req.Rating,
-		ReviewMD:   req.ReviewMD,
-		Progress:   req.Progress,
-		StartedAt:  req.StartedAt,
-		FinishedAt: req.FinishedAt,
-		UpdatedAt:  time.Now(),
-		Media:      media,
+	applyTransitionRules(entry, nil, settings, entry.UpdatedAt)
+
+	if err := validateEntry(entry); err != nil {
+		return nil, err
 	}
 
 	if err := s.entryRepo.Create(ctx, entry); err != nil {
 		return nil, err
 	}
 
-	return entry, nil
-}
+	if err := s.syncCurrentCycle(ctx, entry, true); err != nil {
+		return nil, err
+	}
 
-func (s *EntryService) List(ctx context.Context, userID uuid.UUID, status *models.Status, mediaType *models.MediaType) ([]*models.Entry, error) {
-	return s.entryRepo.ListByUser(ctx, userID, status, mediaType)
-}
+	if err := s.recordChanges(ctx, nil, entry); err != nil {
+		return nil, err
+	}
 
-func (s *EntryService) ListByUserAndMedia(ctx context.Context, userID uuid.UUID, mediaID uuid.UUID) ([]*models.Entry, error) {
-	return s.entryRepo.ListByUserAndMedia(ctx, userID, mediaID)
+	renderReview(entry)
+	entry.SetRatingScale(settings.RatingScale)
+	s.events.Publish(ctx, userID, models.ChangeEntryCreated, entry.ID, entry)
+	return entry, nil
 }
 
-func (s *EntryService) Get(ctx context.Context, id uuid.UUID) (*models.Entry, error) {
-	return s.entryRepo.GetByID(ctx, id)
-}
+const (
+	defaultEntryPageSize = 50
+	maxEntryPageSize     = 200
+)
 
-func (s *EntryService) Update(ctx context.Context, id uuid.UUID, req *models.CreateEntryRequest) (*models.Entry, error) {
-	entry, err := s.entryRepo.GetByID(ctx, id)
-	if err != nil {
+// List returns one page of the user's entries. An empty query lists the most
+// recently updated entries first, defaultEntryPageSize at a time.
+func (s *EntryService) List(ctx context.Context, userID uuid.UUID, query *models.EntryListQuery) (*models.EntryPage, error) {
+	if err := normalizeEntryListQuery(query); err != nil {
 		return nil, err
 	}
 
-	entry.Status = req.Status
-	entry.Rating = req.Rating
-	entry.ReviewMD = req.ReviewMD
-	entry.Progress = req.Progress
-	entry.StartedAt = req.StartedAt
-	entry.FinishedAt = req.FinishedAt
-	entry.UpdatedAt = time.Now()
+	// Rating bounds are on the user's scale.
+	if query.RatingMin != nil || query.RatingMax != nil {
+		settings, err := s.userRepo.GetSettings(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if query.RatingMin, err = canonicalRatingBound(settings.RatingScale, query.RatingMin, false); err != nil {
+			return nil, err
+		}
+		if query.RatingMax, err = canonicalRatingBound(settings.RatingScale, query.RatingMax, true); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := s.entryRepo.Update(ctx, entry); err != nil {
+	entries, nextCursor, err := s.entryRepo.ListByUser(ctx, userID, query)
+	if err != nil {
 		return nil, err
 	}
+	for _, entry := range entries {
+		renderReview(entry)
+	}
 
-	return entry, nil
+	return &models.EntryPage{Entries: entries, NextCursor: nextCursor}, nil
 }
 
-func (s *EntryService) Delete(ctx context.Context, id uuid.UUID) error {
-	return s.entryRepo.Delete(ctx, id)
-}
+// normalizeEntryListQuery checks a list query and fills in its defaults.
+func normalizeEntryListQuery(query *models.EntryListQuery) error {
+	if query.Sort == "" {
+		query.Sort = models.EntrySortUpdated
+	}
+	if _, ok := entrySorts[query.Sort]; !ok {
+		return fmt.Errorf("%w: unknown sort %q", ErrValidation, query.Sort)
+	}
+	if query.Status != nil && !query.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrValidation, *query.Status)
+	}
+	if query.Cursor != nil && (query.Cursor.Sort != query.Sort || query.Cursor.Descending != query.Descending) {
+		return fmt.Errorf("%w: cursor was issued for a different sort order", ErrValidation)
+	}
+	tags, err := normalizeTags(query.Tags)
+	if err != nil {
+		return err
+	}
+	query.Tags = tags
 
-// CollectionService
-type CollectionService struct {
-	collectionRepo *repository.CollectionRepository
-	entryRepo      *repository.EntryRepository
+	switch {
+	case query.Limit <= 0:
+		query.Limit = defaultEntryPageSize
+	case query.Limit > maxEntryPageSize:
+		query.Limit = maxEntryPageSize
+	}
+	return nil
 }
 
-func NewCollectionService(collectionRepo *repository.CollectionRepository, entryRepo *repository.EntryRepository) *CollectionService {
-	return &CollectionService{collectionRepo: collectionRepo, entryRepo: entryRepo}
+var entrySorts = map[models.EntrySort]bool{
+	models.EntrySortUpdated:  true,
+	models.EntrySortRating:   true,
+	models.EntrySortTitle:    true,
+	models.EntrySortStarted:  true,
+	models.EntrySortFinished: true,
+	models.EntrySortProgress: true,
 }
 
-func (s *CollectionService) Create(ctx context.Context, userID uuid.UUID, req *models.CreateCollectionRequest) (*models.Collection, error) {
-	collection := &models.Collection{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Title:     req.Title,
-		IsPublic:  req.IsPublic,
-		CreatedAt: time.Now(),
+func (s *EntryService) ListByUserAndMedia(ctx context.Context, userID uuid.UUID, mediaID uuid.UUID) ([]*models.Entry, error) {
+	entries, err := s.entryRepo.ListByUserAndMedia(ctx, userID, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		renderReview(entry)
 	}
+	return entries, nil
+}
 
-	if err := s.collectionRepo.Create(ctx, collection); err != nil {
+// Get returns one of the user's entries with its cycles. Other users' entries
+// are not found.
+func (s *EntryService) Get(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Entry, error) {
+	entry, err := s.getOwnedEntry(ctx, userID, id)
+	if err != nil {
 		return nil, err
 	}
 
-	// Add entries to collection if provided
-	if len(req.EntryIDs) > 0 {
-		if err := s.collectionRepo.AddEntries(ctx, collection.ID, req.EntryIDs); err != nil {
-			// If adding entries fails, we should probably clean up the collection
-			// For now, just log the error and continue
-			fmt.Printf("Warning: Failed to add entries to collection: %v\n", err)
-		}
+	entry.Cycles, err = s.entryRepo.ListCycles(ctx, id)
+	if err != nil {
+		return nil, err
 	}
+	renderReview(entry)
+	entry.SetRatingScale(entry.RatingScale)
 
-	return collection, nil
+	return entry, nil
 }
 
-func (s *CollectionService) List(ctx context.Context, userID uuid.UUID) ([]*models.Collection, error) {
-	collections, err := s.collectionRepo.ListByUser(ctx, userID)
+// Update applies a partial update to one of the user's entries. If ifVersion
+// is set the update only goes through while the entry is still at that version.
+func (s *EntryService) Update(ctx context.Context, userID uuid.UUID, id uuid.UUID, req *models.UpdateEntryRequest,
+	ifVersion *int) (*models.Entry, error) {
+	entry, err := s.getOwnedEntry(ctx, userID, id)
 	if err != nil {
 		return nil, err
 	}
-
-	// Load entries for each collection
-	for _, collection := range collections {
-		entries, err := s.collectionRepo.GetEntries(ctx, collection.ID)
-		if err != nil {
-			// If we can't load entries, set empty array
-			fmt.Printf("Warning: Failed to load entries for collection %s: %v\n", collection.ID, err)
-			collection.Entries = []models.Entry{}
-		} else {
-			// Convert []*models.Entry to []models.Entry
-			collection.Entries = make([]models.Entry, len(entries))
-			for i, entry := range entries {
-				collection.Entries[i] = *entry
-			}
-		}
+	if ifVersion != nil && *ifVersion != entry.Version {
+		return nil, ErrStale
 	}
 
-	return collections, nil
-}
-
-func (s *CollectionService) Update(ctx context.Context, id uuid.UUID, userID uuid.UUID, req *models.CreateCollectionRequest) (*models.Collection, error) {
-	// Get existing collection
-	collection, err := s.collectionRepo.GetByID(ctx, id)
+	settings, err := s.userRepo.GetSettings(ctx, entry.UserID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if user owns the collection
-	if collection.UserID != userID {
-		return nil, fmt.Errorf("unauthorized: user does not own this collection")
+	template, err := s.userRepo.GetRatingTemplate(ctx, entry.UserID, entry.Media.Type)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update collection fields
-	collection.Title = req.Title
-	collection.IsPublic = req.IsPublic
+	before := *entry
+	if err := applyEntryUpdate(entry, req, settings.RatingScale, template); err != nil {
+		return nil, err
+	}
 
-	// Update in database
-	if err := s.collectionRepo.Update(ctx, collection); err != nil {
+	if err := validateTransition(before.Status, entry.Status); err != nil {
 		return nil, err
 	}
 
-	// Update entries in collection
-	// Remove all existing entries
-	if err := s.collectionRepo.RemoveEntries(ctx, id); err != nil {
-		fmt.Printf("Warning: Failed to remove existing entries: %v\n", err)
+	entry.UpdatedAt = time.Now()
+	applyTransitionRules(entry, &before, settings, entry.UpdatedAt)
+
+	if err := validateEntry(entry); err != nil {
+		return nil, err
 	}
 
-	// Add new entries
-	if len(req.EntryIDs) > 0 {
-		if err := s.collectionRepo.AddEntries(ctx, id, req.EntryIDs); err != nil {
-			fmt.Printf("Warning: Failed to add entries to collection: %v\n", err)
-		}
+	if err := s.entryRepo.Update(ctx, entry); err != nil {
+		return nil, err
 	}
 
-	return collection, nil
-}
+	ratingChanged := !equalFloatPtr(before.Rating, entry.Rating)
+	if err := s.syncCurrentCycle(ctx, entry, ratingChanged); err != nil {
+		return nil, err
+	}
 
-func (s *CollectionService) Get(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
-	collection, err := s.collectionRepo.GetByID(ctx, id)
-	if err != nil {
+	if err := s.recordChanges(ctx, &before, entry); err != nil {
 		return nil, err
 	}
 
-	// Load entries for the collection
-	entries, err := s.collectionRepo.GetEntries(ctx, id)
-	if err != nil {
-		// If we can't load entries, return collection without entries
-		fmt.Printf("Warning: Failed to load entries for collection: %v\n", err)
-		collection.Entries = []models.Entry{}
-	} else {
-		// Convert []*models.Entry to []models.Entry
-		collection.Entries = make([]models.Entry, len(entries))
-		for i, entry := range entries {
-			collection.Entries[i] = *entry
+	renderReview(entry)
+	entry.SetRatingScale(settings.RatingScale)
+	s.events.Publish(ctx, entry.UserID, models.ChangeEntryUpdated, entry.ID, entry)
+	return entry, nil
+}
+
+// applyEntryUpdate copies the fields present in req onto entry, converting
+// ratings from scale to the canonical one and recomputing a weighted rating
+// with template.
+func applyEntryUpdate(entry *models.Entry, req *models.UpdateEntryRequest, scale models.RatingScale, template *models.RatingTemplate) error {
+	if req.Status.Set {
+		if req.Status.Null {
+			return fmt.Errorf("%w: status cannot be null", ErrValidation)
+		}
+		entry.Status = req.Status.Value
+	}
+	if req.Rating.Set {
+		rating, err := canonicalRating(scale, req.Rating.Ptr())
+		if err != nil {
+			return err
+		}
+		entry.Rating = rating
+	}
+	if req.RatingMode.Set {
+		if req.RatingMode.Null {
+			return fmt.Errorf("%w: rating_mode cannot be null", ErrValidation)
+		}
+		entry.RatingMode = req.RatingMode.Value
+	}
+	if req.SubRatings.Set {
+		subRatings, err := canonicalSubRatings(template, scale, req.SubRatings.Value)
+		if err != nil {
+			return err
+		}
+		entry.SubRatings = subRatings
+	}
+	if err := applyRatingMode(entry, template, req.Rating.Set && !req.Rating.Null); err != nil {
+		return err
+	}
+	if req.ReviewMD.Set {
+		entry.ReviewMD = req.ReviewMD.Ptr()
+	}
+	if req.PrivateNotes.Set {
+		entry.PrivateNotes = req.PrivateNotes.Ptr()
+	}
+	if req.Visibility.Set {
+		if req.Visibility.Null {
+			return fmt.Errorf("%w: visibility cannot be null", ErrValidation)
+		}
+		entry.Visibility = req.Visibility.Value
+	}
+	if req.Progress.Set {
+		switch {
+		case req.Progress.Null:
+			entry.Progress = nil
+		case req.ReplaceProgress:
+			entry.Progress = req.Progress.Value
+		default:
+			entry.Progress = entry.Progress.MergePatch(req.Progress.Value)
+		}
+		if len(entry.Progress) == 0 {
+			entry.Progress = nil
 		}
 	}
+	if req.StartedAt.Set {
+		entry.StartedAt = req.StartedAt.Ptr()
+	}
+	if req.FinishedAt.Set {
+		entry.FinishedAt = req.FinishedAt.Ptr()
+	}
+	return nil
+}
 
-	return collection, nil
+// validateEntry checks the client-controlled fields of an entry about to be saved.
+func validateEntry(entry *models.Entry) error {
+	if !entry.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrValidation, entry.Status)
+	}
+	if !entry.Visibility.Valid() {
+		return fmt.Errorf("%w: unknown visibility %q", ErrValidation, entry.Visibility)
+	}
+	if err := validateRating(entry.Rating); err != nil {
+		return err
+	}
+	if err := validateDates(entry.StartedAt, entry.FinishedAt); err != nil {
+		return err
+	}
+	return validateProgress(entry.Media.Type, entry.Progress)
 }
 
-func (s *CollectionService) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
-	// Get existing collection to check ownership
-	collection, err := s.collectionRepo.GetByID(ctx, id)
+// Delete moves one of the user's entries to the trash, if it is still at
+// ifVersion when that is set.
+func (s *EntryService) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID, ifVersion *int) error {
+	entry, err := s.getOwnedEntry(ctx, userID, id)
 	if err != nil {
 		return err
 	}
-
-	// Check if user owns the collection
-	if collection.UserID != userID {
-		return fmt.Errorf("unauthorized: user does not own this collection")
+	if ifVersion != nil && *ifVersion != entry.Version {
+		return ErrStale
+	}
+	if err := s.entryRepo.Delete(ctx, id, entry.Version); err != nil {
+		return err
 	}
 
-	// Delete the collection (cascade will handle collection_entries)
-	return s.collectionRepo.Delete(ctx, id)
+	s.events.Publish(ctx, userID, models.ChangeEntryDeleted, id, nil)
+	return nil
 }
 
-// ShareService
-type ShareService struct {
-	shareRepo      *repository.ShareRepository
-	collectionRepo *repository.CollectionRepository
-	entryRepo      *repository.EntryRepository
-}
+// Stats aggregates the user's library. Sub-rating averages are labelled from the
+// user's rating templates and also given on their rating scale.
+func (s *EntryService) Stats(ctx context.Context, userID uuid.UUID) (*models.EntryStats, error) {
+	stats, err := s.entryRepo.Stats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats.SubRatings) == 0 {
+		return stats, nil
+	}
 
-func NewShareService(shareRepo *repository.ShareRepository, collectionRepo *repository.CollectionRepository, entryRepo *repository.EntryRepository) *ShareService {
-	return &ShareService{shareRepo: shareRepo, collectionRepo: collectionRepo, entryRepo: entryRepo}
+	settings, err := s.userRepo.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := s.RatingTemplates(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	labelSubRatingStats(stats.SubRatings, templates, settings.RatingScale)
+	return stats, nil
 }
 
-func (s *ShareService) CreateShareToken(ctx context.Context, kind string, targetID uuid.UUID) (*models.ShareToken, error) {
-	token := generateToken()
-
-	share := &models.ShareToken{
-		Token:     token,
-		Kind:      kind,
-		TargetID:  targetID,
-		CreatedAt: time.Now(),
-		ExpiresAt: &[]time.Time{time.Now().AddDate(0, 1, 0)}[0], // 1 month
+// labelSubRatingStats labels sub-rating averages from the templates of their
+// media types, falling back to the key, and gives them on scale.
+func labelSubRatingStats(stats []models.SubRatingStat, templates []*models.RatingTemplate, scale models.RatingScale) {
+	byType := make(map[models.MediaType]*models.RatingTemplate, len(templates))
+	for _, template := range templates {
+		byType[template.MediaType] = template
 	}
 
-	if err := s.shareRepo.Create(ctx, share); err != nil {
-		return nil, err
+	for i := range stats {
+		stat := &stats[i]
+		stat.Label = stat.Key
+		if template, ok := byType[stat.MediaType]; ok {
+			if criterion, ok := template.Criteria.Find(stat.Key); ok {
+				stat.Label = criterion.Label
+			}
+		}
+		stat.DisplayAverage = math.Round(scale.Display(stat.Average)*10) / 10
 	}
-
-	return share, nil
 }
 
-func (s *ShareService) GetPublicShare(ctx context.Context, token string) (interface{}, error) {
-	share, err := s.shareRepo.GetByToken(ctx, token)
+// ListCycles returns every consumption cycle of one of the user's entries.
+func (s *EntryService) ListCycles(ctx context.Context, userID uuid.UUID, entryID uuid.UUID) ([]models.EntryCycle, error) {
+	entry, err := s.getOwnedEntry(ctx, userID, entryID)
 	if err != nil {
 		return nil, err
 	}
 
-	switch share.Kind {
-	case "collection":
-		fmt.Printf("DEBUG: Getting collection with ID: %s\n", share.TargetID)
-		collection, err := s.collectionRepo.GetByIDWithEntries(ctx, share.TargetID)
-		if err != nil {
-			fmt.Printf("DEBUG: Error getting collection: %v\n", err)
-			return nil, err
-		}
-		fmt.Printf("DEBUG: Collection has %d entries\n", len(collection.Entries))
-		return collection, nil
-	case "profile":
-		// Return user's entries
-		entries, err := s.entryRepo.ListByUser(ctx, share.TargetID, nil, nil)
-		if err != nil {
-			return nil, err
-		}
-		// Convert []*models.Entry to []models.Entry
-		result := make([]models.Entry, len(entries))
-		for i, entry := range entries {
-			result[i] = *entry
-		}
-		return result, nil
-	default:
-		return nil, errors.New("unknown share kind")
+	entry.Cycles, err = s.entryRepo.ListCycles(ctx, entryID)
+	if err != nil {
+		return nil, err
 	}
+	entry.SetRatingScale(entry.RatingScale)
+	return entry.Cycles, nil
 }
 
-// GuestService
-type GuestService struct {
-	entryRepo *repository.EntryRepository
-	mediaRepo *repository.MediaRepository
-	shareRepo *repository.ShareRepository
-}
+// AddCycle starts a new cycle (a rewatch, reread or replay) and makes it the
+// entry's current one. A cycle sent with a finish date records a finished pass.
+func (s *EntryService) AddCycle(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, req *models.CycleRequest) (*models.Entry, error) {
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		return s.withTx(tx).addCycle(ctx, userID, entryID, req)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-func NewGuestService(entryRepo *repository.EntryRepository, mediaRepo *repository.MediaRepository, shareRepo *repository.ShareRepository) *GuestService {
-	return &GuestService{entryRepo: entryRepo, mediaRepo: mediaRepo, shareRepo: shareRepo}
+	return s.reloadAndPublish(ctx, userID, entryID)
 }
 
-func (s *GuestService) CreateSnapshot(ctx context.Context, req *models.GuestSnapshotRequest) (*models.ShareToken, error) {
-	// Create snapshot ID
-	snapshotID := uuid.New()
+func (s *EntryService) addCycle(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, req *models.CycleRequest) error {
+	entry, err := s.getOwnedEntry(ctx, userID, entryID)
+	if err != nil {
+		return err
+	}
 
-	// Create share token for snapshot
+	rating, err := canonicalRating(entry.RatingScale, req.Rating)
+	if err != nil {
+		return err
+	}
+	if err := validateCycle(req.StartedAt, req.FinishedAt, rating); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	cycle := &models.EntryCycle{
+		ID:         uuid.New(),
+		EntryID:    entryID,
+		Completed:  req.FinishedAt != nil,
+		StartedAt:  req.StartedAt,
+		FinishedAt: req.FinishedAt,
+		Rating:     rating,
+		Notes:      req.Notes,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if cycle.StartedAt == nil && cycle.FinishedAt == nil {
+		today := truncateToDate(now)
+		cycle.StartedAt = &today
+	}
+
+	if err := s.entryRepo.CreateCycle(ctx, cycle); err != nil {
+		return err
+	}
+
+	if rating != nil {
+		entry.Rating = rating
+	}
+	return s.mirrorCycle(ctx, entry, cycle)
+}
+
+// UpdateCycle changes the dates, rating or notes of a cycle. Fields left out of
+// req are kept and an explicit null clears one; clearing finished_at reopens the cycle.
+func (s *EntryService) UpdateCycle(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, cycleID uuid.UUID,
+	req *models.UpdateCycleRequest) (*models.Entry, error) {
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		return s.withTx(tx).updateCycle(ctx, userID, entryID, cycleID, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reloadAndPublish(ctx, userID, entryID)
+}
+
+func (s *EntryService) updateCycle(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, cycleID uuid.UUID,
+	req *models.UpdateCycleRequest) error {
+	entry, err := s.getOwnedEntry(ctx, userID, entryID)
+	if err != nil {
+		return err
+	}
+
+	cycle, err := s.entryRepo.GetCycle(ctx, entryID, cycleID)
+	if err != nil {
+		return err
+	}
+
+	if req.StartedAt.Set {
+		cycle.StartedAt = req.StartedAt.Ptr()
+	}
+	if req.FinishedAt.Set {
+		cycle.FinishedAt = req.FinishedAt.Ptr()
+		cycle.Completed = cycle.FinishedAt != nil
+	}
+	if req.Rating.Set {
+		if cycle.Rating, err = canonicalRating(entry.RatingScale, req.Rating.Ptr()); err != nil {
+			return err
+		}
+	}
+	if req.Notes.Set {
+		cycle.Notes = req.Notes.Ptr()
+	}
+
+	if err := validateCycle(cycle.StartedAt, cycle.FinishedAt, cycle.Rating); err != nil {
+		return err
+	}
+
+	cycle.UpdatedAt = time.Now()
+	if err := s.entryRepo.UpdateCycle(ctx, cycle); err != nil {
+		return err
+	}
+
+	current, err := s.entryRepo.CurrentCycle(ctx, entryID)
+	if err != nil {
+		return err
+	}
+	if current.ID != cycle.ID {
+		return nil
+	}
+	return s.mirrorCycle(ctx, entry, cycle)
+}
+
+// DeleteCycle removes a cycle; when it was the current one the entry falls back to the previous cycle.
+func (s *EntryService) DeleteCycle(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, cycleID uuid.UUID) (*models.Entry, error) {
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		return s.withTx(tx).deleteCycle(ctx, userID, entryID, cycleID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reloadAndPublish(ctx, userID, entryID)
+}
+
+func (s *EntryService) deleteCycle(ctx context.Context, userID uuid.UUID, entryID uuid.UUID, cycleID uuid.UUID) error {
+	entry, err := s.getOwnedEntry(ctx, userID, entryID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.entryRepo.GetCycle(ctx, entryID, cycleID); err != nil {
+		return err
+	}
+
+	if err := s.entryRepo.DeleteCycle(ctx, cycleID); err != nil {
+		return err
+	}
+
+	current, err := s.entryRepo.CurrentCycle(ctx, entryID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		current = &models.EntryCycle{}
+	case err != nil:
+		return err
+	}
+
+	if equalTimePtr(entry.StartedAt, current.StartedAt) && equalTimePtr(entry.FinishedAt, current.FinishedAt) {
+		return nil
+	}
+	entry.StartedAt = current.StartedAt
+	entry.FinishedAt = current.FinishedAt
+	entry.UpdatedAt = time.Now()
+	return s.entryRepo.Update(ctx, entry)
+}
+
+// reloadAndPublish returns an entry as it is after a write and announces the change.
+func (s *EntryService) reloadAndPublish(ctx context.Context, userID uuid.UUID, entryID uuid.UUID) (*models.Entry, error) {
+	entry, err := s.Get(ctx, userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(ctx, userID, models.ChangeEntryUpdated, entryID, entry)
+	return entry, nil
+}
+
+func (s *EntryService) getOwnedEntry(ctx context.Context, userID uuid.UUID, entryID uuid.UUID) (*models.Entry, error) {
+	entry, err := s.entryRepo.GetByID(ctx, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// startCycleIfRepeated opens a new cycle when req repeats an entry whose current
+// cycle is already finished: it is started again, or finished again on a later date.
+func (s *EntryService) startCycleIfRepeated(ctx context.Context, entryID uuid.UUID, req *models.CreateEntryRequest) error {
+	current, err := s.entryRepo.CurrentCycle(ctx, entryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !current.Completed {
+		return nil
+	}
+
+	repeated := false
+	switch req.Status {
+	case models.StatusInProgress:
+		repeated = true
+	case models.StatusCompleted:
+		repeated = req.FinishedAt != nil && current.FinishedAt != nil && req.FinishedAt.After(*current.FinishedAt)
+	}
+	if !repeated {
+		return nil
+	}
+
+	now := time.Now()
+	return s.entryRepo.CreateCycle(ctx, &models.EntryCycle{
+		ID:        uuid.New(),
+		EntryID:   entryID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+// syncCurrentCycle copies the entry's dates and completion into its current cycle,
+// creating the first cycle once the entry is no longer just planned. The cycle rating
+// only follows the entry rating when the rating was part of this change.
+func (s *EntryService) syncCurrentCycle(ctx context.Context, entry *models.Entry, ratingChanged bool) error {
+	completed := entry.Status == models.StatusCompleted
+
+	current, err := s.entryRepo.CurrentCycle(ctx, entry.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if entry.Status == models.StatusPlanned && entry.StartedAt == nil && entry.FinishedAt == nil {
+			return nil
+		}
+
+		now := time.Now()
+		cycle := &models.EntryCycle{
+			ID:         uuid.New(),
+			EntryID:    entry.ID,
+			Completed:  completed,
+			StartedAt:  entry.StartedAt,
+			FinishedAt: entry.FinishedAt,
+			Rating:     entry.Rating,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if err := s.entryRepo.CreateCycle(ctx, cycle); err != nil {
+			return err
+		}
+		if completed {
+			entry.TimesCompleted++
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case completed && !current.Completed:
+		entry.TimesCompleted++
+	case !completed && current.Completed:
+		entry.TimesCompleted--
+	}
+
+	current.Completed = completed
+	current.StartedAt = entry.StartedAt
+	current.FinishedAt = entry.FinishedAt
+	if ratingChanged {
+		current.Rating = entry.Rating
+	}
+	current.UpdatedAt = time.Now()
+
+	return s.entryRepo.UpdateCycle(ctx, current)
+}
+
+// mirrorCycle makes the entry reflect its (new) current cycle.
+func (s *EntryService) mirrorCycle(ctx context.Context, entry *models.Entry, cycle *models.EntryCycle) error {
+	before := *entry
+
+	entry.StartedAt = cycle.StartedAt
+	entry.FinishedAt = cycle.FinishedAt
+	if cycle.Completed {
+		entry.Status = models.StatusCompleted
+	} else {
+		entry.Status = models.StatusInProgress
+	}
+	entry.UpdatedAt = time.Now()
+	if err := s.entryRepo.Update(ctx, entry); err != nil {
+		return err
+	}
+
+	return s.recordChanges(ctx, &before, entry)
+}
+
+// CollectionService
+type CollectionService struct {
+	entries        *EntryService
+	collectionRepo *repository.CollectionRepository
+	entryRepo      *repository.EntryRepository
+	userRepo       *repository.UserRepository
+	transactor     *repository.Transactor
+	events         *EventBus
+}
+
+func NewCollectionService(entries *EntryService, collectionRepo *repository.CollectionRepository, entryRepo *repository.EntryRepository,
+	userRepo *repository.UserRepository, transactor *repository.Transactor, events *EventBus) *CollectionService {
+	return &CollectionService{entries: entries, collectionRepo: collectionRepo, entryRepo: entryRepo, userRepo: userRepo,
+		transactor: transactor, events: events}
+}
+
+// withTx returns a copy of the service whose repositories run in tx. The copy
+// publishes no events; the caller announces the changes once tx commits.
+func (s *CollectionService) withTx(tx *sql.Tx) *CollectionService {
+	return &CollectionService{
+		entries:        s.entries.withTx(tx),
+		collectionRepo: s.collectionRepo.WithTx(tx),
+		entryRepo:      s.entryRepo.WithTx(tx),
+		userRepo:       s.userRepo,
+		transactor:     s.transactor,
+	}
+}
+
+// Create adds a collection holding req.EntryIDs, in order, or a smart
+// collection defined by req.Rules. Every entry must be one of the user's.
+func (s *CollectionService) Create(ctx context.Context, userID uuid.UUID, req *models.CreateCollectionRequest) (*models.Collection, error) {
+	if req.Rules != nil && len(req.EntryIDs) > 0 {
+		return nil, errSmartCollection
+	}
+	entryIDs, err := s.ownedEntryIDs(ctx, userID, req.EntryIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	collection := &models.Collection{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Title:     req.Title,
+		IsPublic:  req.IsPublic,
+		Role:      models.CollectionRoleOwner,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+	if err := applyCollectionMode(collection, req); err != nil {
+		return nil, err
+	}
+	if err := applyCollectionDetails(collection, req); err != nil {
+		return nil, err
+	}
+	if err := s.applyRules(ctx, collection, req); err != nil {
+		return nil, err
+	}
+
+	err = s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		if err := txService.collectionRepo.Create(ctx, collection); err != nil {
+			return err
+		}
+		return txService.collectionRepo.AddEntries(ctx, collection.ID, entryIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadEntries(ctx, collection, userID); err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(ctx, userID, models.ChangeCollectionCreated, collection.ID, collection)
+	return collection, nil
+}
+
+// List returns the user's own collections followed by those shared with them.
+// With withEntries each comes with its entries, as Get returns them; otherwise
+// only with their count and cover mosaic. Either way the entries of all static
+// collections are read in one query; only smart collections are evaluated one
+// by one.
+func (s *CollectionService) List(ctx context.Context, userID uuid.UUID, withEntries bool) ([]*models.Collection, error) {
+	collections, err := s.collectionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, collection := range collections {
+		collection.Role = models.CollectionRoleOwner
+	}
+	shared, err := s.collectionRepo.ListShared(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	collections = append(collections, shared...)
+
+	var staticIDs []uuid.UUID
+	for _, collection := range collections {
+		if collection.Rules == nil {
+			staticIDs = append(staticIDs, collection.ID)
+		}
+	}
+	var entries map[uuid.UUID][]models.Entry
+	var summaries map[uuid.UUID]models.CollectionSummary
+	if withEntries {
+		entries, err = s.collectionRepo.ListEntries(ctx, staticIDs, false)
+	} else {
+		summaries, err = s.collectionRepo.ListSummaries(ctx, staticIDs, userID, coverMosaicSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scales := make(map[uuid.UUID]models.RatingScale)
+	for _, collection := range collections {
+		switch {
+		case collection.Rules != nil:
+			if err := s.loadSmartEntries(ctx, collection, scales); err != nil {
+				return nil, err
+			}
+			showEntries(collection, userID)
+			if !withEntries {
+				collection.Entries = nil
+			}
+		case withEntries:
+			collection.Entries = entries[collection.ID]
+			showEntries(collection, userID)
+		default:
+			summary := summaries[collection.ID]
+			renderDescription(collection)
+			collection.EntryCount = summary.EntryCount
+			if collection.CoverURL == nil {
+				collection.CoverMosaic = summary.Covers
+			}
+		}
+	}
+
+	return collections, nil
+}
+
+// Update replaces a collection's fields, and its entries when req.EntryIDs is
+// present. Rules turn a static collection into a smart one, dropping its
+// entries; see Snapshot for the way back. Editors may update a collection too,
+// but only its owner may change whether it is public or its rules. If
+// ifVersion is set the update only goes through while the collection is still
+// at that version.
+func (s *CollectionService) Update(ctx context.Context, id uuid.UUID, userID uuid.UUID, req *models.CreateCollectionRequest, ifVersion *int) (*models.Collection, error) {
+	collection, err := s.getAs(ctx, id, userID, models.CollectionRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if collection.Role != models.CollectionRoleOwner && (req.IsPublic != collection.IsPublic || req.Rules != nil) {
+		return nil, fmt.Errorf("%w: only the owner may change whether the collection is public or its rules", ErrForbidden)
+	}
+	if ifVersion != nil && *ifVersion != collection.Version {
+		return nil, ErrStale
+	}
+	if req.EntryIDs != nil && (req.Rules != nil || collection.Rules != nil) {
+		return nil, errSmartCollection
+	}
+
+	var entryIDs []uuid.UUID
+	if req.EntryIDs != nil {
+		// Entries other members added may stay.
+		slots, err := s.collectionRepo.ListSlots(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		inCollection := make(map[uuid.UUID]bool, len(slots))
+		for _, slot := range slots {
+			inCollection[slot.EntryID] = true
+		}
+		if entryIDs, err = s.ownedEntryIDs(ctx, userID, req.EntryIDs, inCollection); err != nil {
+			return nil, err
+		}
+
+		// Other members' private entries, which the user cannot see, stay too.
+		entries, err := s.collectionRepo.GetEntries(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.UserID != userID && entry.Visibility == models.VisibilityPrivate && !slices.Contains(entryIDs, entry.ID) {
+				entryIDs = append(entryIDs, entry.ID)
+			}
+		}
+	}
+
+	// Update collection fields
+	before := *collection
+	collection.Title = req.Title
+	collection.IsPublic = req.IsPublic
+	collection.UpdatedAt = time.Now()
+	if err := applyCollectionMode(collection, req); err != nil {
+		return nil, err
+	}
+	if err := applyCollectionDetails(collection, req); err != nil {
+		return nil, err
+	}
+	if err := s.applyRules(ctx, collection, req); err != nil {
+		return nil, err
+	}
+	regroup := collection.Mode == models.CollectionModeTiered &&
+		(before.Mode != models.CollectionModeTiered || !slices.Equal(before.Tiers, collection.Tiers))
+
+	err = s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		if err := txService.collectionRepo.Update(ctx, collection); err != nil {
+			return err
+		}
+		if before.Rules == nil && collection.Rules != nil {
+			return txService.collectionRepo.RemoveEntries(ctx, id)
+		}
+		if req.EntryIDs == nil && !regroup {
+			return nil
+		}
+		return txService.arrangeEntries(ctx, collection, entryIDs, req.EntryIDs != nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadEntries(ctx, collection, userID); err != nil {
+		return nil, err
+	}
+
+	s.publishCollection(ctx, userID, models.ChangeCollectionUpdated, collection)
+	return collection, nil
+}
+
+// Get returns a collection the user owns or is a member of.
+func (s *CollectionService) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Collection, error) {
+	collection, err := s.getAs(ctx, id, userID, models.CollectionRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadEntries(ctx, collection, userID); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// loadEntries fills in a collection's entries as userID may see them,
+// evaluating the rules of a smart collection, and shows them (see showEntries).
+func (s *CollectionService) loadEntries(ctx context.Context, collection *models.Collection, userID uuid.UUID) error {
+	if collection.Rules != nil {
+		if err := s.loadSmartEntries(ctx, collection, nil); err != nil {
+			return err
+		}
+	} else {
+		entries, err := s.collectionRepo.GetEntries(ctx, collection.ID)
+		if err != nil {
+			return err
+		}
+		collection.Entries = entries
+	}
+
+	showEntries(collection, userID)
+	return nil
+}
+
+// loadSmartEntries evaluates the rules of a smart collection, which it then
+// shows on the owner's rating scale. Members get the entries but, as with
+// shares, not the rules, which may name the owner's private tags. scales, if
+// not nil, caches the owners' rating scales across calls.
+func (s *CollectionService) loadSmartEntries(ctx context.Context, collection *models.Collection,
+	scales map[uuid.UUID]models.RatingScale) error {
+	scale, ok := scales[collection.UserID]
+	if !ok {
+		settings, err := s.userRepo.GetSettings(ctx, collection.UserID)
+		if err != nil {
+			return err
+		}
+		scale = settings.RatingScale
+		if scales != nil {
+			scales[collection.UserID] = scale
+		}
+	}
+
+	var err error
+	if collection.Entries, err = smartEntries(ctx, s.entryRepo, collection, false); err != nil {
+		return err
+	}
+	collection.Rules = displayRules(collection.Rules, scale)
+	if collection.Role != models.CollectionRoleOwner {
+		collection.Rules = nil
+	}
+	return nil
+}
+
+// showEntries narrows a collection's loaded entries to those userID may see
+// (see memberEntries), ranks them and sets the count and cover mosaic.
+func showEntries(collection *models.Collection, userID uuid.UUID) {
+	collection.Entries = memberEntries(collection.Entries, userID)
+	for i := range collection.Entries {
+		renderReview(&collection.Entries[i])
+	}
+	rankEntries(collection)
+	renderDescription(collection)
+	setCoverMosaic(collection)
+	collection.EntryCount = len(collection.Entries)
+}
+
+// applyRules sets the rules req gives, on the user's rating scale, making the
+// collection smart. Smart collections are not tiered: their order comes from
+// the rules.
+func (s *CollectionService) applyRules(ctx context.Context, collection *models.Collection, req *models.CreateCollectionRequest) error {
+	if req.Rules != nil {
+		settings, err := s.userRepo.GetSettings(ctx, collection.UserID)
+		if err != nil {
+			return err
+		}
+		if collection.Rules, err = canonicalRules(req.Rules, settings.RatingScale); err != nil {
+			return err
+		}
+	}
+	if collection.Rules != nil && collection.Mode == models.CollectionModeTiered {
+		return fmt.Errorf("%w: smart collections cannot be tiered", ErrValidation)
+	}
+	return nil
+}
+
+// AddEntry adds one of the user's entries to their collection, or moves it
+// there, as req says (see placeSlot), and returns the collection.
+func (s *CollectionService) AddEntry(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryID uuid.UUID,
+	req *models.PlaceEntryRequest) (*models.Collection, error) {
+	owned, err := s.entryRepo.FilterOwned(ctx, userID, []uuid.UUID{entryID})
+	if err != nil {
+		return nil, err
+	}
+	if !owned[entryID] {
+		return nil, ErrNotFound
+	}
+
+	err = s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		collection, err := txService.getStatic(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		slots, err := txService.collectionRepo.ListSlots(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		slots, changed, err := placeSlot(collection, slots, entryID, req)
+		if err != nil || !changed {
+			return err
+		}
+		if err := txService.collectionRepo.WriteSlots(ctx, id, slots); err != nil {
+			return err
+		}
+		return txService.collectionRepo.Touch(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reloadAndPublish(ctx, id, userID)
+}
+
+// RemoveEntry takes an entry out of the user's collection and returns the
+// collection. Removing an entry that is not in it changes nothing.
+func (s *CollectionService) RemoveEntry(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryID uuid.UUID) (*models.Collection, error) {
+	if _, err := s.getStatic(ctx, id, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.collectionRepo.RemoveEntry(ctx, id, entryID); err != nil {
+		return nil, err
+	}
+	return s.reloadAndPublish(ctx, id, userID)
+}
+
+// ReorderEntries puts the entries of the user's collection in the order of
+// entryIDs, which must list each of them exactly once. Entries keep their
+// tiers, so in a tiered collection this orders them within each tier.
+func (s *CollectionService) ReorderEntries(ctx context.Context, id uuid.UUID, userID uuid.UUID, entryIDs []uuid.UUID) (*models.Collection, error) {
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		collection, err := txService.getStatic(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		current, err := txService.collectionRepo.GetEntries(ctx, id)
+		if err != nil {
+			return err
+		}
+		current = memberEntries(current, userID)
+		inCollection := make(map[uuid.UUID]bool, len(current))
+		for _, entry := range current {
+			inCollection[entry.ID] = true
+		}
+		if len(entryIDs) != len(current) {
+			return fmt.Errorf("%w: entry_ids must list each of the collection's %d entries once", ErrValidation, len(current))
+		}
+		for _, entryID := range entryIDs {
+			if !inCollection[entryID] {
+				return fmt.Errorf("%w: entry %s is not in the collection or is listed twice", ErrValidation, entryID)
+			}
+			delete(inCollection, entryID)
+		}
+
+		slots, err := txService.collectionRepo.ListSlots(ctx, id)
+		if err != nil {
+			return err
+		}
+		rank := make(map[uuid.UUID]int, len(entryIDs))
+		for i, entryID := range entryIDs {
+			rank[entryID] = i
+		}
+		// Entries in the trash, and other members' private entries, are not
+		// listed; they keep their order after the others.
+		sort.SliceStable(slots, func(i, j int) bool {
+			ri, listedI := rank[slots[i].EntryID]
+			rj, listedJ := rank[slots[j].EntryID]
+			if listedI != listedJ {
+				return listedI
+			}
+			return listedI && ri < rj
+		})
+		if collection.Mode == models.CollectionModeTiered {
+			groupSlots(slots, collection.Tiers)
+		}
+
+		if err := txService.collectionRepo.WriteSlots(ctx, id, slots); err != nil {
+			return err
+		}
+		return txService.collectionRepo.Touch(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reloadAndPublish(ctx, id, userID)
+}
+
+// arrangeEntries rewrites the order of a collection's entries after its mode
+// or tiers changed, first replacing the entries with entryIDs when replace is
+// set. Entries keep their tiers and notes.
+func (s *CollectionService) arrangeEntries(ctx context.Context, collection *models.Collection, entryIDs []uuid.UUID, replace bool) error {
+	slots, err := s.collectionRepo.ListSlots(ctx, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		tiers := make(map[uuid.UUID]*string, len(slots))
+		for _, slot := range slots {
+			tiers[slot.EntryID] = slot.Tier
+		}
+		slots = make([]models.CollectionSlot, len(entryIDs))
+		for i, entryID := range entryIDs {
+			slots[i] = models.CollectionSlot{EntryID: entryID, Tier: tiers[entryID]}
+		}
+		if err := s.collectionRepo.RetainEntries(ctx, collection.ID, entryIDs); err != nil {
+			return err
+		}
+	}
+
+	if collection.Mode == models.CollectionModeTiered {
+		groupSlots(slots, collection.Tiers)
+	}
+	return s.collectionRepo.WriteSlots(ctx, collection.ID, slots)
+}
+
+// getOwned returns one of the user's collections.
+func (s *CollectionService) getOwned(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Collection, error) {
+	return s.getAs(ctx, id, userID, models.CollectionRoleOwner)
+}
+
+// getStatic returns a collection the user may edit whose entries can be
+// changed one by one, which those of a smart collection cannot.
+func (s *CollectionService) getStatic(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Collection, error) {
+	collection, err := s.getAs(ctx, id, userID, models.CollectionRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if collection.Rules != nil {
+		return nil, errSmartCollection
+	}
+	return collection, nil
+}
+
+// Snapshot turns the user's smart collection into a static one holding the
+// entries its rules match now, in the same order.
+func (s *CollectionService) Snapshot(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Collection, error) {
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		collection, err := txService.getOwned(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		if collection.Rules == nil {
+			return fmt.Errorf("%w: the collection is not a smart collection", ErrValidation)
+		}
+
+		entries, err := smartEntries(ctx, txService.entryRepo, collection, false)
+		if err != nil {
+			return err
+		}
+		slots := make([]models.CollectionSlot, len(entries))
+		for i, entry := range entries {
+			slots[i] = models.CollectionSlot{EntryID: entry.ID}
+		}
+
+		collection.Rules = nil
+		collection.UpdatedAt = time.Now()
+		if err := txService.collectionRepo.Update(ctx, collection); err != nil {
+			return err
+		}
+		return txService.collectionRepo.WriteSlots(ctx, id, slots)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reloadAndPublish(ctx, id, userID)
+}
+
+// ownedEntryIDs parses the entry IDs of a collection request, dropping
+// duplicates, and checks that each is one of the user's entries or in keep.
+func (s *CollectionService) ownedEntryIDs(ctx context.Context, userID uuid.UUID, ids []string, keep map[uuid.UUID]bool) ([]uuid.UUID, error) {
+	entryIDs := make([]uuid.UUID, 0, len(ids))
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, idStr := range ids {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid entry ID %q", ErrValidation, idStr)
+		}
+		if !seen[id] {
+			seen[id] = true
+			entryIDs = append(entryIDs, id)
+		}
+	}
+	if len(entryIDs) == 0 {
+		return entryIDs, nil
+	}
+
+	owned, err := s.entryRepo.FilterOwned(ctx, userID, entryIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range entryIDs {
+		if !owned[id] && !keep[id] {
+			return nil, fmt.Errorf("%w: entry %s is not one of your entries", ErrValidation, id)
+		}
+	}
+	return entryIDs, nil
+}
+
+// reloadAndPublish returns the collection with its entries and announces the change.
+func (s *CollectionService) reloadAndPublish(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.Collection, error) {
+	collection, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.publishCollection(ctx, userID, models.ChangeCollectionUpdated, collection)
+	return collection, nil
+}
+
+// Delete moves a collection to the trash, if it is still at ifVersion when that is set.
+func (s *CollectionService) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID, ifVersion *int) error {
+	// Only the owner may delete a collection
+	collection, err := s.getOwned(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if ifVersion != nil && *ifVersion != collection.Version {
+		return ErrStale
+	}
+
+	// Move the collection to the trash; its entries stay in it until it is purged
+	if err := s.collectionRepo.Delete(ctx, id, collection.Version); err != nil {
+		return err
+	}
+
+	s.publishCollection(ctx, userID, models.ChangeCollectionDeleted, collection)
+	return nil
+}
+
+// ShareService
+type ShareService struct {
+	shareRepo      *repository.ShareRepository
+	collectionRepo *repository.CollectionRepository
+	entryRepo      *repository.EntryRepository
+	events         *EventBus
+}
+
+func NewShareService(shareRepo *repository.ShareRepository, collectionRepo *repository.CollectionRepository, entryRepo *repository.EntryRepository,
+	events *EventBus) *ShareService {
+	return &ShareService{shareRepo: shareRepo, collectionRepo: collectionRepo, entryRepo: entryRepo, events: events}
+}
+
+// CreateShareToken creates a public link to one of the user's resources.
+func (s *ShareService) CreateShareToken(ctx context.Context, userID uuid.UUID, kind string, targetID uuid.UUID) (*models.ShareToken, error) {
+	switch kind {
+	case "collection":
+		collection, err := s.collectionRepo.GetByID(ctx, targetID)
+		if err != nil {
+			return nil, err
+		}
+		if collection.UserID != userID {
+			return nil, ErrNotFound
+		}
+	case "profile":
+		if targetID != userID {
+			return nil, ErrNotFound
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown share kind %q", ErrValidation, kind)
+	}
+
+	token := generateToken()
+
+	share := &models.ShareToken{
+		Token:     token,
+		Kind:      kind,
+		TargetID:  targetID,
+		CreatedAt: time.Now(),
+		ExpiresAt: &[]time.Time{time.Now().AddDate(0, 1, 0)}[0], // 1 month
+	}
+
+	if err := s.shareRepo.Create(ctx, share); err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(ctx, userID, models.ChangeShareCreated, targetID, share)
+	return share, nil
+}
+
+func (s *ShareService) GetPublicShare(ctx context.Context, token string) (interface{}, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch share.Kind {
+	case "collection":
+		collection, err := s.sharedCollection(ctx, share.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		// As with reviews, the description is only shown sanitized.
+		collection.DescriptionMD = nil
+		for i := range collection.Entries {
+			publicEntry(&collection.Entries[i])
+		}
+		return collection, nil
+	case "profile":
+		// Return the user's public entries
+		public := models.VisibilityPublic
+		entries, _, err := s.entryRepo.ListByUser(ctx, share.TargetID, &models.EntryListQuery{
+			Visibility: &public, Sort: models.EntrySortUpdated, Descending: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Convert []*models.Entry to []models.Entry
+		result := make([]models.Entry, len(entries))
+		for i, entry := range entries {
+			result[i] = *entry
+			renderReview(&result[i])
+			publicEntry(&result[i])
+		}
+		return result, nil
+	default:
+		return nil, errors.New("unknown share kind")
+	}
+}
+
+// GetSharedCollection returns the collection a share token links to, as
+// sharedCollection loads it.
+func (s *ShareService) GetSharedCollection(ctx context.Context, token string) (*models.Collection, error) {
+	share, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if share.Kind != "collection" {
+		return nil, ErrNotFound
+	}
+	return s.sharedCollection(ctx, share.TargetID)
+}
+
+// sharedCollection returns a collection with what anyone viewing its share may
+// see of it: its public entries, ranked, and no rules. The rules of a smart
+// collection may name private tags, so a share shows its entries but not its
+// rules.
+func (s *ShareService) sharedCollection(ctx context.Context, id uuid.UUID) (*models.Collection, error) {
+	collection, err := s.collectionRepo.GetByIDWithPublicEntries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.Rules != nil {
+		if collection.Entries, err = smartEntries(ctx, s.entryRepo, collection, true); err != nil {
+			return nil, err
+		}
+		collection.Rules = nil
+	}
+	for i := range collection.Entries {
+		renderReview(&collection.Entries[i])
+	}
+	rankEntries(collection)
+	renderDescription(collection)
+	setCoverMosaic(collection)
+	collection.EntryCount = len(collection.Entries)
+	return collection, nil
+}
+
+// renderReview fills in the sanitized HTML of an entry's review. Entries are
+// rendered on their way out of the services, after they are loaded, so
+// publicEntry must come after it.
+func renderReview(entry *models.Entry) {
+	entry.ReviewHTML = markdown.RenderPtr(entry.ReviewMD)
+}
+
+// publicEntry strips what anonymous viewers of a share must not get: the
+// owner's private notes, and the raw review markdown, which leaves the review
+// only in its sanitized form.
+func publicEntry(entry *models.Entry) {
+	entry.ReviewMD = nil
+	entry.PrivateNotes = nil
+}
+
+// GuestService
+type GuestService struct {
+	entryRepo *repository.EntryRepository
+	mediaRepo *repository.MediaRepository
+	shareRepo *repository.ShareRepository
+	events    *EventBus
+}
+
+func NewGuestService(entryRepo *repository.EntryRepository, mediaRepo *repository.MediaRepository, shareRepo *repository.ShareRepository,
+	events *EventBus) *GuestService {
+	return &GuestService{entryRepo: entryRepo, mediaRepo: mediaRepo, shareRepo: shareRepo, events: events}
+}
+
+func (s *GuestService) CreateSnapshot(ctx context.Context, req *models.GuestSnapshotRequest) (*models.ShareToken, error) {
+	// Create snapshot ID
+	snapshotID := uuid.New()
+
+	// Create share token for snapshot
 	share := &models.ShareToken{
 		Token:     generateToken(),
 		Kind:      "snapshot",
@@ -464,21 +1689,28 @@ func (s *GuestService) MergeToAccount(ctx context.Context, userID uuid.UUID, gue
 	// Simple merge: create new entries for user
 	for _, guestEntry := range guestEntries {
 		entry := &models.Entry{
-			ID:         uuid.New(),
-			UserID:     userID,
-			MediaID:    guestEntry.MediaID,
-			Status:     guestEntry.Status,
-			Rating:     guestEntry.Rating,
-			ReviewMD:   guestEntry.ReviewMD,
-			Progress:   guestEntry.Progress,
-			StartedAt:  guestEntry.StartedAt,
-			FinishedAt: guestEntry.FinishedAt,
-			UpdatedAt:  time.Now(),
+			ID:           uuid.New(),
+			UserID:       userID,
+			MediaID:      guestEntry.MediaID,
+			Status:       guestEntry.Status,
+			Rating:       guestEntry.Rating,
+			RatingMode:   models.RatingModeManual,
+			ReviewMD:     guestEntry.ReviewMD,
+			PrivateNotes: guestEntry.PrivateNotes,
+			Visibility:   guestEntry.Visibility,
+			Progress:     guestEntry.Progress,
+			StartedAt:    guestEntry.StartedAt,
+			FinishedAt:   guestEntry.FinishedAt,
+			UpdatedAt:    time.Now(),
+		}
+		if !entry.Visibility.Valid() {
+			entry.Visibility = models.VisibilityPublic
 		}
 
 		if err := s.entryRepo.Create(ctx, entry); err != nil {
 			return err
 		}
+		s.events.Publish(ctx, userID, models.ChangeEntryCreated, entry.ID, nil)
 	}
 
 	return nil
@@ -490,3 +1722,42 @@ func generateToken() string {
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
+
+func validateRating(rating *float64) error {
+	if rating != nil && (*rating < 0 || *rating > 10) {
+		return fmt.Errorf("%w: rating must be between 0 and 10", ErrValidation)
+	}
+	return nil
+}
+
+func validateDates(startedAt, finishedAt *time.Time) error {
+	if startedAt != nil && finishedAt != nil && finishedAt.Before(*startedAt) {
+		return fmt.Errorf("%w: finished_at is before started_at", ErrValidation)
+	}
+	return nil
+}
+
+func validateCycle(startedAt, finishedAt *time.Time, rating *float64) error {
+	if err := validateDates(startedAt, finishedAt); err != nil {
+		return err
+	}
+	return validateRating(rating)
+}
+
+func truncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func equalFloatPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeEntryListQuery(t *testing.T) {
+	unknownStatus := models.Status("abandoned")
+
+	tests := []struct {
+		name    string
+		query   models.EntryListQuery
+		want    models.EntryListQuery
+		wantErr bool
+	}{
+		{
+			name: "empty query",
+			want: models.EntryListQuery{Sort: models.EntrySortUpdated, Tags: []string{}, Limit: defaultEntryPageSize},
+		},
+		{
+			name:  "tag filter",
+			query: models.EntryListQuery{Tags: []string{" Cozy", "cozy", "rainy"}, Limit: 10},
+			want:  models.EntryListQuery{Sort: models.EntrySortUpdated, Tags: []string{"cozy", "rainy"}, Limit: 10},
+		},
+		{
+			name:  "limit is capped",
+			query: models.EntryListQuery{Sort: models.EntrySortTitle, Limit: maxEntryPageSize + 1},
+			want:  models.EntryListQuery{Sort: models.EntrySortTitle, Tags: []string{}, Limit: maxEntryPageSize},
+		},
+		{
+			name: "cursor for the same order",
+			query: models.EntryListQuery{Sort: models.EntrySortRating, Descending: true,
+				Cursor: &models.EntryCursor{Sort: models.EntrySortRating, Descending: true}},
+			want: models.EntryListQuery{Sort: models.EntrySortRating, Descending: true, Tags: []string{},
+				Cursor: &models.EntryCursor{Sort: models.EntrySortRating, Descending: true}, Limit: defaultEntryPageSize},
+		},
+		{name: "unknown sort", query: models.EntryListQuery{Sort: "random"}, wantErr: true},
+		{name: "unknown status", query: models.EntryListQuery{Status: &unknownStatus}, wantErr: true},
+		{
+			name:    "cursor for another order",
+			query:   models.EntryListQuery{Sort: models.EntrySortRating, Cursor: &models.EntryCursor{Sort: models.EntrySortTitle}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			err := normalizeEntryListQuery(&query)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(query, tt.want) {
+				t.Errorf("query = %+v, want %+v", query, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateShareTokenRejects(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name     string
+		kind     string
+		targetID uuid.UUID
+		want     error
+	}{
+		{name: "another user's profile", kind: "profile", targetID: uuid.New(), want: ErrNotFound},
+		{name: "unknown kind", kind: "entry", targetID: uuid.New(), want: ErrValidation},
+		{name: "snapshots are made by the guest service", kind: "snapshot", targetID: userID, want: ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&ShareService{}).CreateShareToken(context.Background(), userID, tt.kind, tt.targetID)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEntryUpdate(t *testing.T) {
+	started := time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)
+	finished := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	base := func() *models.Entry {
+		return &models.Entry{
+			Status:     models.StatusInProgress,
+			Rating:     floatPtr(7),
+			RatingMode: models.RatingModeManual,
+			ReviewMD:   strPtr("Slow start."),
+			Visibility: models.VisibilityPublic,
+			Progress:   models.JSONB{"pages": 10.0, "total_pages": 300.0},
+			StartedAt:  &started,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		req     models.UpdateEntryRequest
+		scale   models.RatingScale
+		want    func(entry *models.Entry)
+		wantErr bool
+	}{
+		{name: "empty request keeps everything", want: func(*models.Entry) {}},
+		{
+			name: "only the fields sent change",
+			req:  models.UpdateEntryRequest{Status: models.Some(models.StatusCompleted), FinishedAt: models.Some(finished)},
+			want: func(entry *models.Entry) {
+				entry.Status = models.StatusCompleted
+				entry.FinishedAt = &finished
+			},
+		},
+		{
+			name: "null clears a field",
+			req: models.UpdateEntryRequest{
+				Rating:    models.Optional[float64]{Set: true, Null: true},
+				ReviewMD:  models.Optional[string]{Set: true, Null: true},
+				StartedAt: models.Optional[time.Time]{Set: true, Null: true},
+			},
+			want: func(entry *models.Entry) {
+				entry.Rating = nil
+				entry.ReviewMD = nil
+				entry.StartedAt = nil
+			},
+		},
+		{
+			name:  "rating on the user's scale",
+			req:   models.UpdateEntryRequest{Rating: models.Some(4.5)},
+			scale: models.RatingScaleFiveStar,
+			want:  func(entry *models.Entry) { entry.Rating = floatPtr(9) },
+		},
+		{
+			name: "progress is merged",
+			req:  models.UpdateEntryRequest{Progress: models.Some(models.JSONB{"pages": 42.0, "chapters": 3.0})},
+			want: func(entry *models.Entry) {
+				entry.Progress = models.JSONB{"pages": 42.0, "total_pages": 300.0, "chapters": 3.0}
+			},
+		},
+		{
+			name: "null progress keys are removed",
+			req:  models.UpdateEntryRequest{Progress: models.Some(models.JSONB{"total_pages": nil})},
+			want: func(entry *models.Entry) { entry.Progress = models.JSONB{"pages": 10.0} },
+		},
+		{
+			name: "progress emptied by the patch is cleared",
+			req:  models.UpdateEntryRequest{Progress: models.Some(models.JSONB{"pages": nil, "total_pages": nil})},
+			want: func(entry *models.Entry) { entry.Progress = nil },
+		},
+		{
+			name: "null progress clears it",
+			req:  models.UpdateEntryRequest{Progress: models.Optional[models.JSONB]{Set: true, Null: true}},
+			want: func(entry *models.Entry) { entry.Progress = nil },
+		},
+		{
+			name: "replaced progress",
+			req:  models.UpdateEntryRequest{Progress: models.Some(models.JSONB{"chapters": 3.0}), ReplaceProgress: true},
+			want: func(entry *models.Entry) { entry.Progress = models.JSONB{"chapters": 3.0} },
+		},
+		{name: "null status", req: models.UpdateEntryRequest{Status: models.Optional[models.Status]{Set: true, Null: true}}, wantErr: true},
+		{
+			name:    "null visibility",
+			req:     models.UpdateEntryRequest{Visibility: models.Optional[models.Visibility]{Set: true, Null: true}},
+			wantErr: true,
+		},
+		{name: "rating off the scale", req: models.UpdateEntryRequest{Rating: models.Some(11.0)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scale := tt.scale
+			if scale == "" {
+				scale = models.RatingScaleTen
+			}
+			entry := base()
+			err := applyEntryUpdate(entry, &tt.req, scale, models.DefaultRatingTemplate(models.MediaTypeBook))
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := base()
+			tt.want(want)
+			if !reflect.DeepEqual(entry, want) {
+				t.Errorf("entry = %+v, want %+v", entry, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"media-tracker/internal/models"
+	"media-tracker/internal/repository"
+)
+
+// maxSmartEntries caps how many entries a smart collection lists.
+const maxSmartEntries = 500
+
+// errSmartCollection rejects changes to the entry list of a smart collection.
+var errSmartCollection = fmt.Errorf("%w: the entries of a smart collection come from its rules", ErrValidation)
+
+// canonicalRules validates the rules of a smart collection, given on the
+// owner's rating scale, and returns them with canonical rating bounds.
+func canonicalRules(rules *models.CollectionRules, scale models.RatingScale) (*models.CollectionRules, error) {
+	canonical := *rules
+
+	if rules.Status != nil && !rules.Status.Valid() {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrValidation, *rules.Status)
+	}
+	if rules.Type != nil && !rules.Type.Valid() {
+		return nil, fmt.Errorf("%w: unknown media type %q", ErrValidation, *rules.Type)
+	}
+	if rules.Visibility != nil && !rules.Visibility.Valid() {
+		return nil, fmt.Errorf("%w: unknown visibility %q", ErrValidation, *rules.Visibility)
+	}
+	if rules.Sort != "" && !entrySorts[rules.Sort] {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrValidation, rules.Sort)
+	}
+	if rules.Order != "" && rules.Order != "asc" && rules.Order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrValidation)
+	}
+	if rules.Limit < 0 || rules.Limit > maxSmartEntries {
+		return nil, fmt.Errorf("%w: limit must be between 0 and %d (0 for the default)", ErrValidation, maxSmartEntries)
+	}
+	for _, date := range []*string{rules.FinishedFrom, rules.FinishedTo} {
+		if date == nil {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *date); err != nil {
+			return nil, fmt.Errorf("%w: %q is not a date (YYYY-MM-DD)", ErrValidation, *date)
+		}
+	}
+
+	var err error
+	if canonical.Tags, err = normalizeTags(rules.Tags); err != nil {
+		return nil, err
+	}
+	if len(canonical.Tags) == 0 {
+		canonical.Tags = nil
+	}
+	canonical.Search = strings.TrimSpace(rules.Search)
+	if canonical.RatingMin, err = canonicalRatingBound(scale, rules.RatingMin, false); err != nil {
+		return nil, err
+	}
+	if canonical.RatingMax, err = canonicalRatingBound(scale, rules.RatingMax, true); err != nil {
+		return nil, err
+	}
+	return &canonical, nil
+}
+
+// displayRules returns rules with their rating bounds on the owner's scale.
+func displayRules(rules *models.CollectionRules, scale models.RatingScale) *models.CollectionRules {
+	display := *rules
+	if rules.RatingMin != nil {
+		ratingMin := scale.Display(*rules.RatingMin)
+		display.RatingMin = &ratingMin
+	}
+	if rules.RatingMax != nil {
+		ratingMax := scale.Display(*rules.RatingMax)
+		display.RatingMax = &ratingMax
+	}
+	return &display
+}
+
+// smartEntries returns the owner's entries matching the rules of a smart
+// collection, in the order the rules ask for. public keeps only the entries
+// anyone may see, for shares.
+func smartEntries(ctx context.Context, entryRepo *repository.EntryRepository, collection *models.Collection,
+	public bool) ([]models.Entry, error) {
+	rules := collection.Rules
+	query := &models.EntryListQuery{
+		Status:     rules.Status,
+		Type:       rules.Type,
+		RatingMin:  rules.RatingMin,
+		RatingMax:  rules.RatingMax,
+		Genre:      rules.Genre,
+		Tags:       rules.Tags,
+		Year:       rules.Year,
+		HasReview:  rules.HasReview,
+		Visibility: rules.Visibility,
+		Search:     rules.Search,
+		Sort:       rules.Sort,
+		Limit:      rules.Limit,
+	}
+	if query.Sort == "" {
+		query.Sort = models.EntrySortUpdated
+	}
+	query.Descending = query.Sort.DefaultDescending()
+	if rules.Order != "" {
+		query.Descending = rules.Order == "desc"
+	}
+	if query.Limit == 0 {
+		query.Limit = maxSmartEntries
+	}
+	// Dates were checked when the rules were saved.
+	if rules.FinishedFrom != nil {
+		from, _ := time.Parse("2006-01-02", *rules.FinishedFrom)
+		query.FinishedFrom = &from
+	}
+	if rules.FinishedTo != nil {
+		to, _ := time.Parse("2006-01-02", *rules.FinishedTo)
+		query.FinishedTo = &to
+	}
+
+	if public {
+		if rules.Visibility != nil && *rules.Visibility != models.VisibilityPublic {
+			return []models.Entry{}, nil
+		}
+		visibility := models.VisibilityPublic
+		query.Visibility = &visibility
+	}
+
+	entries, _, err := entryRepo.ListByUser(ctx, collection.UserID, query)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.Entry, len(entries))
+	for i, entry := range entries {
+		result[i] = *entry
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"media-tracker/internal/models"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestCanonicalRules(t *testing.T) {
+	completed := models.StatusCompleted
+	unknownStatus := models.Status("abandoned")
+	unknownType := models.MediaType("podcast")
+	notADate := "2025-13-01"
+
+	tests := []struct {
+		name    string
+		rules   models.CollectionRules
+		scale   models.RatingScale
+		want    models.CollectionRules
+		wantErr bool
+	}{
+		{name: "no rules", scale: models.RatingScaleTen},
+		{
+			name:  "without tags",
+			rules: models.CollectionRules{Status: &completed, Sort: models.EntrySortRating, Order: "desc", Limit: 10},
+			scale: models.RatingScaleTen,
+			want:  models.CollectionRules{Status: &completed, Sort: models.EntrySortRating, Order: "desc", Limit: 10},
+		},
+		{
+			name:  "blank tags are dropped",
+			rules: models.CollectionRules{Tags: []string{" ", ""}},
+			scale: models.RatingScaleTen,
+		},
+		{
+			name:  "tags and search are normalized",
+			rules: models.CollectionRules{Tags: []string{" Cozy ", "cozy", "RAINY"}, Search: "  ghibli "},
+			scale: models.RatingScaleTen,
+			want:  models.CollectionRules{Tags: []string{"cozy", "rainy"}, Search: "ghibli"},
+		},
+		{
+			name:  "rating bounds on the owner's scale",
+			rules: models.CollectionRules{RatingMin: floatPtr(4), RatingMax: floatPtr(4.5)},
+			scale: models.RatingScaleFiveStar,
+			want:  models.CollectionRules{RatingMin: floatPtr(8), RatingMax: floatPtr(9)},
+		},
+		{
+			name:  "like/dislike bounds",
+			rules: models.CollectionRules{RatingMin: floatPtr(1)},
+			scale: models.RatingScaleLikeDislike,
+			want:  models.CollectionRules{RatingMin: floatPtr(models.LikeThreshold)},
+		},
+		{
+			name:  "dates",
+			rules: models.CollectionRules{FinishedFrom: strPtr("2025-01-01"), FinishedTo: strPtr("2025-12-31")},
+			scale: models.RatingScaleTen,
+			want:  models.CollectionRules{FinishedFrom: strPtr("2025-01-01"), FinishedTo: strPtr("2025-12-31")},
+		},
+		{name: "unknown status", rules: models.CollectionRules{Status: &unknownStatus}, wantErr: true},
+		{name: "unknown type", rules: models.CollectionRules{Type: &unknownType}, wantErr: true},
+		{name: "unknown sort", rules: models.CollectionRules{Sort: "random"}, wantErr: true},
+		{name: "unknown order", rules: models.CollectionRules{Order: "up"}, wantErr: true},
+		{name: "negative limit", rules: models.CollectionRules{Limit: -1}, wantErr: true},
+		{name: "limit too high", rules: models.CollectionRules{Limit: maxSmartEntries + 1}, wantErr: true},
+		{name: "bad date", rules: models.CollectionRules{FinishedFrom: &notADate}, wantErr: true},
+		{name: "tag too long", rules: models.CollectionRules{Tags: []string{strings.Repeat("x", maxTagLength+1)}}, wantErr: true},
+		{
+			name:    "rating bound off the scale",
+			rules:   models.CollectionRules{RatingMax: floatPtr(6)},
+			scale:   models.RatingScaleFiveStar,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalRules(&tt.rules, tt.scale)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("canonicalRules = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
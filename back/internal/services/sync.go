@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"media-tracker/internal/models"
+	"media-tracker/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultChangesPageSize and maxChangesPageSize bound a page of the change
+	// feed; a sync returns one page of the largest size.
+	defaultChangesPageSize = 100
+	maxChangesPageSize     = 500
+)
+
+// SyncService runs the offline sync protocol: it applies changes clients made
+// offline, matching the media of new entries to existing media items, and
+// returns what changed on the server since the client's last sync.
+type SyncService struct {
+	entries    *EntryService
+	entryRepo  *repository.EntryRepository
+	mediaRepo  *repository.MediaRepository
+	transactor *repository.Transactor
+	events     *EventBus
+}
+
+func NewSyncService(entries *EntryService, entryRepo *repository.EntryRepository, mediaRepo *repository.MediaRepository,
+	transactor *repository.Transactor, events *EventBus) *SyncService {
+	return &SyncService{entries: entries, entryRepo: entryRepo, mediaRepo: mediaRepo, transactor: transactor, events: events}
+}
+
+// withTx returns a copy of the service whose reads and writes run in tx and
+// which publishes no events.
+func (s *SyncService) withTx(tx *sql.Tx) *SyncService {
+	return &SyncService{
+		entries:    s.entries.withTx(tx),
+		entryRepo:  s.entryRepo.WithTx(tx),
+		mediaRepo:  s.mediaRepo.WithTx(tx),
+		transactor: s.transactor,
+	}
+}
+
+// syncOutcome is what happened to one change; exactly one field is set.
+type syncOutcome struct {
+	applied   *models.SyncApplied
+	conflict  *models.SyncConflict
+	ambiguous *models.SyncAmbiguous
+}
+
+// Sync applies a client's offline changes and returns what changed on the
+// server since the client's cursor. Changes are applied in client_updated_at
+// order. A change is only applied if the entry is still at the version the
+// client based it on; otherwise it is reported as a conflict with the server's
+// entry and the client decides how to resolve it.
+func (s *SyncService) Sync(ctx context.Context, userID uuid.UUID, req *models.SyncRequest) (*models.SyncResponse, error) {
+	// Check the cursor before applying anything.
+	if _, err := parseSyncCursor(req.Cursor); err != nil {
+		return nil, err
+	}
+
+	resp := &models.SyncResponse{
+		Applied:   []models.SyncApplied{},
+		Conflicts: []models.SyncConflict{},
+		Ambiguous: []models.SyncAmbiguous{},
+		Errors:    []models.SyncItemError{},
+	}
+
+	changes := make([]models.SyncChange, len(req.Changes))
+	copy(changes, req.Changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return clientTime(changes[i]).Before(clientTime(changes[j]))
+	})
+
+	// The batch runs in one transaction so a retried or interrupted sync never
+	// leaves half of a change behind; each change gets its own savepoint so an
+	// invalid change is undone without losing the others.
+	var events []pendingEvent
+	err := s.transactor.WithinTx(ctx, func(tx *sql.Tx) error {
+		txService := s.withTx(tx)
+		for i := range changes {
+			change := &changes[i]
+			var outcome syncOutcome
+			err := repository.Savepoint(ctx, tx, "sync_item", func() error {
+				var err error
+				outcome, err = txService.applyChange(ctx, userID, change)
+				return err
+			})
+			switch {
+			case err != nil:
+				if errors.Is(err, sql.ErrNoRows) {
+					err = ErrNotFound
+				}
+				if !errors.Is(err, ErrValidation) && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				resp.Errors = append(resp.Errors, models.SyncItemError{ClientID: change.ClientID, Error: err.Error()})
+			case outcome.conflict != nil:
+				resp.Conflicts = append(resp.Conflicts, *outcome.conflict)
+			case outcome.ambiguous != nil:
+				resp.Ambiguous = append(resp.Ambiguous, *outcome.ambiguous)
+			default:
+				resp.Applied = append(resp.Applied, *outcome.applied)
+				events = append(events, syncEvent(change, outcome.applied))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.events.publishAll(ctx, userID, events)
+
+	serverChanges, err := s.Changes(ctx, userID, req.Cursor, maxChangesPageSize)
+	if err != nil {
+		return nil, err
+	}
+	resp.EntryChanges = *serverChanges
+
+	return resp, nil
+}
+
+// syncEvent is the change event of an applied change.
+func syncEvent(change *models.SyncChange, applied *models.SyncApplied) pendingEvent {
+	switch {
+	case applied.Entry == nil:
+		return pendingEvent{eventType: models.ChangeEntryDeleted, id: applied.EntryID}
+	case change.EntryID == nil:
+		return pendingEvent{eventType: models.ChangeEntryCreated, id: applied.EntryID, data: applied.Entry}
+	default:
+		return pendingEvent{eventType: models.ChangeEntryUpdated, id: applied.EntryID, data: applied.Entry}
+	}
+}
+
+// Changes returns a page of the user's entry change feed after cursor ("" for
+// the start): every entry created or updated since, and a tombstone for every
+// entry deleted since, oldest change first. An entry that changed several
+// times appears once, in its current state.
+func (s *SyncService) Changes(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*models.EntryChanges, error) {
+	since, err := parseSyncCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case limit <= 0:
+		limit = defaultChangesPageSize
+	case limit > maxChangesPageSize:
+		limit = maxChangesPageSize
+	}
+
+	entries, err := s.entryRepo.ListChanges(ctx, userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		renderReview(entry)
+	}
+	tombstones, err := s.entryRepo.ListTombstones(ctx, userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := mergeEntryChanges(entries, tombstones)
+	page := &models.EntryChanges{Changes: changes, Cursor: strconv.FormatInt(since, 10)}
+	if len(changes) > limit {
+		page.Changes = changes[:limit]
+		page.HasMore = true
+	}
+	if n := len(page.Changes); n > 0 {
+		page.Cursor = strconv.FormatInt(page.Changes[n-1].ChangeSeq, 10)
+	}
+	return page, nil
+}
+
+// mergeEntryChanges merges changed entries and tombstones, each already in
+// change_seq order, into one list in change_seq order. Trashed entries become
+// tombstones.
+func mergeEntryChanges(entries []*models.Entry, tombstones []models.EntryChange) []models.EntryChange {
+	changes := make([]models.EntryChange, 0, len(entries)+len(tombstones))
+	i, j := 0, 0
+	for i < len(entries) || j < len(tombstones) {
+		if j == len(tombstones) || (i < len(entries) && entries[i].ChangeSeq <= tombstones[j].ChangeSeq) {
+			entry := entries[i]
+			change := models.EntryChange{EntryID: entry.ID, ChangeSeq: entry.ChangeSeq}
+			if entry.DeletedAt != nil {
+				change.Deleted = true
+				change.DeletedAt = entry.DeletedAt
+			} else {
+				change.Entry = entry
+			}
+			changes = append(changes, change)
+			i++
+		} else {
+			changes = append(changes, tombstones[j])
+			j++
+		}
+	}
+	return changes
+}
+
+// applyChange applies one change, or reports why it was not applied.
+func (s *SyncService) applyChange(ctx context.Context, userID uuid.UUID, change *models.SyncChange) (syncOutcome, error) {
+	op := change.Op
+	if op == "" {
+		op = models.SyncOpUpsert
+	}
+	if op != models.SyncOpUpsert && op != models.SyncOpDelete {
+		return syncOutcome{}, fmt.Errorf("%w: unknown op %q", ErrValidation, change.Op)
+	}
+
+	if change.EntryID == nil {
+		if op == models.SyncOpDelete {
+			return syncOutcome{}, fmt.Errorf("%w: a delete needs an entry_id", ErrValidation)
+		}
+		return s.createEntry(ctx, userID, change)
+	}
+
+	if change.BaseVersion == nil {
+		return syncOutcome{}, fmt.Errorf("%w: a change to an existing entry needs a base_version", ErrValidation)
+	}
+
+	entry, err := s.entries.getOwnedEntry(ctx, userID, *change.EntryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		trashed, trashErr := s.entryRepo.GetTrashed(ctx, *change.EntryID)
+		if trashErr != nil || trashed.UserID != userID {
+			return syncOutcome{}, ErrNotFound
+		}
+		if op == models.SyncOpDelete {
+			return syncOutcome{applied: &models.SyncApplied{ClientID: change.ClientID, EntryID: trashed.ID}}, nil
+		}
+		return syncOutcome{conflict: syncConflict(change, models.SyncConflictDeleted, trashed)}, nil
+	}
+	if err != nil {
+		return syncOutcome{}, err
+	}
+	if entry.Version != *change.BaseVersion {
+		return syncOutcome{conflict: syncConflict(change, models.SyncConflictVersion, entry)}, nil
+	}
+
+	if op == models.SyncOpDelete {
+		err = s.entries.Delete(ctx, userID, entry.ID, change.BaseVersion)
+	} else {
+		entry, err = s.entries.Update(ctx, userID, entry.ID, &change.UpdateEntryRequest, change.BaseVersion)
+	}
+	if errors.Is(err, ErrStale) {
+		// Lost a race with another write after the version check above.
+		current, getErr := s.entryRepo.GetByID(ctx, *change.EntryID)
+		if getErr != nil {
+			return syncOutcome{}, getErr
+		}
+		return syncOutcome{conflict: syncConflict(change, models.SyncConflictVersion, current)}, nil
+	}
+	if err != nil {
+		return syncOutcome{}, err
+	}
+
+	applied := &models.SyncApplied{ClientID: change.ClientID, EntryID: *change.EntryID}
+	if op == models.SyncOpUpsert {
+		applied.Entry = entry
+	}
+	return syncOutcome{applied: applied}, nil
+}
+
+// createEntry creates the entry for a change the client made to an entry it
+// created offline. If the user already tracks the media, the two are in conflict.
+func (s *SyncService) createEntry(ctx context.Context, userID uuid.UUID, change *models.SyncChange) (syncOutcome, error) {
+	if !change.Status.Set || change.Status.Null {
+		return syncOutcome{}, fmt.Errorf("%w: a new entry needs a status", ErrValidation)
+	}
+
+	match, err := s.resolveMedia(ctx, change)
+	if err != nil {
+		return syncOutcome{}, err
+	}
+	if match.ambiguous != nil {
+		return syncOutcome{ambiguous: &models.SyncAmbiguous{ClientID: change.ClientID, Candidates: match.ambiguous}}, nil
+	}
+
+	existing, err := s.entryRepo.ListByUserAndMedia(ctx, userID, match.media.ID)
+	if err != nil {
+		return syncOutcome{}, err
+	}
+	if len(existing) > 0 {
+		return syncOutcome{conflict: syncConflict(change, models.SyncConflictExists, existing[0])}, nil
+	}
+
+	entry, err := s.entries.Create(ctx, userID, &models.CreateEntryRequest{
+		MediaID:      match.media.ID,
+		Status:       change.Status.Value,
+		Rating:       change.Rating.Ptr(),
+		ReviewMD:     change.ReviewMD.Ptr(),
+		PrivateNotes: change.PrivateNotes.Ptr(),
+		Visibility:   change.Visibility.Value,
+		Progress:     change.Progress.Value,
+		StartedAt:    change.StartedAt.Ptr(),
+		FinishedAt:   change.FinishedAt.Ptr(),
+	})
+	if err != nil {
+		return syncOutcome{}, err
+	}
+
+	applied := &models.SyncApplied{ClientID: change.ClientID, EntryID: entry.ID, Entry: entry}
+	if match.kind != "" {
+		applied.Match = &models.MediaMatchInfo{MediaID: match.media.ID, MatchedBy: match.kind, Confidence: match.confidence}
+	}
+	return syncOutcome{applied: applied}, nil
+}
+
+// resolveMedia finds the media item a new entry is for. A media_id is used as
+// is. Media described by the client is matched, in order, by external ID, by
+// normalized title, year and type, and by fuzzy title similarity; if nothing
+// matches a new media item is created. External IDs the client sent are
+// recorded on the matched item so the next sync matches it exactly.
+func (s *SyncService) resolveMedia(ctx context.Context, change *models.SyncChange) (mediaMatch, error) {
+	if change.MediaID != nil {
+		media, err := s.mediaRepo.GetByID(ctx, *change.MediaID)
+		if err != nil {
+			return mediaMatch{}, err
+		}
+		return mediaMatch{media: media}, nil
+	}
+	if change.Media == nil || change.Media.Title == "" || change.Media.Type == "" {
+		return mediaMatch{}, fmt.Errorf("%w: a new entry needs a media_id or media with a title and type", ErrValidation)
+	}
+
+	req := *change.Media
+	externalIDs, err := normalizeExternalIDs(req.ExternalIDs)
+	if err != nil {
+		return mediaMatch{}, err
+	}
+	req.ExternalIDs = externalIDs
+
+	match, err := s.matchByExternalID(ctx, &req)
+	if err != nil {
+		return mediaMatch{}, err
+	}
+	if match.media == nil && match.ambiguous == nil {
+		candidates, err := s.mediaRepo.MatchCandidates(ctx, req.Type, req.Title, maxMatchCandidates)
+		if err != nil {
+			return mediaMatch{}, err
+		}
+		match = matchMediaByTitle(&req, candidates)
+	}
+
+	switch {
+	case match.ambiguous != nil:
+		return match, nil
+	case match.media != nil:
+		if len(req.ExternalIDs) > 0 && match.kind != models.MediaMatchExternalID {
+			if err := s.mediaRepo.AddExternalIDs(ctx, match.media.ID, req.ExternalIDs); err != nil {
+				return mediaMatch{}, err
+			}
+		}
+		return match, nil
+	}
+
+	media := newMediaItem(&req)
+	if err := s.mediaRepo.Create(ctx, media); err != nil {
+		return mediaMatch{}, err
+	}
+	return mediaMatch{media: media, kind: models.MediaMatchCreated, confidence: 1}, nil
+}
+
+// matchByExternalID looks the request's external IDs up. IDs of another media
+// type are ignored; IDs that point at different items make the match ambiguous.
+func (s *SyncService) matchByExternalID(ctx context.Context, req *models.CreateMediaRequest) (mediaMatch, error) {
+	sources := make([]string, 0, len(req.ExternalIDs))
+	for source := range req.ExternalIDs {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var found []*models.MediaItem
+	seen := make(map[uuid.UUID]bool)
+	for _, source := range sources {
+		media, err := s.mediaRepo.GetByExternalID(ctx, source, req.ExternalIDs[source])
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return mediaMatch{}, err
+		}
+		if media.Type == req.Type && !seen[media.ID] {
+			seen[media.ID] = true
+			found = append(found, media)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return mediaMatch{}, nil
+	case 1:
+		return mediaMatch{media: found[0], kind: models.MediaMatchExternalID, confidence: 1}, nil
+	}
+	ambiguous := make([]models.MediaCandidate, len(found))
+	for i, media := range found {
+		ambiguous[i] = models.MediaCandidate{Media: media, MatchedBy: models.MediaMatchExternalID, Confidence: 1}
+	}
+	return mediaMatch{ambiguous: ambiguous}, nil
+}
+
+// newMediaItem builds a new media item from a create request.
+func newMediaItem(req *models.CreateMediaRequest) *models.MediaItem {
+	return &models.MediaItem{
+		ID:            uuid.New(),
+		Type:          req.Type,
+		Title:         req.Title,
+		OriginalTitle: req.OriginalTitle,
+		Year:          req.Year,
+		CoverURL:      req.CoverURL,
+		Creators:      req.Creators,
+		Genres:        req.Genres,
+		Duration:      req.Duration,
+		Metadata:      req.Metadata,
+		ExternalIDs:   req.ExternalIDs,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// clientTime orders changes; changes without a client timestamp go first.
+func clientTime(change models.SyncChange) time.Time {
+	if change.ClientUpdatedAt == nil {
+		return time.Time{}
+	}
+	return *change.ClientUpdatedAt
+}
+
+func syncConflict(change *models.SyncChange, reason models.SyncConflictReason, server *models.Entry) *models.SyncConflict {
+	renderReview(server)
+	return &models.SyncConflict{ClientID: change.ClientID, Reason: reason, Client: *change, Server: server}
+}
+
+// parseSyncCursor reads a cursor returned by a previous sync; "" starts from the beginning.
+func parseSyncCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	since, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || since < 0 {
+		return 0, fmt.Errorf("%w: invalid cursor", ErrValidation)
+	}
+	return since, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMergeEntryChanges(t *testing.T) {
+	trashedAt := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	purgedAt := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	live := &models.Entry{ID: uuid.New(), ChangeSeq: 1}
+	trashed := &models.Entry{ID: uuid.New(), ChangeSeq: 4, DeletedAt: &trashedAt}
+	tied := &models.Entry{ID: uuid.New(), ChangeSeq: 7}
+	purged := models.EntryChange{EntryID: uuid.New(), Deleted: true, DeletedAt: &purgedAt, ChangeSeq: 2}
+	later := models.EntryChange{EntryID: uuid.New(), Deleted: true, DeletedAt: &purgedAt, ChangeSeq: 5}
+	sameSeq := models.EntryChange{EntryID: uuid.New(), Deleted: true, DeletedAt: &purgedAt, ChangeSeq: 7}
+
+	tests := []struct {
+		name       string
+		entries    []*models.Entry
+		tombstones []models.EntryChange
+		want       []models.EntryChange
+	}{
+		{name: "nothing changed", want: []models.EntryChange{}},
+		{
+			name:    "entries only",
+			entries: []*models.Entry{live},
+			want:    []models.EntryChange{{EntryID: live.ID, Entry: live, ChangeSeq: 1}},
+		},
+		{
+			name:       "tombstones only",
+			tombstones: []models.EntryChange{purged, later},
+			want:       []models.EntryChange{purged, later},
+		},
+		{
+			name:       "interleaved in change_seq order, trashed entries as tombstones",
+			entries:    []*models.Entry{live, trashed},
+			tombstones: []models.EntryChange{purged, later},
+			want: []models.EntryChange{
+				{EntryID: live.ID, Entry: live, ChangeSeq: 1},
+				purged,
+				{EntryID: trashed.ID, Deleted: true, DeletedAt: &trashedAt, ChangeSeq: 4},
+				later,
+			},
+		},
+		{
+			name:       "entry before tombstone on the same change_seq",
+			entries:    []*models.Entry{tied},
+			tombstones: []models.EntryChange{sameSeq},
+			want: []models.EntryChange{
+				{EntryID: tied.ID, Entry: tied, ChangeSeq: 7},
+				sameSeq,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeEntryChanges(tt.entries, tt.tombstones)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeEntryChanges = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"media-tracker/internal/models"
+)
+
+// allowedTransitions is the entry status state machine. Staying in the same
+// status is always allowed; completed entries can only be started again
+// (a rewatch or reread) or moved back to planned.
+var allowedTransitions = map[models.Status][]models.Status{
+	models.StatusPlanned:    {models.StatusInProgress, models.StatusCompleted, models.StatusDropped},
+	models.StatusInProgress: {models.StatusPlanned, models.StatusCompleted, models.StatusOnHold, models.StatusDropped},
+	models.StatusOnHold:     {models.StatusPlanned, models.StatusInProgress, models.StatusCompleted, models.StatusDropped},
+	models.StatusDropped:    {models.StatusPlanned, models.StatusInProgress},
+	models.StatusCompleted:  {models.StatusPlanned, models.StatusInProgress},
+}
+
+func canTransition(from, to models.Status) bool {
+	if from == to {
+		return true
+	}
+	for _, allowed := range allowedTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTransition(from, to models.Status) error {
+	if !canTransition(from, to) {
+		return fmt.Errorf("%w: cannot change status from %s to %s", ErrValidation, from, to)
+	}
+	return nil
+}
+
+// applyTransitionRules applies the user's automatic rules to an entry whose
+// status or progress may have changed; before is the stored entry, or nil for a
+// new one. Progress reaching its total completes the entry, moving to
+// in_progress sets started_at, and completing sets finished_at and fills progress.
+func applyTransitionRules(entry *models.Entry, before *models.Entry, settings *models.UserSettings, now time.Time) {
+	today := truncateToDate(now)
+
+	var from *models.Status
+	wasFinished := false
+	if before != nil {
+		from = &before.Status
+		wasFinished = before.Completion != nil && *before.Completion >= 100
+	}
+
+	entry.Completion = progressCompletion(entry.Media, entry.Progress)
+	reachedTotal := entry.Completion != nil && *entry.Completion >= 100 && !wasFinished
+	if settings.AutoCompleteOnProgress && reachedTotal && entry.Status != models.StatusCompleted &&
+		(from == nil || canTransition(*from, models.StatusCompleted)) {
+		entry.Status = models.StatusCompleted
+	}
+
+	statusChanged := from == nil || *from != entry.Status
+	if !statusChanged {
+		return
+	}
+
+	switch entry.Status {
+	case models.StatusInProgress:
+		if settings.AutoStartDate && entry.StartedAt == nil {
+			entry.StartedAt = &today
+		}
+	case models.StatusCompleted:
+		if settings.AutoFinishDate && entry.FinishedAt == nil {
+			finished := today
+			if entry.StartedAt != nil && entry.StartedAt.After(finished) {
+				finished = *entry.StartedAt
+			}
+			entry.FinishedAt = &finished
+		}
+		if settings.AutoFillProgress {
+			entry.Progress = fillProgress(entry.Media, entry.Progress)
+			entry.Completion = progressCompletion(entry.Media, entry.Progress)
+		}
+	}
+}
+
+// fillProgress returns progress with its counters set to their totals, where the
+// total is known from the progress itself or from the media item.
+func fillProgress(media *models.MediaItem, progress models.JSONB) models.JSONB {
+	filled := progress.MergePatch(nil)
+
+	fill := func(key string, total *float64) {
+		if total != nil {
+			filled[key] = *total
+		}
+	}
+
+	switch media.Type {
+	case models.MediaTypeBook:
+		fill("pages", firstNonNil(progressNumber(progress, "total_pages"), metadataNumber(media, "pages")))
+		fill("chapters", progressNumber(progress, "total_chapters"))
+	case models.MediaTypeTV, models.MediaTypeAnime:
+		fill("episodes", firstNonNil(progressNumber(progress, "total_episodes"), metadataNumber(media, "episodes")))
+		fill("season", progressNumber(progress, "total_seasons"))
+	case models.MediaTypeGame:
+		hundred := 100.0
+		fill("percent", &hundred)
+		fill("achievements", progressNumber(progress, "total_achievements"))
+	case models.MediaTypeVideo, models.MediaTypeMovie:
+		fill("minutes", firstNonNil(progressNumber(progress, "total_minutes"), intPtrToFloat(media.Duration)))
+	}
+
+	if len(filled) == 0 {
+		return nil
+	}
+	return filled
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"media-tracker/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to models.Status
+		want     bool
+	}{
+		{models.StatusPlanned, models.StatusPlanned, true},
+		{models.StatusPlanned, models.StatusInProgress, true},
+		{models.StatusPlanned, models.StatusCompleted, true},
+		{models.StatusPlanned, models.StatusOnHold, false},
+		{models.StatusInProgress, models.StatusOnHold, true},
+		{models.StatusOnHold, models.StatusCompleted, true},
+		{models.StatusDropped, models.StatusInProgress, true},
+		{models.StatusDropped, models.StatusCompleted, false},
+		{models.StatusDropped, models.StatusOnHold, false},
+		{models.StatusCompleted, models.StatusInProgress, true},
+		{models.StatusCompleted, models.StatusPlanned, true},
+		{models.StatusCompleted, models.StatusDropped, false},
+		{models.StatusCompleted, models.StatusOnHold, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			if got := canTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("canTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTransitionRules(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 30, 0, 0, time.UTC)
+	today := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	started := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tomorrow := time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)
+	finished := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+	book := &models.MediaItem{Type: models.MediaTypeBook}
+
+	defaults := models.DefaultUserSettings(uuid.Nil)
+	manual := &models.UserSettings{}
+
+	tests := []struct {
+		name     string
+		entry    models.Entry
+		before   *models.Entry
+		settings *models.UserSettings
+		want     models.Entry
+	}{
+		{
+			name:     "new entry in progress gets a start date",
+			entry:    models.Entry{Status: models.StatusInProgress, Media: book},
+			settings: defaults,
+			want:     models.Entry{Status: models.StatusInProgress, Media: book, StartedAt: &today},
+		},
+		{
+			name:     "start date left alone when the rule is off",
+			entry:    models.Entry{Status: models.StatusInProgress, Media: book},
+			settings: manual,
+			want:     models.Entry{Status: models.StatusInProgress, Media: book},
+		},
+		{
+			name:     "a start date sent with the entry is kept",
+			entry:    models.Entry{Status: models.StatusInProgress, Media: book, StartedAt: &started},
+			settings: defaults,
+			want:     models.Entry{Status: models.StatusInProgress, Media: book, StartedAt: &started},
+		},
+		{
+			name: "completing fills the finish date and progress",
+			entry: models.Entry{Status: models.StatusCompleted, Media: book, StartedAt: &started,
+				Progress: models.JSONB{"pages": 100.0, "total_pages": 300.0}},
+			before:   &models.Entry{Status: models.StatusInProgress},
+			settings: defaults,
+			want: models.Entry{Status: models.StatusCompleted, Media: book, StartedAt: &started, FinishedAt: &today,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}, Completion: floatPtr(100)},
+		},
+		{
+			name:     "finish date is never before the start date",
+			entry:    models.Entry{Status: models.StatusCompleted, Media: book, StartedAt: &tomorrow},
+			before:   &models.Entry{Status: models.StatusInProgress},
+			settings: defaults,
+			want:     models.Entry{Status: models.StatusCompleted, Media: book, StartedAt: &tomorrow, FinishedAt: &tomorrow},
+		},
+		{
+			name:     "a finish date sent with the entry is kept",
+			entry:    models.Entry{Status: models.StatusCompleted, Media: book, FinishedAt: &finished},
+			before:   &models.Entry{Status: models.StatusPlanned},
+			settings: defaults,
+			want:     models.Entry{Status: models.StatusCompleted, Media: book, FinishedAt: &finished},
+		},
+		{
+			name: "progress reaching its total completes the entry",
+			entry: models.Entry{Status: models.StatusInProgress, Media: book, StartedAt: &started,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}},
+			before:   &models.Entry{Status: models.StatusInProgress, Completion: floatPtr(33.33)},
+			settings: defaults,
+			want: models.Entry{Status: models.StatusCompleted, Media: book, StartedAt: &started, FinishedAt: &today,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}, Completion: floatPtr(100)},
+		},
+		{
+			name: "progress reaching its total with the rule off",
+			entry: models.Entry{Status: models.StatusInProgress, Media: book,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}},
+			before:   &models.Entry{Status: models.StatusInProgress, Completion: floatPtr(33.33)},
+			settings: manual,
+			want: models.Entry{Status: models.StatusInProgress, Media: book,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}, Completion: floatPtr(100)},
+		},
+		{
+			name: "progress already at its total does not complete a restart",
+			entry: models.Entry{Status: models.StatusInProgress, Media: book, StartedAt: &started,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}},
+			before:   &models.Entry{Status: models.StatusCompleted, Completion: floatPtr(100)},
+			settings: defaults,
+			want: models.Entry{Status: models.StatusInProgress, Media: book, StartedAt: &started,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}, Completion: floatPtr(100)},
+		},
+		{
+			name: "a dropped entry is not completed by its progress",
+			entry: models.Entry{Status: models.StatusDropped, Media: book,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}},
+			before:   &models.Entry{Status: models.StatusDropped, Completion: floatPtr(50)},
+			settings: defaults,
+			want: models.Entry{Status: models.StatusDropped, Media: book,
+				Progress: models.JSONB{"pages": 300.0, "total_pages": 300.0}, Completion: floatPtr(100)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			applyTransitionRules(&entry, tt.before, tt.settings, now)
+			if !reflect.DeepEqual(entry, tt.want) {
+				t.Errorf("entry = %+v, want %+v", entry, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		media    *models.MediaItem
+		progress models.JSONB
+		want     models.JSONB
+	}{
+		{
+			name:     "book from its own totals",
+			media:    &models.MediaItem{Type: models.MediaTypeBook},
+			progress: models.JSONB{"pages": 10.0, "total_pages": 300.0, "total_chapters": 20.0},
+			want:     models.JSONB{"pages": 300.0, "total_pages": 300.0, "chapters": 20.0, "total_chapters": 20.0},
+		},
+		{
+			name:  "book from the media's page count",
+			media: &models.MediaItem{Type: models.MediaTypeBook, Metadata: models.JSONB{"pages": 412.0}},
+			want:  models.JSONB{"pages": 412.0},
+		},
+		{
+			name:     "episodes and seasons",
+			media:    &models.MediaItem{Type: models.MediaTypeAnime, Metadata: models.JSONB{"episodes": 24.0}},
+			progress: models.JSONB{"episodes": 3.0, "total_seasons": 2.0},
+			want:     models.JSONB{"episodes": 24.0, "season": 2.0, "total_seasons": 2.0},
+		},
+		{
+			name:     "game",
+			media:    &models.MediaItem{Type: models.MediaTypeGame},
+			progress: models.JSONB{"hours": 30.0, "total_achievements": 50.0},
+			want:     models.JSONB{"hours": 30.0, "percent": 100.0, "achievements": 50.0, "total_achievements": 50.0},
+		},
+		{
+			name:  "movie from its duration",
+			media: &models.MediaItem{Type: models.MediaTypeMovie, Duration: intPtr(142)},
+			want:  models.JSONB{"minutes": 142.0},
+		},
+		{
+			name:  "unknown totals",
+			media: &models.MediaItem{Type: models.MediaTypeVideo},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fillProgress(tt.media, tt.progress)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fillProgress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
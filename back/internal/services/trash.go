@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"media-tracker/internal/models"
+	"media-tracker/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// TrashService lists, restores and purges deleted entries and collections.
+// Deleted items can be restored until they are older than the retention window.
+type TrashService struct {
+	entryRepo      *repository.EntryRepository
+	collectionRepo *repository.CollectionRepository
+	retention      time.Duration
+	events         *EventBus
+}
+
+func NewTrashService(entryRepo *repository.EntryRepository, collectionRepo *repository.CollectionRepository, retentionDays int,
+	events *EventBus) *TrashService {
+	return &TrashService{
+		entryRepo:      entryRepo,
+		collectionRepo: collectionRepo,
+		retention:      time.Duration(retentionDays) * 24 * time.Hour,
+		events:         events,
+	}
+}
+
+// List returns the user's restorable entries and collections.
+func (s *TrashService) List(ctx context.Context, userID uuid.UUID) (*models.Trash, error) {
+	cutoff := time.Now().Add(-s.retention)
+	trash := &models.Trash{
+		Entries:       []*models.Entry{},
+		Collections:   []*models.Collection{},
+		RetentionDays: int(s.retention / (24 * time.Hour)),
+	}
+
+	entries, err := s.entryRepo.ListTrash(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.DeletedAt.After(cutoff) {
+			renderReview(entry)
+			trash.Entries = append(trash.Entries, entry)
+		}
+	}
+
+	collections, err := s.collectionRepo.ListTrash(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, collection := range collections {
+		if collection.DeletedAt.After(cutoff) {
+			renderDescription(collection)
+			trash.Collections = append(trash.Collections, collection)
+		}
+	}
+
+	return trash, nil
+}
+
+// RestoreEntry takes one of the user's entries out of the trash.
+func (s *TrashService) RestoreEntry(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Entry, error) {
+	entry, err := s.entryRepo.GetTrashed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.UserID != userID || s.expired(*entry.DeletedAt) {
+		return nil, ErrNotFound
+	}
+
+	// The media may have been added again while this entry was in the trash.
+	live, err := s.entryRepo.ListByUserAndMedia(ctx, userID, entry.MediaID)
+	if err != nil {
+		return nil, err
+	}
+	if len(live) > 0 {
+		return nil, fmt.Errorf("%w: there is already an entry for %q", ErrValidation, entry.Media.Title)
+	}
+
+	if err := s.entryRepo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	restored, err := s.entryRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	renderReview(restored)
+
+	s.events.Publish(ctx, userID, models.ChangeEntryCreated, id, restored)
+	return restored, nil
+}
+
+// RestoreCollection takes one of the user's collections out of the trash.
+func (s *TrashService) RestoreCollection(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Collection, error) {
+	collection, err := s.collectionRepo.GetTrashed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.UserID != userID || s.expired(*collection.DeletedAt) {
+		return nil, ErrNotFound
+	}
+
+	if err := s.collectionRepo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	restored, err := s.collectionRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	renderDescription(restored)
+
+	s.events.Publish(ctx, userID, models.ChangeCollectionCreated, id, restored)
+	return restored, nil
+}
+
+// Purge permanently deletes everything that has been in the trash for longer
+// than the retention window.
+func (s *TrashService) Purge(ctx context.Context) (entries int64, collections int64, err error) {
+	cutoff := time.Now().Add(-s.retention)
+
+	if collections, err = s.collectionRepo.Purge(ctx, cutoff); err != nil {
+		return 0, 0, err
+	}
+	if entries, err = s.entryRepo.Purge(ctx, cutoff); err != nil {
+		return 0, collections, err
+	}
+	return entries, collections, nil
+}
+
+func (s *TrashService) expired(deletedAt time.Time) bool {
+	return deletedAt.Before(time.Now().Add(-s.retention))
+}
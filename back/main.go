@@ -61,28 +61,35 @@ func main() {
 	entryRepo := repository.NewEntryRepository(db)
 	collectionRepo := repository.NewCollectionRepository(db)
 	shareRepo := repository.NewShareRepository(db)
+	transactor := repository.NewTransactor(db)
 
 	// Initialize services
 	authService := services.NewAuthService(userRepo, redisClient, cfg.JWT)
 	mediaService := services.NewMediaService(mediaRepo)
-	entryService := services.NewEntryService(entryRepo, mediaRepo)
-	collectionService := services.NewCollectionService(collectionRepo, entryRepo)
-	shareService := services.NewShareService(shareRepo, collectionRepo, entryRepo)
-	guestService := services.NewGuestService(entryRepo, mediaRepo, shareRepo)
+	eventBus := services.NewEventBus(redisClient, &logger)
+	entryService := services.NewEntryService(entryRepo, mediaRepo, userRepo, collectionRepo, transactor, eventBus)
+	collectionService := services.NewCollectionService(entryService, collectionRepo, entryRepo, userRepo, transactor, eventBus)
+	shareService := services.NewShareService(shareRepo, collectionRepo, entryRepo, eventBus)
+	guestService := services.NewGuestService(entryRepo, mediaRepo, shareRepo, eventBus)
+	syncService := services.NewSyncService(entryService, entryRepo, mediaRepo, transactor, eventBus)
+	trashService := services.NewTrashService(entryRepo, collectionRepo, cfg.Trash.RetentionDays, eventBus)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
 	mediaHandler := handlers.NewMediaHandler(mediaService)
-	entryHandler := handlers.NewEntryHandler(entryService, mediaService)
+	entryHandler := handlers.NewEntryHandler(entryService, syncService)
 	collectionHandler := handlers.NewCollectionHandler(collectionService, shareService)
 	shareHandler := handlers.NewShareHandler(shareService)
 	guestHandler := handlers.NewGuestHandler(guestService)
+	trashHandler := handlers.NewTrashHandler(trashService)
+	eventHandler := handlers.NewEventHandler(eventBus)
 
 	// Setup router
 	router := gin.New()
 	router.Use(gin.Recovery())
 	router.Use(middleware.Logger(&logger))
 	router.Use(middleware.CORS())
+	router.Use(middleware.Idempotency(redisClient, time.Duration(cfg.Idempotency.TTL)*time.Hour))
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -98,6 +105,8 @@ func main() {
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/logout", authHandler.Logout)
 			auth.GET("/me", middleware.Auth(cfg.JWT), authHandler.GetProfile)
+			auth.GET("/me/settings", middleware.Auth(cfg.JWT), authHandler.GetSettings)
+			auth.PATCH("/me/settings", middleware.Auth(cfg.JWT), authHandler.UpdateSettings)
 		}
 
 		// Media routes
@@ -117,8 +126,33 @@ func main() {
 			entries.PATCH("/:id", middleware.Auth(cfg.JWT), entryHandler.Update)
 			entries.DELETE("/:id", middleware.Auth(cfg.JWT), entryHandler.Delete)
 			entries.POST("/sync", middleware.Auth(cfg.JWT), entryHandler.Sync)
+			entries.GET("/changes", middleware.Auth(cfg.JWT), entryHandler.Changes)
+			entries.POST("/bulk", middleware.Auth(cfg.JWT), entryHandler.Bulk)
+			entries.GET("/:id/cycles", middleware.Auth(cfg.JWT), entryHandler.ListCycles)
+			entries.POST("/:id/cycles", middleware.Auth(cfg.JWT), entryHandler.CreateCycle)
+			entries.PATCH("/:id/cycles/:cycleId", middleware.Auth(cfg.JWT), entryHandler.UpdateCycle)
+			entries.DELETE("/:id/cycles/:cycleId", middleware.Auth(cfg.JWT), entryHandler.DeleteCycle)
+			entries.POST("/:id/sessions", middleware.Auth(cfg.JWT), entryHandler.LogSession)
+			entries.POST("/:id/restore", middleware.Auth(cfg.JWT), trashHandler.RestoreEntry)
 		}
 
+		// Diary routes
+		api.GET("/diary", middleware.Auth(cfg.JWT), entryHandler.Diary)
+
+		// Stats routes
+		api.GET("/stats", middleware.Auth(cfg.JWT), entryHandler.Stats)
+
+		// Rating template routes
+		api.GET("/rating-templates", middleware.Auth(cfg.JWT), entryHandler.ListRatingTemplates)
+		api.PUT("/rating-templates/:type", middleware.Auth(cfg.JWT), entryHandler.PutRatingTemplate)
+		api.DELETE("/rating-templates/:type", middleware.Auth(cfg.JWT), entryHandler.ResetRatingTemplate)
+
+		// Trash routes
+		api.GET("/trash", middleware.Auth(cfg.JWT), trashHandler.List)
+
+		// Live update routes
+		api.GET("/events", middleware.Auth(cfg.JWT), eventHandler.Stream)
+
 		// Collection routes
 		collections := api.Group("/collections")
 		{
@@ -127,7 +161,17 @@ func main() {
 			collections.GET("/:id", middleware.Auth(cfg.JWT), collectionHandler.Get)
 			collections.PATCH("/:id", middleware.Auth(cfg.JWT), collectionHandler.Update)
 			collections.DELETE("/:id", middleware.Auth(cfg.JWT), collectionHandler.Delete)
+			collections.POST("/:id/entries/:entryId", middleware.Auth(cfg.JWT), collectionHandler.AddEntry)
+			collections.DELETE("/:id/entries/:entryId", middleware.Auth(cfg.JWT), collectionHandler.RemoveEntry)
+			collections.PATCH("/:id/entries/:entryId", middleware.Auth(cfg.JWT), collectionHandler.SetEntryNote)
+			collections.POST("/:id/reorder", middleware.Auth(cfg.JWT), collectionHandler.ReorderEntries)
+			collections.POST("/:id/snapshot", middleware.Auth(cfg.JWT), collectionHandler.Snapshot)
+			collections.GET("/:id/members", middleware.Auth(cfg.JWT), collectionHandler.ListMembers)
+			collections.POST("/:id/members", middleware.Auth(cfg.JWT), collectionHandler.AddMember)
+			collections.DELETE("/:id/members/:userId", middleware.Auth(cfg.JWT), collectionHandler.RemoveMember)
+			collections.GET("/:id/members/events", middleware.Auth(cfg.JWT), collectionHandler.MemberEvents)
 			collections.POST("/:id/share", middleware.Auth(cfg.JWT), collectionHandler.CreateShare)
+			collections.POST("/:id/restore", middleware.Auth(cfg.JWT), trashHandler.RestoreCollection)
 		}
 
 		// Guest routes
@@ -139,6 +183,7 @@ func main() {
 
 		// Public share routes
 		api.GET("/s/:token", shareHandler.GetPublicShare)
+		api.POST("/s/:token/clone", middleware.Auth(cfg.JWT), collectionHandler.Clone)
 	}
 
 	// Public share routes (also available without /api prefix for direct access)
@@ -150,6 +195,39 @@ func main() {
 		Handler: router,
 	}
 
+	// Purge trash past its retention window in the background (a non-positive
+	// interval disables the purge)
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go func() {
+		if cfg.Trash.PurgeInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(time.Duration(cfg.Trash.PurgeInterval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			entries, collections, err := trashService.Purge(purgeCtx)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to purge trash")
+			} else if entries > 0 || collections > 0 {
+				logger.Info().Int64("entries", entries).Int64("collections", collections).Msg("Purged trash")
+			}
+
+			select {
+			case <-purgeCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Deliver change events to the live event streams open on this instance;
+	// on shutdown the streams are ended so that their requests complete
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+	go eventBus.Run(eventsCtx)
+	srv.RegisterOnShutdown(eventBus.Close)
+
 	// Start server in a goroutine
 	go func() {
 		logger.Info().Str("port", cfg.Server.Port).Msg("Starting server")
@@ -1,23 +1,41 @@
 import { writable } from 'svelte/store';
-import type { Entry, Status, MediaType } from '$types';
+import type { Entry, EntryChange, Status, MediaType } from '$types';
 
 interface EntriesState {
 	entries: Entry[];
 	loading: boolean;
 	error: string | null;
+	// cursor is the change feed position the entries are up to date with.
+	cursor: string | null;
 }
 
 function createEntriesStore() {
 	const { subscribe, set, update } = writable<EntriesState>({
 		entries: [],
 		loading: false,
-		error: null
+		error: null,
+		cursor: null
 	});
 
 	return {
 		subscribe,
 		setEntries: (entries: Entry[]) => {
-			set({ entries, loading: false, error: null });
+			set({ entries, loading: false, error: null, cursor: null });
+		},
+		// applyChanges applies a page of the change feed: changed entries are
+		// replaced or added and tombstoned ones removed.
+		applyChanges: (changes: EntryChange[], cursor: string) => {
+			update(state => {
+				const byId = new Map(state.entries.map(entry => [entry.id, entry]));
+				for (const change of changes) {
+					if (change.deleted || !change.entry) {
+						byId.delete(change.entry_id);
+					} else {
+						byId.set(change.entry_id, change.entry);
+					}
+				}
+				return { ...state, entries: [...byId.values()], cursor };
+			});
 		},
 		addEntry: (entry: Entry) => {
 			update(state => ({
@@ -60,7 +78,7 @@ function createEntriesStore() {
 			return entries;
 		},
 		clear: () => {
-			set({ entries: [], loading: false, error: null });
+			set({ entries: [], loading: false, error: null, cursor: null });
 		}
 	};
 }
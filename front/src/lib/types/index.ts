@@ -2,6 +2,36 @@ export type MediaType = 'video' | 'book' | 'anime' | 'game' | 'tv' | 'movie';
 
 export type Status = 'planned' | 'in_progress' | 'completed' | 'on_hold' | 'dropped';
 
+// RatingScale is the scale a user rates on. Ratings are stored on the ten-point
+// scale and converted to and from the owner's scale by the server.
+export type RatingScale = 'ten' | 'five_star' | 'hundred' | 'like_dislike';
+
+// RatingMode says whether an entry's overall rating is set by hand or is the
+// weighted average of its sub_ratings.
+export type RatingMode = 'manual' | 'weighted';
+
+export interface RatingCriterion {
+	key: string;
+	label: string;
+	weight: number;
+}
+
+// RatingTemplate lists the sub-ratings entries of a media type are rated on;
+// custom is false for the built-in defaults.
+export interface RatingTemplate {
+	media_type: MediaType;
+	criteria: RatingCriterion[];
+	custom: boolean;
+	updated_at?: string;
+}
+
+// CollectionMode says how a collection orders its entries: not at all, as a
+// numbered ranking, or in named tiers that are each ranked.
+export type CollectionMode = 'unordered' | 'ranked' | 'tiered';
+
+// Visibility says who besides its owner may see an entry.
+export type Visibility = 'public' | 'followers' | 'private';
+
 export interface User {
 	id: string;
 	email: string;
@@ -20,6 +50,7 @@ export interface MediaItem {
 	genres?: string[];
 	duration?: number;
 	metadata?: Record<string, any>;
+	external_ids?: Record<string, string>;
 	created_at: string;
 }
 
@@ -28,13 +59,35 @@ export interface Entry {
 	user_id: string;
 	media_id: string;
 	status: Status;
+	// rating is canonical (0-10); display_rating is the same rating on the
+	// owner's rating_scale, which is also the scale ratings are sent in.
 	rating?: number;
+	display_rating?: number;
+	rating_scale?: RatingScale;
+	rating_mode?: RatingMode;
+	// sub_ratings are canonical too; display_sub_ratings are on rating_scale.
+	sub_ratings?: Record<string, number>;
+	display_sub_ratings?: Record<string, number>;
 	review_md?: string;
+	// review_html is review_md rendered and sanitized by the server; public
+	// shares carry only this form.
+	review_html?: string;
+	// private_notes are only ever returned to the entry's owner.
+	private_notes?: string;
+	// visibility is always set on entries from the server; guest entries may lack it.
+	visibility?: Visibility;
 	progress?: Record<string, any>;
 	started_at?: string;
 	finished_at?: string;
 	updated_at: string;
+	version: number;
 	media?: MediaItem;
+	// rank and tier are only set on entries listed in a ranked or tiered
+	// collection; in a tiered one rank counts within the tier.
+	rank?: number;
+	tier?: string;
+	// curator_note says why the entry is in the collection it is listed in.
+	curator_note?: string;
 }
 
 export interface Collection {
@@ -42,10 +95,81 @@ export interface Collection {
 	user_id: string;
 	title: string;
 	is_public: boolean;
+	mode: CollectionMode;
+	tiers?: string[];
+	// rules make a smart collection, whose entries are those matching them.
+	rules?: CollectionRules;
+	// role is the current user's; guest collections have none.
+	role?: CollectionRole;
+	description_md?: string;
+	description_html?: string;
+	cover_url?: string;
+	// cover_mosaic holds up to four entry covers for collections without a
+	// cover_url.
+	cover_mosaic?: string[];
+	// source credits the collection this one was cloned from.
+	source?: CollectionSource;
+	// entry_count is set by the server, also on collections listed without
+	// their entries.
+	entry_count?: number;
 	created_at: string;
+	updated_at: string;
+	version: number;
 	entries?: Entry[];
 }
 
+export interface CollectionSource {
+	// collection_id is gone once the source collection is deleted.
+	collection_id?: string;
+	title: string;
+	owner_name: string;
+}
+
+// CollectionRole is what a user may do with a collection: its owner manages
+// it, editors change it and add their own entries, viewers only read it.
+export type CollectionRole = 'owner' | 'editor' | 'viewer';
+
+export interface CollectionMember {
+	user_id: string;
+	name: string;
+	email: string;
+	role: CollectionRole;
+	added_at: string;
+}
+
+// CollectionMemberEvent is an entry of a collection's membership audit log.
+export interface CollectionMemberEvent {
+	id: number;
+	collection_id: string;
+	actor_id?: string;
+	actor_name?: string;
+	user_id?: string;
+	user_name?: string;
+	action: 'added' | 'role_changed' | 'removed' | 'left';
+	role?: CollectionRole;
+	created_at: string;
+}
+
+// CollectionRules filter like the entry list parameters of the same names;
+// an entry must have every one of tags. Ratings are on the owner's scale.
+export interface CollectionRules {
+	status?: Status;
+	type?: MediaType;
+	rating_min?: number;
+	rating_max?: number;
+	genre?: string;
+	tags?: string[];
+	year?: number;
+	finished_from?: string;
+	finished_to?: string;
+	has_review?: boolean;
+	visibility?: Visibility;
+	q?: string;
+	sort?: string;
+	order?: 'asc' | 'desc';
+	limit?: number;
+}
+
 export interface ShareToken {
 	token: string;
 	kind: string;
@@ -63,7 +187,11 @@ export interface CreateEntryRequest {
 	media_id: string;
 	status: Status;
 	rating?: number;
+	rating_mode?: RatingMode;
+	sub_ratings?: Record<string, number>;
 	review_md?: string;
+	private_notes?: string;
+	visibility?: Visibility;
 	progress?: Record<string, any>;
 	started_at?: string;
 	finished_at?: string;
@@ -79,12 +207,26 @@ export interface CreateMediaRequest {
 	genres?: string[];
 	duration?: number;
 	metadata?: Record<string, any>;
+	external_ids?: Record<string, string>;
 }
 
 export interface CreateCollectionRequest {
 	title: string;
 	is_public: boolean;
+	mode?: CollectionMode;
+	tiers?: string[];
+	rules?: CollectionRules;
 	entry_ids?: string[];
+	// Empty strings clear the description and cover.
+	description_md?: string;
+	cover_url?: string;
+}
+
+// PlaceEntryRequest says where to put an entry added to, or moved within, a
+// ranked or tiered collection. rank is 1-based.
+export interface PlaceEntryRequest {
+	rank?: number;
+	tier?: string;
 }
 
 export interface GuestSnapshotRequest {
@@ -96,6 +238,62 @@ export interface MergeRequest {
 	guest_entries: Entry[];
 }
 
+export interface SyncResponse {
+	applied: {
+		client_id: string;
+		entry_id: string;
+		entry?: Entry;
+		match?: { media_id: string; matched_by: string; confidence: number };
+	}[];
+	conflicts: {
+		client_id: string;
+		reason: 'version_mismatch' | 'deleted' | 'already_exists';
+		client: Record<string, any>;
+		server?: Entry;
+	}[];
+	ambiguous: {
+		client_id: string;
+		candidates: { media: MediaItem; matched_by: string; confidence: number }[];
+	}[];
+	errors: { client_id: string; error: string }[];
+	changes: EntryChange[];
+	cursor: string;
+	has_more: boolean;
+}
+
+// EntryChange is an item of the entry change feed: the entry's current state,
+// or a tombstone (deleted, without entry) for a deleted entry.
+export interface EntryChange {
+	entry_id: string;
+	deleted: boolean;
+	deleted_at?: string;
+	entry?: Entry;
+}
+
+export interface EntryChanges {
+	changes: EntryChange[];
+	cursor: string;
+	has_more: boolean;
+}
+
+// ChangeEvent is a live update from GET /api/events: something changed in
+// one of the user's entries, collections or shares.
+export type ChangeEventType =
+	| 'entry.created'
+	| 'entry.updated'
+	| 'entry.deleted'
+	| 'collection.created'
+	| 'collection.updated'
+	| 'collection.deleted'
+	| 'share.created';
+
+export interface ChangeEvent {
+	type: ChangeEventType;
+	id: string;
+	data?: any;
+	at: string;
+}
+
 // Local storage types
 export interface GuestData {
 	guestId: string;
@@ -8,7 +8,15 @@ import type {
 	CreateMediaRequest,
 	CreateCollectionRequest,
 	GuestSnapshotRequest,
-	MergeRequest
+	MergeRequest,
+	SyncResponse,
+	EntryChanges,
+	ChangeEvent,
+	RatingTemplate,
+	PlaceEntryRequest,
+	CollectionMember,
+	CollectionMemberEvent,
+	CollectionRole
 } from '$types';
 
 const API_BASE = '/api';
@@ -43,6 +51,11 @@ async function request<T>(
 	return response.json();
 }
 
+// ifMatch formats a resource version the way the API's ETags are formatted.
+function ifMatch(version: number): string {
+	return `"${version}"`;
+}
+
 // Auth API
 export const authApi = {
 	login: (data: LoginRequest) =>
@@ -63,6 +76,14 @@ export const authApi = {
 		})
 };
 
+// Rating templates API
+export const ratingTemplatesApi = {
+	list: (token: string) =>
+		request<RatingTemplate[]>('/rating-templates', {
+			headers: { Authorization: `Bearer ${token}` }
+		})
+};
+
 // Media API
 export const mediaApi = {
 	create: (data: CreateMediaRequest, token: string) =>
@@ -85,14 +106,28 @@ export const mediaApi = {
 
 // Entries API
 export const entriesApi = {
-	list: (token: string, params?: { type?: string; status?: string }) => {
-		const searchParams = new URLSearchParams();
+	// Loads every page of the cursor-paginated entry list.
+	list: async (token: string, params?: { type?: string; status?: string }) => {
+		const searchParams = new URLSearchParams({ limit: '200' });
 		if (params?.type) searchParams.append('type', params.type);
 		if (params?.status) searchParams.append('status', params.status);
 
-		return request<Entry[]>(`/entries?${searchParams.toString()}`, {
-			headers: { Authorization: `Bearer ${token}` }
-		});
+		const entries: Entry[] = [];
+		for (;;) {
+			const response = await fetch(`${API_BASE}/entries?${searchParams.toString()}`, {
+				headers: { 'Content-Type': 'application/json', Authorization: `Bearer ${token}` }
+			});
+			if (!response.ok) {
+				const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+				throw new ApiError(error.error || 'Request failed', response.status);
+			}
+
+			entries.push(...((await response.json()) as Entry[]));
+
+			const cursor = response.headers.get('X-Next-Cursor');
+			if (!cursor) return entries;
+			searchParams.set('cursor', cursor);
+		}
 	},
 
 	create: (data: CreateEntryRequest, token: string) =>
@@ -107,31 +142,74 @@ export const entriesApi = {
 			headers: { Authorization: `Bearer ${token}` }
 		}),
 
-	update: (id: string, data: CreateEntryRequest, token: string) =>
+	// Writes are conditional on the version the caller last saw; a stale
+	// version fails with a 412 ApiError.
+	update: (id: string, data: CreateEntryRequest, token: string, version: number) =>
 		request<Entry>(`/entries/${id}`, {
 			method: 'PATCH',
 			body: JSON.stringify(data),
-			headers: { Authorization: `Bearer ${token}` }
+			headers: { Authorization: `Bearer ${token}`, 'If-Match': ifMatch(version) }
 		}),
 
-	delete: (id: string, token: string) =>
+	delete: (id: string, token: string, version: number) =>
 		request(`/entries/${id}`, {
 			method: 'DELETE',
+			headers: { Authorization: `Bearer ${token}`, 'If-Match': ifMatch(version) }
+		}),
+
+	// changes fetches one page of the entry change feed after cursor (from the
+	// start without one).
+	changes: (token: string, cursor?: string) =>
+		request<EntryChanges>(`/entries/changes${cursor ? `?since=${encodeURIComponent(cursor)}` : ''}`, {
 			headers: { Authorization: `Bearer ${token}` }
 		}),
 
-	sync: (entries: any[], token: string) =>
-		request<{ entries: Entry[]; count: number; message: string; errors?: string[] }>('/entries/sync', {
+	// sync uploads locally created entries as sync changes. Entries the server
+	// already had come back as conflicts and are kept in their server form.
+	sync: async (entries: any[], token: string) => {
+		const changes = entries.map((entry, i) => ({
+			client_id: entry.client_id ?? String(i),
+			client_updated_at: entry.updated_at,
+			...entry
+		}));
+		const options: RequestInit = {
 			method: 'POST',
-			body: JSON.stringify({ entries }),
-			headers: { Authorization: `Bearer ${token}` }
-		})
+			body: JSON.stringify({ changes }),
+			headers: { Authorization: `Bearer ${token}`, 'Idempotency-Key': crypto.randomUUID() }
+		};
+		// A sync that fails in transit is retried once with the same key, so the
+		// server applies it at most once.
+		const response = await request<SyncResponse>('/entries/sync', options).catch((error) => {
+			if (error instanceof ApiError) throw error;
+			return request<SyncResponse>('/entries/sync', options);
+		});
+
+		const synced = [
+			...response.applied.flatMap((a) => (a.entry ? [a.entry] : [])),
+			...response.conflicts.flatMap((c) => (c.server ? [c.server] : []))
+		];
+		const errors = [
+			...response.conflicts.map((c) => `${c.client_id}: ${c.reason}`),
+			...response.ambiguous.map(
+				(a) => `${a.client_id}: matches ${a.candidates.length} media items, pick one`
+			),
+			...response.errors.map((e) => `${e.client_id}: ${e.error}`)
+		];
+		return {
+			entries: synced,
+			count: response.applied.length,
+			message: 'Sync completed',
+			errors: errors.length > 0 ? errors : undefined
+		};
+	}
 };
 
 // Collections API
 export const collectionsApi = {
-	list: (token: string) =>
-		request<Collection[]>('/collections', {
+	// Collections are listed with entry_count and cover_mosaic only, unless
+	// withEntries asks for their entries too; get returns one in full.
+	list: (token: string, withEntries = false) =>
+		request<Collection[]>(withEntries ? '/collections?include=entries' : '/collections', {
 			headers: { Authorization: `Bearer ${token}` }
 		}),
 
@@ -147,19 +225,80 @@ export const collectionsApi = {
 			headers: { Authorization: `Bearer ${token}` }
 		}),
 
-	update: (id: string, data: Partial<CreateCollectionRequest>, token: string) =>
+	update: (id: string, data: Partial<CreateCollectionRequest>, token: string, version: number) =>
 		request<Collection>(`/collections/${id}`, {
 			method: 'PATCH',
 			body: JSON.stringify(data),
-			headers: { Authorization: `Bearer ${token}` }
+			headers: { Authorization: `Bearer ${token}`, 'If-Match': ifMatch(version) }
 		}),
 
-	delete: (id: string, token: string) =>
+	delete: (id: string, token: string, version: number) =>
 		request(`/collections/${id}`, {
+			method: 'DELETE',
+			headers: { Authorization: `Bearer ${token}`, 'If-Match': ifMatch(version) }
+		}),
+
+	members: (id: string, token: string) =>
+		request<CollectionMember[]>(`/collections/${id}/members`, {
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	// Shares the collection with a registered user, or changes their role.
+	addMember: (id: string, email: string, role: CollectionRole, token: string) =>
+		request<CollectionMember[]>(`/collections/${id}/members`, {
+			method: 'POST',
+			body: JSON.stringify({ email, role }),
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	// Removes a member; members pass their own ID to leave.
+	removeMember: (id: string, userId: string, token: string) =>
+		request(`/collections/${id}/members/${userId}`, {
 			method: 'DELETE',
 			headers: { Authorization: `Bearer ${token}` }
 		}),
 
+	memberEvents: (id: string, token: string) =>
+		request<CollectionMemberEvent[]>(`/collections/${id}/members/events`, {
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	// Turns a smart collection into a static one holding its current entries.
+	snapshot: (id: string, token: string) =>
+		request<Collection>(`/collections/${id}/snapshot`, {
+			method: 'POST',
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	addEntry: (id: string, entryId: string, token: string, placement?: PlaceEntryRequest) =>
+		request<Collection>(`/collections/${id}/entries/${entryId}`, {
+			method: 'POST',
+			body: placement ? JSON.stringify(placement) : undefined,
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	removeEntry: (id: string, entryId: string, token: string) =>
+		request<Collection>(`/collections/${id}/entries/${entryId}`, {
+			method: 'DELETE',
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	// An empty note clears it.
+	setEntryNote: (id: string, entryId: string, note: string, token: string) =>
+		request<Collection>(`/collections/${id}/entries/${entryId}`, {
+			method: 'PATCH',
+			body: JSON.stringify({ note }),
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
+	// reorder takes every entry of the collection, in the new order.
+	reorder: (id: string, entryIds: string[], token: string) =>
+		request<Collection>(`/collections/${id}/reorder`, {
+			method: 'POST',
+			body: JSON.stringify({ entry_ids: entryIds }),
+			headers: { Authorization: `Bearer ${token}` }
+		}),
+
 	createShare: (id: string, token: string) =>
 		request<{ share_url: string }>(`/collections/${id}/share`, {
 			method: 'POST',
@@ -183,8 +322,58 @@ export const guestApi = {
 		})
 };
 
+// Events API
+export const eventsApi = {
+	// stream reads the user's live change events, calling onEvent for each,
+	// until the server ends the stream or signal is aborted. It uses fetch
+	// rather than EventSource so the token goes in a header, not the URL.
+	stream: async (token: string, onEvent: (event: ChangeEvent) => void, signal: AbortSignal) => {
+		const response = await fetch(`${API_BASE}/events`, {
+			headers: { Authorization: `Bearer ${token}`, Accept: 'text/event-stream' },
+			signal
+		});
+		if (!response.ok || !response.body) {
+			const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+			throw new ApiError(error.error || 'Request failed', response.status);
+		}
+
+		const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+		let buffer = '';
+		for (;;) {
+			const { value, done } = await reader.read();
+			if (done) return;
+			buffer += value.replace(/\r\n/g, '\n');
+
+			// Events end with a blank line; lines starting with ':' are heartbeats.
+			let end: number;
+			while ((end = buffer.indexOf('\n\n')) >= 0) {
+				const block = buffer.slice(0, end);
+				buffer = buffer.slice(end + 2);
+
+				let name = 'message';
+				const data: string[] = [];
+				for (const line of block.split('\n')) {
+					if (line.startsWith('event:')) name = line.slice(6).trim();
+					else if (line.startsWith('data:')) data.push(line.slice(5).replace(/^ /, ''));
+				}
+				if (name !== 'ready' && data.length > 0) {
+					onEvent(JSON.parse(data.join('\n')) as ChangeEvent);
+				}
+			}
+		}
+	}
+};
+
 // Public API
 export const publicApi = {
 	getShare: (token: string) =>
-		request<any>(`/s/${token}`)
+		request<any>(`/s/${token}`),
+
+	// Copies a shared collection into the user's account, adding planned
+	// entries for media they do not track yet.
+	clone: (shareToken: string, token: string) =>
+		request<Collection>(`/s/${shareToken}/clone`, {
+			method: 'POST',
+			headers: { Authorization: `Bearer ${token}` }
+		})
 };
@@ -0,0 +1,78 @@
+import { get } from 'svelte/store';
+import { entries } from '$stores/entries';
+import { collections } from '$stores/collections';
+import { entriesApi, collectionsApi, eventsApi } from '$utils/api';
+import type { ChangeEvent } from '$types';
+
+// Reconnect delays after a stream ends, growing up to the last one.
+const RECONNECT_DELAYS = [1000, 2000, 5000, 15000, 30000];
+
+// startLiveUpdates keeps the entries and collections stores up to date with
+// changes made in other tabs and on other devices. Entries are refreshed from
+// the change feed, which also catches up on anything missed while the stream
+// was down. It returns a function that stops the updates.
+export function startLiveUpdates(token: string): () => void {
+	const controller = new AbortController();
+	let pulling: Promise<void> | null = null;
+	let pullAgain = false;
+
+	async function pullEntryChanges() {
+		if (pulling) {
+			pullAgain = true;
+			return pulling;
+		}
+		pulling = (async () => {
+			do {
+				pullAgain = false;
+				let cursor = get(entries).cursor ?? undefined;
+				for (;;) {
+					const page = await entriesApi.changes(token, cursor);
+					entries.applyChanges(page.changes, page.cursor);
+					if (!page.has_more) break;
+					cursor = page.cursor;
+				}
+			} while (pullAgain && !controller.signal.aborted);
+		})().finally(() => {
+			pulling = null;
+		});
+		return pulling;
+	}
+
+	async function applyCollectionEvent(event: ChangeEvent) {
+		if (event.type === 'collection.deleted') {
+			collections.removeCollection(event.id);
+			return;
+		}
+		const collection = event.data ?? (await collectionsApi.get(event.id, token));
+		const known = get(collections).collections.some((c) => c.id === event.id);
+		if (known) collections.updateCollection(event.id, collection);
+		else collections.addCollection(collection);
+	}
+
+	function handle(event: ChangeEvent) {
+		const applied = event.type.startsWith('entry.')
+			? pullEntryChanges()
+			: event.type.startsWith('collection.')
+				? applyCollectionEvent(event)
+				: Promise.resolve();
+		applied.catch((error) => console.error('Failed to apply live update:', error));
+	}
+
+	(async () => {
+		let attempt = 0;
+		while (!controller.signal.aborted) {
+			try {
+				await pullEntryChanges();
+				await eventsApi.stream(token, handle, controller.signal);
+				attempt = 0;
+			} catch (error) {
+				if (controller.signal.aborted) return;
+				console.error('Live updates disconnected:', error);
+			}
+			const delay = RECONNECT_DELAYS[Math.min(attempt++, RECONNECT_DELAYS.length - 1)];
+			await new Promise((resolve) => setTimeout(resolve, delay));
+		}
+	})();
+
+	return () => controller.abort();
+}
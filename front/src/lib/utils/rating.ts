@@ -0,0 +1,25 @@
+import type { Entry, RatingScale } from '$types';
+
+// ratingMax is the highest rating on a scale.
+export function ratingMax(scale: RatingScale = 'ten'): number {
+	switch (scale) {
+		case 'five_star':
+			return 5;
+		case 'hundred':
+			return 100;
+		case 'like_dislike':
+			return 1;
+		default:
+			return 10;
+	}
+}
+
+// formatRating shows an entry's rating on its owner's scale, falling back to
+// the canonical 0-10 rating for entries that carry no display rating.
+export function formatRating(entry: Entry): string {
+	if (entry.rating == null) return 'No rating';
+	const scale = entry.rating_scale ?? 'ten';
+	const value = entry.display_rating ?? entry.rating;
+	if (scale === 'like_dislike') return value >= 1 ? '👍' : '👎';
+	return `${value}/${ratingMax(scale)}`;
+}
@@ -0,0 +1,6 @@
+-- Normalized completion percentage for entries
+-- Computed by the server from the typed progress payload so entries can be sorted by it
+
+ALTER TABLE entries ADD COLUMN completion NUMERIC(5,2) CHECK (completion BETWEEN 0 AND 100);
+
+CREATE INDEX idx_entries_user_completion ON entries(user_id, completion DESC NULLS LAST);
@@ -0,0 +1,24 @@
+-- Consumption cycles (rewatches, rereads, replays) per entry
+-- An entry keeps one row per user and media; each pass through the media is a cycle
+
+CREATE TABLE entry_cycles (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    entry_id UUID NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    number INTEGER NOT NULL CHECK (number > 0),
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    started_at DATE,
+    finished_at DATE,
+    rating NUMERIC(3,1) CHECK (rating BETWEEN 0 AND 10),
+    notes TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE(entry_id, number)
+);
+
+CREATE INDEX idx_entry_cycles_entry ON entry_cycles(entry_id, number DESC);
+
+-- Existing entries that were started or finished become their first cycle
+INSERT INTO entry_cycles (entry_id, number, completed, started_at, finished_at, rating)
+SELECT id, 1, status = 'completed', started_at, finished_at, rating
+FROM entries
+WHERE status <> 'planned' OR started_at IS NOT NULL OR finished_at IS NOT NULL;
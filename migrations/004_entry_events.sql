@@ -0,0 +1,18 @@
+-- Progress and status history for entries (the consumption diary)
+
+CREATE TABLE entry_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    entry_id UUID NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('status', 'progress', 'session')),
+    occurred_on DATE NOT NULL,
+    from_status TEXT,
+    to_status TEXT,
+    progress_from JSONB,
+    progress_to JSONB,
+    note TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_entry_events_user_date ON entry_events(user_id, occurred_on DESC, created_at DESC);
+CREATE INDEX idx_entry_events_entry ON entry_events(entry_id, occurred_on DESC);
@@ -0,0 +1,10 @@
+-- Per-user preferences, starting with the automatic status transition rules
+
+CREATE TABLE user_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    auto_start_date BOOLEAN NOT NULL DEFAULT TRUE,
+    auto_finish_date BOOLEAN NOT NULL DEFAULT TRUE,
+    auto_fill_progress BOOLEAN NOT NULL DEFAULT TRUE,
+    auto_complete_on_progress BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+-- Indexes backing the sorted, filtered and cursor-paginated entry list
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_entries_user_updated ON entries(user_id, updated_at DESC, id DESC);
+CREATE INDEX idx_entries_user_rating ON entries(user_id, (COALESCE(rating, -1)) DESC, id DESC);
+CREATE INDEX idx_entries_user_started ON entries(user_id, (COALESCE(started_at, DATE '0001-01-01')) DESC, id DESC);
+CREATE INDEX idx_entries_user_finished ON entries(user_id, (COALESCE(finished_at, DATE '0001-01-01')) DESC, id DESC);
+CREATE INDEX idx_media_items_title_trgm ON media_items USING gin(title gin_trgm_ops);
+CREATE INDEX idx_entries_review_trgm ON entries USING gin(review_md gin_trgm_ops);
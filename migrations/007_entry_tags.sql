@@ -0,0 +1,10 @@
+-- Free-form tags on entries
+
+CREATE TABLE entry_tags (
+    entry_id UUID NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL CHECK (tag <> ''),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (entry_id, tag)
+);
+
+CREATE INDEX idx_entry_tags_tag ON entry_tags(tag);
@@ -0,0 +1,12 @@
+-- Soft delete: deleted entries and collections go to the trash and can be
+-- restored until the background purge removes them
+
+ALTER TABLE entries ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE collections ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- A trashed entry must not block adding the same media again
+ALTER TABLE entries DROP CONSTRAINT IF EXISTS entries_user_id_media_id_key;
+CREATE UNIQUE INDEX idx_entries_user_media_live ON entries(user_id, media_id) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_entries_trash ON entries(user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_collections_trash ON collections(user_id, deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Row versions for optimistic concurrency control (ETag / If-Match)
+
+ALTER TABLE entries ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE collections ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE collections ADD COLUMN updated_at TIMESTAMPTZ DEFAULT NOW();
+UPDATE collections SET updated_at = created_at;
@@ -0,0 +1,32 @@
+-- Change sequence for the sync protocol: every insert or update of an entry
+-- (including moving it to the trash) takes the next value, so clients can ask
+-- for everything that changed after the last value they saw
+
+CREATE SEQUENCE entry_change_seq;
+
+ALTER TABLE entries ADD COLUMN change_seq BIGINT NOT NULL DEFAULT nextval('entry_change_seq');
+
+-- Sequence values are handed out in call order but become visible in commit
+-- order, so a client could read change 12 before a slower transaction commits
+-- change 11 and then never see 11. Writers of a user's entries take a lock on
+-- that user until they commit before drawing a value, which keeps each user's
+-- changes visible in change_seq order.
+CREATE OR REPLACE FUNCTION lock_entry_changes(user_id UUID) RETURNS VOID AS $$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtextextended(user_id::text, 0));
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION bump_entry_change_seq() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM lock_entry_changes(NEW.user_id);
+    NEW.change_seq := nextval('entry_change_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER entries_change_seq
+    BEFORE INSERT OR UPDATE ON entries
+    FOR EACH ROW EXECUTE FUNCTION bump_entry_change_seq();
+
+CREATE INDEX idx_entries_user_change_seq ON entries(user_id, change_seq);
@@ -0,0 +1,11 @@
+-- External catalogue IDs of media items, used to match synced media exactly
+
+CREATE TABLE media_external_ids (
+    media_id UUID NOT NULL REFERENCES media_items(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    PRIMARY KEY (source, external_id)
+);
+
+CREATE INDEX idx_media_external_ids_media ON media_external_ids(media_id);
+CREATE INDEX idx_media_items_original_title_trgm ON media_items USING gin(original_title gin_trgm_ops);
@@ -0,0 +1,35 @@
+-- Tombstones for the entry change feed
+
+-- An entry that is removed for good (purged from the trash, or deleted along
+-- with its media) leaves a tombstone so clients syncing later still learn it
+-- is gone. A purged entry keeps the change_seq of its move to the trash, which
+-- clients have already been sent; any other entry gets a new one.
+CREATE TABLE entry_tombstones (
+    entry_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    change_seq BIGINT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_entry_tombstones_user_change_seq ON entry_tombstones(user_id, change_seq);
+
+-- Tombstones draw from entry_change_seq under the same per-user lock as
+-- entry writes (see 010_entry_change_seq.sql).
+CREATE OR REPLACE FUNCTION record_entry_tombstone() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM lock_entry_changes(OLD.user_id);
+    INSERT INTO entry_tombstones (entry_id, user_id, change_seq, deleted_at)
+    VALUES (
+        OLD.id,
+        OLD.user_id,
+        CASE WHEN OLD.deleted_at IS NOT NULL THEN OLD.change_seq ELSE nextval('entry_change_seq') END,
+        COALESCE(OLD.deleted_at, NOW())
+    )
+    ON CONFLICT (entry_id) DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER entries_tombstone
+    AFTER DELETE ON entries
+    FOR EACH ROW EXECUTE FUNCTION record_entry_tombstone();
@@ -0,0 +1,11 @@
+-- Private notes and per-entry visibility
+
+-- private_notes is only ever returned to the entry's owner. visibility decides
+-- who else sees the entry: everyone with a share link (public), only
+-- followers, or nobody (private).
+ALTER TABLE entries
+    ADD COLUMN private_notes TEXT,
+    ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+        CHECK (visibility IN ('public', 'followers', 'private'));
+
+CREATE INDEX idx_entries_user_visibility ON entries(user_id, visibility) WHERE deleted_at IS NULL;
@@ -0,0 +1,7 @@
+-- Per-user rating scale preference
+
+-- Ratings stay stored on the canonical 0-10 scale; rating_scale is the scale
+-- the user enters and reads them in.
+ALTER TABLE user_settings
+    ADD COLUMN rating_scale TEXT NOT NULL DEFAULT 'ten'
+        CHECK (rating_scale IN ('ten', 'five_star', 'hundred', 'like_dislike'));
@@ -0,0 +1,18 @@
+-- Multi-criteria ratings
+
+-- Per-user rating templates: the named criteria (with weights) entries of a
+-- media type are rated on. Users without a row get the built-in defaults.
+CREATE TABLE rating_templates (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    media_type TEXT NOT NULL,
+    criteria JSONB NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (user_id, media_type)
+);
+
+-- sub_ratings maps criteria keys to canonical 0-10 ratings. In 'weighted'
+-- mode the overall rating is the weighted average of the sub-ratings.
+ALTER TABLE entries
+    ADD COLUMN sub_ratings JSONB,
+    ADD COLUMN rating_mode TEXT NOT NULL DEFAULT 'manual'
+        CHECK (rating_mode IN ('manual', 'weighted'));
@@ -0,0 +1,14 @@
+-- Ranked and tiered collections
+
+-- mode decides how entries are presented: as a plain list, numbered by
+-- position, or grouped into the named tiers (best first).
+ALTER TABLE collections
+    ADD COLUMN mode TEXT NOT NULL DEFAULT 'unordered'
+        CHECK (mode IN ('unordered', 'ranked', 'tiered')),
+    ADD COLUMN tiers TEXT[];
+
+-- The tier an entry of a tiered collection sits in (NULL: not yet sorted).
+-- A tiered collection's positions run through its tiers in order.
+ALTER TABLE collection_entries ADD COLUMN tier TEXT;
+
+CREATE INDEX idx_collection_entries_position ON collection_entries(collection_id, position);
@@ -0,0 +1,6 @@
+-- Smart collections
+
+-- The saved entry filter of a smart collection (NULL: a static collection).
+-- A smart collection's entries are evaluated on read; collection_entries
+-- holds none for it.
+ALTER TABLE collections ADD COLUMN rules JSONB;
@@ -0,0 +1,28 @@
+-- Collaborative collections
+
+-- Users a collection is shared with, besides its owner (collections.user_id).
+-- Editors may change the collection and add their own entries to it; viewers
+-- may only read it.
+CREATE TABLE collection_members (
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('editor', 'viewer')),
+    added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, user_id)
+);
+
+CREATE INDEX idx_collection_members_user_id ON collection_members(user_id);
+
+-- Audit log of membership changes. Rows outlive the members they name.
+CREATE TABLE collection_member_events (
+    id BIGSERIAL PRIMARY KEY,
+    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('added', 'role_changed', 'removed', 'left')),
+    role TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_collection_member_events_collection_id ON collection_member_events(collection_id, created_at);
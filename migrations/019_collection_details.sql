@@ -0,0 +1,10 @@
+-- Collection descriptions, covers and curator notes
+
+-- description_md is markdown, rendered to sanitized HTML when read. Without a
+-- cover_url a collection's cover is a mosaic of its entries' covers.
+ALTER TABLE collections
+    ADD COLUMN description_md TEXT,
+    ADD COLUMN cover_url TEXT;
+
+-- Why an entry is in the collection, in the curator's words.
+ALTER TABLE collection_entries ADD COLUMN note TEXT;
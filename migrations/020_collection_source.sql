@@ -0,0 +1,8 @@
+-- Attribution for collections cloned from a share
+
+-- The title and owner's name are copied at clone time so the attribution
+-- survives the source collection being renamed or deleted.
+ALTER TABLE collections
+    ADD COLUMN source_collection_id UUID REFERENCES collections(id) ON DELETE SET NULL,
+    ADD COLUMN source_title TEXT,
+    ADD COLUMN source_owner_name TEXT;